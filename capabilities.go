@@ -0,0 +1,249 @@
+package polyllm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/recally-io/polyllm/llms"
+)
+
+// jsonModePrompt asks models without json_object response format support for JSON
+const jsonModePrompt = "Reply with a valid JSON object only, without code fences or any other text."
+
+// AdaptRequest validates a request against the capabilities of its model and applies the capability policy
+// of the provider, see llms.CapabilityPolicy. Requests for models without known capabilities are returned unchanged.
+// It returns ErrUnsupportedCapability when the request uses features the model does not support and the policy
+// rejects them, or when they cannot be adapted.
+//
+// Equivalent rewrites are applied with both the adapt and reject policies: OpenAI reasoning models get
+// developer instead of system messages, or the system prompt in the first user message when they reject
+// developer messages, and max_completion_tokens instead of max_tokens.
+func (p *PolyLLM) AdaptRequest(req llms.ChatCompletionRequest) (llms.ChatCompletionRequest, error) {
+	name, _, _ := strings.Cut(req.Model, "?")
+	llm, ok := p.modelLLMMappings[name]
+	if !ok {
+		return req, ErrProviderNotFound
+	}
+	policy := llm.GetProvider().CapabilityPolicy
+	if policy == "" {
+		policy = llms.CapabilityPolicyAdapt
+	}
+	model, ok := p.GetModel(req.Model)
+	if !ok || model.Capabilities == nil || policy == llms.CapabilityPolicyPassthrough {
+		return req, nil
+	}
+	adapter := &requestAdapter{req: req, model: model, policy: policy}
+	adapter.adapt()
+	if len(adapter.unsupported) > 0 {
+		return req, errors.Join(adapter.unsupported...)
+	}
+	if len(adapter.changes) > 0 {
+		slog.Debug("adapted request to the model capabilities", "model", req.Model, "changes", adapter.changes)
+	}
+	return adapter.req, nil
+}
+
+// requestAdapter rewrites a request for a model, collecting the applied changes and the unsupported features.
+type requestAdapter struct {
+	req         llms.ChatCompletionRequest
+	model       llms.Model
+	policy      llms.CapabilityPolicy
+	changes     []string
+	unsupported []error
+}
+
+// lossy applies a change that alters the request meaning, or records the feature as unsupported
+// when the policy rejects such requests.
+func (a *requestAdapter) lossy(feature string, change func()) {
+	if a.policy != llms.CapabilityPolicyAdapt {
+		a.reject(feature)
+		return
+	}
+	change()
+	a.changes = append(a.changes, feature)
+}
+
+func (a *requestAdapter) reject(feature string) {
+	a.unsupported = append(a.unsupported, fmt.Errorf("%w: model %s does not support %s", ErrUnsupportedCapability, a.req.Model, feature))
+}
+
+func (a *requestAdapter) adapt() {
+	caps := a.model.Capabilities
+	req := &a.req
+
+	if !caps.Vision && hasImages(req.Messages) {
+		a.reject("images")
+	}
+	if !caps.Tools && (len(req.Tools) > 0 || len(req.Functions) > 0) {
+		a.reject("tools")
+	}
+	if req.ReasoningEffort != "" && !caps.ReasoningEffort {
+		a.lossy("reasoning_effort", func() { req.ReasoningEffort = "" })
+	}
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage && !caps.StreamUsage {
+		a.lossy("stream_options.include_usage", func() { req.StreamOptions = nil })
+	}
+	a.adaptResponseFormat()
+
+	if caps.Reasoning {
+		a.adaptReasoning()
+	}
+	if limit := a.model.MaxOutputTokens; limit > 0 {
+		if req.MaxTokens > limit {
+			a.lossy(fmt.Sprintf("max_tokens above %d", limit), func() { req.MaxTokens = limit })
+		}
+		if req.MaxCompletionTokens > limit {
+			a.lossy(fmt.Sprintf("max_completion_tokens above %d", limit), func() { req.MaxCompletionTokens = limit })
+		}
+	}
+}
+
+// adaptResponseFormat emulates the json_schema and json_object response formats with the strongest
+// supported format and instructions in the system prompt.
+func (a *requestAdapter) adaptResponseFormat() {
+	caps := a.model.Capabilities
+	req := &a.req
+	if req.ResponseFormat == nil {
+		return
+	}
+	switch req.ResponseFormat.Type {
+	case llms.ChatCompletionResponseFormatTypeJSONSchema:
+		if caps.JSONSchema {
+			return
+		}
+		a.lossy("the json_schema response format", func() {
+			prompt := jsonModePrompt
+			if format := req.ResponseFormat.JSONSchema; format != nil && format.Schema != nil {
+				if schema, err := json.Marshal(format.Schema); err == nil {
+					prompt = "Reply with a valid JSON object only, without code fences or any other text, matching this JSON Schema:\n" + string(schema)
+				}
+			}
+			req.ResponseFormat = nil
+			if caps.JSONMode {
+				req.ResponseFormat = &llms.ChatCompletionResponseFormat{Type: llms.ChatCompletionResponseFormatTypeJSONObject}
+			}
+			req.Messages = appendSystemPrompt(req.Messages, prompt)
+		})
+	case llms.ChatCompletionResponseFormatTypeJSONObject:
+		if caps.JSONMode {
+			return
+		}
+		a.lossy("the json_object response format", func() {
+			req.ResponseFormat = nil
+			req.Messages = appendSystemPrompt(req.Messages, jsonModePrompt)
+		})
+	}
+}
+
+// adaptReasoning rewrites requests for OpenAI reasoning models.
+func (a *requestAdapter) adaptReasoning() {
+	req := &a.req
+	if req.MaxTokens > 0 {
+		if req.MaxCompletionTokens == 0 {
+			req.MaxCompletionTokens = req.MaxTokens
+		}
+		req.MaxTokens = 0
+		a.changes = append(a.changes, "max_tokens as max_completion_tokens")
+	}
+	if a.model.Capabilities.DeveloperRole {
+		copied := false
+		for i, msg := range req.Messages {
+			if msg.Role != llms.ChatMessageRoleSystem {
+				continue
+			}
+			if !copied {
+				req.Messages = append([]llms.ChatCompletionMessage{}, req.Messages...)
+				a.changes = append(a.changes, "system messages as developer messages")
+				copied = true
+			}
+			req.Messages[i].Role = llms.ChatMessageRoleDeveloper
+		}
+	} else if messages, ok := foldSystemPrompt(req.Messages); ok {
+		req.Messages = messages
+		a.changes = append(a.changes, "system messages in the first user message")
+	}
+
+	sampling := []struct {
+		name  string
+		set   bool
+		unset func()
+	}{
+		{"temperature", req.Temperature != 0, func() { req.Temperature = 0 }},
+		{"top_p", req.TopP != 0, func() { req.TopP = 0 }},
+		{"presence_penalty", req.PresencePenalty != 0, func() { req.PresencePenalty = 0 }},
+		{"frequency_penalty", req.FrequencyPenalty != 0, func() { req.FrequencyPenalty = 0 }},
+		{"logit_bias", len(req.LogitBias) > 0, func() { req.LogitBias = nil }},
+		{"logprobs", req.LogProbs || req.TopLogProbs > 0, func() { req.LogProbs, req.TopLogProbs = false, 0 }},
+	}
+	for _, param := range sampling {
+		if param.set {
+			a.lossy(param.name, param.unset)
+		}
+	}
+}
+
+// hasImages reports whether any message has an image part.
+func hasImages(messages []llms.ChatCompletionMessage) bool {
+	for _, msg := range messages {
+		for _, part := range msg.MultiContent {
+			if part.Type == llms.ChatMessagePartTypeImageURL {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// foldSystemPrompt moves the text of the system messages to the beginning of the first user message,
+// or turns it into a user message when there is none. It reports whether there were system messages.
+func foldSystemPrompt(messages []llms.ChatCompletionMessage) ([]llms.ChatCompletionMessage, bool) {
+	var prompts []string
+	folded := make([]llms.ChatCompletionMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role != llms.ChatMessageRoleSystem {
+			folded = append(folded, msg)
+			continue
+		}
+		if msg.Content != "" {
+			prompts = append(prompts, msg.Content)
+		}
+		for _, part := range msg.MultiContent {
+			if part.Type == llms.ChatMessagePartTypeText && part.Text != "" {
+				prompts = append(prompts, part.Text)
+			}
+		}
+	}
+	if len(folded) == len(messages) {
+		return messages, false
+	}
+	if len(prompts) == 0 {
+		return folded, true
+	}
+	prompt := strings.Join(prompts, "\n\n")
+	for i, msg := range folded {
+		if msg.Role != llms.ChatMessageRoleUser {
+			continue
+		}
+		if len(msg.MultiContent) > 0 {
+			parts := append([]llms.ChatMessagePart{{Type: llms.ChatMessagePartTypeText, Text: prompt}}, msg.MultiContent...)
+			folded[i].MultiContent = parts
+		} else {
+			folded[i].Content = prompt + "\n\n" + msg.Content
+		}
+		return folded, true
+	}
+	return append([]llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: prompt}}, folded...), true
+}
+
+// appendSystemPrompt adds the prompt to the leading system message, or inserts a system message.
+func appendSystemPrompt(messages []llms.ChatCompletionMessage, prompt string) []llms.ChatCompletionMessage {
+	messages = append([]llms.ChatCompletionMessage{}, messages...)
+	if len(messages) > 0 && messages[0].Role == llms.ChatMessageRoleSystem && len(messages[0].MultiContent) == 0 {
+		messages[0].Content += "\n\n" + prompt
+		return messages
+	}
+	return append([]llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleSystem, Content: prompt}}, messages...)
+}
@@ -0,0 +1,150 @@
+package polyllm
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCapabilityPolyLLM(policy llms.CapabilityPolicy) *PolyLLM {
+	return New(WithLLMProviders(llms.Provider{
+		Type:             llms.ProviderTypeMock,
+		Name:             "test-capabilities-" + string(policy),
+		ModelPrefix:      "caps/",
+		CapabilityPolicy: policy,
+		Models: []llms.Model{
+			{ID: "caps/o3-mini"},
+			{ID: "caps/o1-mini"},
+			{ID: "caps/text", MaxOutputTokens: 1000, Capabilities: &llms.ModelCapabilities{JSONMode: true}},
+			{ID: "caps/unknown"},
+		},
+	}))
+}
+
+func TestAdaptRequest(t *testing.T) {
+	p := newCapabilityPolyLLM("")
+	userMessage := llms.ChatCompletionMessage{Role: llms.ChatMessageRoleUser, Content: "hi"}
+
+	t.Run("reasoning model", func(t *testing.T) {
+		messages := []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleSystem, Content: "be brief"}, userMessage}
+		req, err := p.AdaptRequest(llms.ChatCompletionRequest{
+			Model:           "caps/o3-mini",
+			Messages:        messages,
+			MaxTokens:       500,
+			Temperature:     0.7,
+			ReasoningEffort: "low",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, llms.ChatMessageRoleDeveloper, req.Messages[0].Role)
+		assert.Equal(t, llms.ChatMessageRoleSystem, messages[0].Role, "the caller messages are not modified")
+		assert.Zero(t, req.MaxTokens)
+		assert.Equal(t, 500, req.MaxCompletionTokens)
+		assert.Zero(t, req.Temperature)
+		assert.Equal(t, "low", req.ReasoningEffort)
+	})
+
+	t.Run("reasoning model without developer messages", func(t *testing.T) {
+		messages := []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleSystem, Content: "be brief"}, userMessage}
+		req, err := p.AdaptRequest(llms.ChatCompletionRequest{
+			Model:          "caps/o1-mini",
+			Messages:       messages,
+			ResponseFormat: &llms.ChatCompletionResponseFormat{Type: llms.ChatCompletionResponseFormatTypeJSONObject},
+		})
+		require.NoError(t, err)
+		require.Len(t, req.Messages, 1)
+		assert.Equal(t, llms.ChatMessageRoleUser, req.Messages[0].Role)
+		assert.Equal(t, "be brief\n\n"+jsonModePrompt+"\n\nhi", req.Messages[0].Content)
+		assert.Nil(t, req.ResponseFormat)
+		assert.Equal(t, "be brief", messages[0].Content, "the caller messages are not modified")
+
+		// the system prompt becomes a user message without one
+		req, err = p.AdaptRequest(llms.ChatCompletionRequest{Model: "caps/o1-mini", Messages: messages[:1]})
+		require.NoError(t, err)
+		assert.Equal(t, []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "be brief"}}, req.Messages)
+	})
+
+	t.Run("json schema emulation", func(t *testing.T) {
+		req, err := p.AdaptRequest(llms.ChatCompletionRequest{
+			Model:    "caps/text",
+			Messages: []llms.ChatCompletionMessage{userMessage},
+			ResponseFormat: &llms.ChatCompletionResponseFormat{
+				Type: llms.ChatCompletionResponseFormatTypeJSONSchema,
+				JSONSchema: &llms.ChatCompletionResponseFormatJSONSchema{
+					Name:   "city",
+					Schema: json.RawMessage(`{"type":"object"}`),
+				},
+			},
+			ReasoningEffort: "high",
+			MaxTokens:       5000,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, llms.ChatCompletionResponseFormatTypeJSONObject, req.ResponseFormat.Type)
+		require.Len(t, req.Messages, 2)
+		assert.Equal(t, llms.ChatMessageRoleSystem, req.Messages[0].Role)
+		assert.Contains(t, req.Messages[0].Content, `{"type":"object"}`)
+		assert.Empty(t, req.ReasoningEffort)
+		assert.Equal(t, 1000, req.MaxTokens)
+	})
+
+	t.Run("cannot adapt", func(t *testing.T) {
+		_, err := p.AdaptRequest(llms.ChatCompletionRequest{
+			Model: "caps/text",
+			Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, MultiContent: []llms.ChatMessagePart{
+				{Type: llms.ChatMessagePartTypeImageURL, ImageURL: &llms.ChatMessageImageURL{URL: "https://example.com/a.png"}},
+			}}},
+			Tools: []llms.Tool{{Type: llms.ToolTypeFunction, Function: &llms.FunctionDefinition{Name: "f"}}},
+		})
+		assert.ErrorIs(t, err, ErrUnsupportedCapability)
+		assert.ErrorContains(t, err, "model caps/text does not support images")
+		assert.ErrorContains(t, err, "model caps/text does not support tools")
+	})
+
+	t.Run("unknown capabilities", func(t *testing.T) {
+		in := llms.ChatCompletionRequest{Model: "caps/unknown", Messages: []llms.ChatCompletionMessage{userMessage}, ReasoningEffort: "high"}
+		req, err := p.AdaptRequest(in)
+		require.NoError(t, err)
+		assert.Equal(t, in, req)
+	})
+}
+
+func TestCapabilityPolicies(t *testing.T) {
+	req := llms.ChatCompletionRequest{
+		Model:           "caps/o3-mini",
+		Messages:        []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleSystem, Content: "be brief"}},
+		MaxTokens:       500,
+		Temperature:     0.7,
+		ReasoningEffort: "low",
+	}
+
+	adapted, err := newCapabilityPolyLLM(llms.CapabilityPolicyReject).AdaptRequest(req)
+	assert.ErrorIs(t, err, ErrUnsupportedCapability)
+	assert.ErrorContains(t, err, "does not support temperature")
+	assert.Equal(t, req, adapted)
+
+	req.Temperature = 0
+	adapted, err = newCapabilityPolyLLM(llms.CapabilityPolicyReject).AdaptRequest(req)
+	require.NoError(t, err)
+	assert.Equal(t, llms.ChatMessageRoleDeveloper, adapted.Messages[0].Role)
+	assert.Equal(t, 500, adapted.MaxCompletionTokens)
+
+	adapted, err = newCapabilityPolyLLM(llms.CapabilityPolicyPassthrough).AdaptRequest(req)
+	require.NoError(t, err)
+	assert.Equal(t, req, adapted)
+}
+
+func TestChatCompletionRejectsUnsupportedCapability(t *testing.T) {
+	p := newCapabilityPolyLLM(llms.CapabilityPolicyReject)
+	var err error
+	p.ChatCompletion(context.Background(), llms.ChatCompletionRequest{
+		Model:          "caps/text",
+		Messages:       []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "hi"}},
+		ResponseFormat: &llms.ChatCompletionResponseFormat{Type: llms.ChatCompletionResponseFormatTypeJSONSchema},
+	}, func(resp llms.StreamingChatCompletionResponse) {
+		err = resp.Err
+	})
+	assert.ErrorIs(t, err, ErrUnsupportedCapability)
+}
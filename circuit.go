@@ -0,0 +1,138 @@
+package polyllm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+)
+
+// CircuitState is the state of the circuit breaker of a provider.
+type CircuitState string
+
+const (
+	// CircuitClosed lets requests through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails requests with ErrCircuitOpen until the cool-down is over
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a limited number of trial requests through, closing the circuit when they succeed
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerConfig configures the circuit breakers stopping requests to providers failing repeatedly,
+// every provider has its own circuit breaker.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures opening the circuit, 5 by default
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+	// CoolDown is how long the circuit stays open before trial requests are let through, 30 seconds by default
+	CoolDown time.Duration `json:"cool_down,omitempty"`
+	// HalfOpenRequests is the number of concurrent trial requests of a half open circuit, 1 by default
+	HalfOpenRequests int `json:"half_open_requests,omitempty"`
+}
+
+type circuitBreaker struct {
+	cfg CircuitBreakerConfig
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	trials   int
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &circuitBreaker{cfg: cfg, now: time.Now, state: CircuitClosed}
+}
+
+// State returns the state of the circuit, an open circuit is half open once its cool-down is over.
+func (b *circuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cooledDown()
+	return b.state
+}
+
+func (b *circuitBreaker) cooledDown() {
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.cfg.CoolDown {
+		b.state = CircuitHalfOpen
+		b.trials = 0
+	}
+}
+
+// allow reports whether a request can be sent, the result of allowed requests must be recorded.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cooledDown()
+	switch b.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if b.trials >= b.cfg.HalfOpenRequests {
+			return false
+		}
+		b.trials++
+	}
+	return true
+}
+
+// record records the result of a request, requests canceled by the caller are neither successes nor failures
+// and errors caused by the request itself, e.g. a 400 response, are successes, see isProviderFailure.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case errors.Is(err, context.Canceled):
+		if b.state == CircuitHalfOpen && b.trials > 0 {
+			b.trials--
+		}
+	case !isProviderFailure(err):
+		b.state = CircuitClosed
+		b.failures = 0
+	case b.state == CircuitHalfOpen:
+		b.open()
+	case b.state == CircuitClosed:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.state = CircuitOpen
+	b.openedAt = b.now()
+	b.failures = 0
+}
+
+// isProviderFailure reports whether an error is a failure of the provider: a 5xx or 429 response, a timeout
+// or a transport error.
+func isProviderFailure(err error) bool {
+	var statusErr *llms.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// isRequestError reports whether an error is a 4xx response caused by the request, other than 429.
+func isRequestError(err error) bool {
+	var statusErr *llms.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode >= http.StatusBadRequest &&
+		statusErr.StatusCode < http.StatusInternalServerError && statusErr.StatusCode != http.StatusTooManyRequests
+}
@@ -0,0 +1,186 @@
+package polyllm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, CoolDown: time.Minute})
+	b.now = func() time.Time { return now }
+	failure := &llms.StatusError{StatusCode: http.StatusServiceUnavailable, Body: "unavailable"}
+
+	// successes reset the consecutive failures
+	require.True(t, b.allow())
+	b.record(failure)
+	require.True(t, b.allow())
+	b.record(nil)
+	require.True(t, b.allow())
+	b.record(failure)
+	assert.Equal(t, CircuitClosed, b.State())
+	require.True(t, b.allow())
+	b.record(failure)
+	assert.Equal(t, CircuitOpen, b.State())
+	assert.False(t, b.allow())
+
+	// a single trial request is let through after the cool-down, a failure opens the circuit again
+	now = now.Add(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, b.State())
+	require.True(t, b.allow())
+	assert.False(t, b.allow())
+	b.record(failure)
+	assert.Equal(t, CircuitOpen, b.State())
+
+	// canceled trials free their slot, a successful trial closes the circuit
+	now = now.Add(time.Minute)
+	require.True(t, b.allow())
+	b.record(context.Canceled)
+	require.True(t, b.allow())
+	b.record(nil)
+	assert.Equal(t, CircuitClosed, b.State())
+	assert.True(t, b.allow())
+}
+
+func TestCircuitBreakerRelease(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	state := newProviderState(&llms.Provider{Name: "test"}, &CircuitBreakerConfig{FailureThreshold: 1, CoolDown: time.Minute, HalfOpenRequests: 1})
+	state.breaker.now = func() time.Time { return now }
+	state.breaker.record(&llms.StatusError{StatusCode: http.StatusServiceUnavailable})
+	now = now.Add(time.Minute)
+
+	// a trial request whose final response never came frees its slot
+	require.True(t, state.allow())
+	_, done := state.wrap(func(resp llms.StreamingChatCompletionResponse) {})
+	done()
+	assert.Equal(t, CircuitHalfOpen, state.breaker.State())
+	require.True(t, state.allow())
+
+	// the outcome of a finished request is recorded once
+	streamingFunc, done := state.wrap(func(resp llms.StreamingChatCompletionResponse) {})
+	streamingFunc(llms.StreamingChatCompletionResponse{Response: &llms.ChatCompletionResponse{}})
+	streamingFunc(llms.StreamingChatCompletionResponse{Err: io.EOF})
+	done()
+	assert.Equal(t, CircuitClosed, state.breaker.State())
+	assert.Equal(t, int64(1), state.status(nil).Requests)
+}
+
+func TestCircuitBreakerFallback(t *testing.T) {
+	server, _ := newTestServer(t, llms.ChatCompletionMessage{Content: "from fallback"})
+	var brokenCalls atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenCalls.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(broken.Close)
+	p := New(
+		WithLLMProviders(
+			llms.Provider{Type: llms.ProviderTypeOpenAI, Name: "test-circuit-up", BaseURL: server.URL, APIKey: "test", Models: []llms.Model{{ID: "up-model"}}},
+			llms.Provider{Type: llms.ProviderTypeOpenAI, Name: "test-circuit-down", BaseURL: broken.URL, APIKey: "test", Models: []llms.Model{{ID: "down-model"}, {ID: "down-other"}}},
+		),
+		WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, CoolDown: time.Hour}),
+		WithFallbacks("down-model", "up-model"),
+	)
+
+	complete := func(model string, stream bool) (string, error) {
+		var content string
+		var err error
+		p.ChatCompletion(context.Background(), llms.ChatCompletionRequest{
+			Model:    model,
+			Stream:   stream,
+			Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "hi"}},
+		}, func(resp llms.StreamingChatCompletionResponse) {
+			if resp.Err != nil && resp.Err != io.EOF {
+				err = resp.Err
+			}
+			if resp.Response != nil && len(resp.Response.Choices) > 0 {
+				if choice := resp.Response.Choices[0]; choice.Message != nil {
+					content += choice.Message.Content
+				} else if choice.Delta != nil {
+					content += choice.Delta.Content
+				}
+			}
+		})
+		return content, err
+	}
+
+	for _, stream := range []bool{false, true, false, false} {
+		content, err := complete("down-model?tools=none", stream)
+		require.NoError(t, err)
+		assert.Equal(t, "from fallback", content)
+	}
+	// the circuit opened after two failures, the next requests were not sent to the failing provider
+	assert.Equal(t, int32(2), brokenCalls.Load())
+
+	// models without fallbacks fail fast while the circuit of their provider is open
+	_, err := complete("down-other", false)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), brokenCalls.Load())
+
+	circuits := make(map[string]CircuitState)
+	for _, status := range p.ProviderStatuses() {
+		circuits[status.Name] = status.Circuit
+	}
+	assert.Equal(t, CircuitOpen, circuits["test-circuit-down"])
+	assert.Equal(t, CircuitClosed, circuits["test-circuit-up"])
+}
+
+func TestCircuitBreakerRequestErrors(t *testing.T) {
+	assert.True(t, isProviderFailure(&llms.StatusError{StatusCode: http.StatusBadGateway}))
+	assert.True(t, isProviderFailure(&llms.StatusError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, isProviderFailure(fmt.Errorf("failed to send request: %w", context.DeadlineExceeded)))
+	assert.True(t, isProviderFailure(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.False(t, isProviderFailure(&llms.StatusError{StatusCode: http.StatusRequestEntityTooLarge}))
+	assert.False(t, isProviderFailure(errors.New("failed to marshal request")))
+
+	server, _ := newTestServer(t, llms.ChatCompletionMessage{Content: "from fallback"})
+	var calls atomic.Int32
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, `{"error": {"message": "invalid messages"}}`, http.StatusBadRequest)
+	}))
+	t.Cleanup(rejecting.Close)
+	p := New(
+		WithLLMProviders(
+			llms.Provider{Type: llms.ProviderTypeOpenAI, Name: "test-circuit-fallback", BaseURL: server.URL, APIKey: "test", Models: []llms.Model{{ID: "fallback-model"}}},
+			llms.Provider{Type: llms.ProviderTypeOpenAI, Name: "test-circuit-rejecting", BaseURL: rejecting.URL, APIKey: "test", Models: []llms.Model{{ID: "rejecting-model"}}},
+		),
+		WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, CoolDown: time.Hour}),
+		WithFallbacks("rejecting-model", "fallback-model"),
+	)
+
+	for range 5 {
+		var err error
+		p.ChatCompletion(context.Background(), llms.ChatCompletionRequest{
+			Model:    "rejecting-model",
+			Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "hi"}},
+		}, func(resp llms.StreamingChatCompletionResponse) {
+			if resp.Err != nil && resp.Err != io.EOF {
+				err = resp.Err
+			}
+		})
+		// 4xx responses are returned to the caller without falling back
+		var statusErr *llms.StatusError
+		require.True(t, errors.As(err, &statusErr))
+		assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	}
+	// the circuit stays closed, every request reached the provider
+	assert.Equal(t, int32(5), calls.Load())
+	for _, status := range p.ProviderStatuses() {
+		if status.Name == "test-circuit-rejecting" {
+			assert.Equal(t, CircuitClosed, status.Circuit)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/recally-io/polyllm"
 	"github.com/recally-io/polyllm/internal/cli"
@@ -37,10 +41,30 @@ func init() {
 func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  polyllm-cli models                  - List all available models")
+	fmt.Println("  polyllm-cli tools                   - List all available MCP tools")
+	fmt.Println("  polyllm-cli -m \"<model>\" chat      - Start an interactive chat")
 	fmt.Println("  polyllm-cli -m \"<model>\" -c \"<config-file>\" \"<prompt>\" - Chat with a model")
+	fmt.Println("  polyllm-cli sessions list|show|rm|export - Manage saved sessions")
+	fmt.Println("  polyllm-cli config check [-probe] [config-file] - Validate a config file")
+	fmt.Println("  polyllm-cli batch -i input.jsonl -o output.jsonl - Run an OpenAI batch file")
+	fmt.Println("  polyllm-cli compare -m \"<model1>,<model2>\" \"<prompt>\" - Compare models side by side")
+	fmt.Println("  polyllm-cli eval suite.yaml         - Run a prompt evaluation suite")
+	fmt.Println("\nFlags:")
+	flag.PrintDefaults()
 	fmt.Println("\nExamples:")
 	fmt.Println("  polyllm-cli models")
+	fmt.Println("  polyllm-cli -output json models")
+	fmt.Println("  polyllm-cli -m \"gpt-4o\" -output json \"Tell me a joke\" | jq .usage")
 	fmt.Println("  polyllm-cli -m \"gpt-4\" -c \"config.json\" \"Tell me a joke\"")
+	fmt.Println("  polyllm-cli -m \"gpt-4o\" chat")
+	fmt.Println("  polyllm-cli -m \"gpt-4o\" --session work \"Summarize our discussion\"")
+	fmt.Println("  polyllm-cli sessions export -format md work")
+	fmt.Println("  polyllm-cli config check -probe config.yaml")
+	fmt.Println("  polyllm-cli compare -m gpt-4o,deepseek-chat,qwen/qwen-max \"Explain monads\"")
+	fmt.Println("  polyllm-cli -c config.json batch -i prompts.jsonl -o results.jsonl -concurrency 8 -rpm 60 -resume")
+	fmt.Println("  polyllm-cli -c config.json eval -m mock/echo evals/smoke.yaml")
+	fmt.Println("  git diff | polyllm-cli -m \"gpt-4o\" \"review this\"")
+	fmt.Println("  polyllm-cli -m \"gpt-4o\" -s \"You are a code reviewer\" -f main.go -i screenshot.png \"explain\"")
 	fmt.Println("  polyllm-cli -m \"deepseek/deepseek-chat\" -c \"config.json\" \"What is the meaning of life?\"")
 }
 
@@ -48,8 +72,21 @@ func main() {
 	// Define command line flags
 	modelFlag := flag.String("m", "", "Model to use for chat")
 	configFlag := flag.String("c", "", "Path to the config file")
+	sessionFlag := flag.String("session", "", "Name of the session to resume and save the conversation to")
+	temperatureFlag := flag.Float64("temperature", 0, "Sampling temperature")
+	maxTokensFlag := flag.Int("max-tokens", 0, "Maximum number of tokens to generate")
+	systemFlag := flag.String("s", "", "System prompt")
+	var filesFlag, imagesFlag stringSliceFlag
+	flag.Var(&filesFlag, "f", "Path of a text file to attach as context, can be repeated")
+	flag.Var(&imagesFlag, "i", "Path or URL of an image to attach, can be repeated")
+	outputFlag := flag.String("output", string(cli.OutputText), "Output format: text, json, jsonl or raw")
 	flag.Parse()
 
+	output, err := cli.ParseOutputFormat(*outputFlag)
+	if err != nil {
+		exitWithError(err)
+	}
+
 	// Get remaining arguments
 	args := flag.Args()
 
@@ -59,43 +96,320 @@ func main() {
 		// Set the config file if provided
 		cfg, err := polyllm.LoadConfig(*configFlag)
 		if err != nil {
-			fmt.Printf("Error loading config file: %v\n", err)
-			os.Exit(1)
+			exitWithError(fmt.Errorf("failed to load config file: %w", err))
 		}
 		config = cfg
 	}
 
-	service := cli.NewLLMService(polyllm.NewFromConfig(config))
+	// Check if the command does not need llm providers
+	if len(args) > 0 {
+		switch args[0] {
+		case "help":
+			printUsage()
+			return
+		case "sessions":
+			runSessionsCommand(cli.NewLLMService(nil), args[1:])
+			return
+		case "config":
+			runConfigCommand(cli.NewLLMService(nil, cli.WithOutputFormat(output)), config, args[1:])
+			return
+		}
+	}
+
+	service := cli.NewLLMService(polyllm.NewFromConfig(config), cli.WithOutputFormat(output))
+
+	session := cli.NewSession("", *modelFlag)
+	if *sessionFlag != "" {
+		session, err = service.LoadSession(*sessionFlag, *modelFlag)
+		if err != nil {
+			exitWithError(fmt.Errorf("failed to load session: %w", err))
+		}
+	}
+	if *temperatureFlag != 0 {
+		session.Options.Temperature = float32(*temperatureFlag)
+	}
+	if *maxTokensFlag != 0 {
+		session.Options.MaxTokens = *maxTokensFlag
+	}
+	if *systemFlag != "" {
+		session.System = *systemFlag
+	}
 
 	// Check if the command is "models"
 	if len(args) > 0 {
 		switch args[0] {
 		case "models":
-			service.ListModels()
-			return
-		case "help":
-			printUsage()
+			if err := service.ListModels(); err != nil {
+				exitWithError(err)
+			}
 			return
 		case "tools":
-			service.ListMCPTools()
+			if err := service.ListMCPTools(); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "batch":
+			runBatchCommand(service, args[1:])
+			return
+		case "compare":
+			fs := flag.NewFlagSet("compare", flag.ExitOnError)
+			modelsFlag := fs.String("m", "", "Comma separated list of models to compare")
+			fs.Parse(args[1:])
+			models := splitList(*modelsFlag)
+			if len(models) == 0 {
+				exitWithError(fmt.Errorf("no models to compare, use compare -m model1,model2 \"<prompt>\""))
+			}
+			input := readInput(fs.Args(), filesFlag, imagesFlag)
+			results, err := service.Compare(context.Background(), models, session, input)
+			if err != nil {
+				exitWithError(err)
+			}
+			for _, result := range results {
+				if result.Error != "" {
+					os.Exit(1)
+				}
+			}
+			return
+		case "eval":
+			runEvalCommand(service, args[1:])
+			return
+		case "chat":
+			if output == cli.OutputJSON || output == cli.OutputJSONL {
+				exitWithError(fmt.Errorf("chat mode supports only text and raw output"))
+			}
+			service.Chat(session)
 			return
 		}
 	}
 
 	// Check if we need to chat with a model
-	if *modelFlag != "" {
-		// Join remaining arguments as the prompt
-		prompt := strings.Join(args, " ")
-		if prompt == "" {
-			fmt.Println("Error: No prompt provided")
-			os.Exit(1)
-		}
+	if session.Model != "" {
+		// Join remaining arguments as the prompt, piped stdin is added as context
+		input := readInput(args, filesFlag, imagesFlag)
 
 		// Chat with the model
-		service.ChatCompletion(*modelFlag, prompt)
+		if err := service.ChatCompletion(session, input); err != nil {
+			exitWithError(err)
+		}
 		return
 	}
 
 	// If no valid command is provided, print usage
 	printUsage()
 }
+
+// runSessionsCommand runs the sessions subcommands
+func runSessionsCommand(service *cli.LLMService, args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: polyllm-cli sessions list|show|rm|export")
+		os.Exit(1)
+	}
+
+	var err error
+	switch args[0] {
+	case "list", "ls":
+		service.ListSessions()
+	case "show":
+		if len(args) != 2 {
+			fmt.Println("Usage: polyllm-cli sessions show <name>")
+			os.Exit(1)
+		}
+		err = service.ShowSession(args[1])
+	case "rm", "remove":
+		if len(args) < 2 {
+			fmt.Println("Usage: polyllm-cli sessions rm <name>...")
+			os.Exit(1)
+		}
+		for _, name := range args[1:] {
+			if err = service.RemoveSession(name); err != nil {
+				break
+			}
+		}
+	case "export":
+		fs := flag.NewFlagSet("sessions export", flag.ExitOnError)
+		formatFlag := fs.String("format", cli.ExportFormatMarkdown, "Export format: md or jsonl")
+		outputFlag := fs.String("o", "", "Output file, defaults to stdout")
+		fs.Parse(args[1:])
+		if fs.NArg() == 0 {
+			fmt.Println("Usage: polyllm-cli sessions export [-format md|jsonl] [-o file] <name>...")
+			os.Exit(1)
+		}
+
+		out := os.Stdout
+		if *outputFlag != "" {
+			out, err = os.Create(*outputFlag)
+			if err != nil {
+				break
+			}
+			defer out.Close()
+		}
+		err = service.ExportSessions(out, *formatFlag, fs.Args()...)
+	default:
+		fmt.Printf("Unknown sessions command: %s\n", args[0])
+		os.Exit(1)
+	}
+
+	if err != nil {
+		exitWithError(err)
+	}
+}
+
+// runConfigCommand runs the config subcommands, config is the config loaded from the -c flag
+func runConfigCommand(service *cli.LLMService, config polyllm.Config, args []string) {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Println("Usage: polyllm-cli config check [-probe] [config-file]")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	probeFlag := fs.Bool("probe", false, "List the models of each provider and initialize each MCP server")
+	fs.Parse(args[1:])
+	if fs.NArg() > 0 {
+		cfg, err := polyllm.LoadConfig(fs.Arg(0))
+		if err != nil {
+			exitWithError(fmt.Errorf("failed to load config file: %w", err))
+		}
+		config = cfg
+	}
+
+	check, err := service.CheckConfig(context.Background(), config, *probeFlag)
+	if err != nil {
+		exitWithError(err)
+	}
+	if !check.OK() {
+		os.Exit(1)
+	}
+}
+
+// runBatchCommand runs the batch subcommand
+func runBatchCommand(service *cli.LLMService, args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	inputFlag := fs.String("i", "", "Path of the OpenAI batch format JSONL input file")
+	outputFlag := fs.String("o", "", "Path of the JSONL output file")
+	concurrencyFlag := fs.Int("concurrency", 4, "Maximum number of requests in flight")
+	rpmFlag := fs.Int("rpm", 0, "Requests per minute limit for every provider, 0 means unlimited")
+	var rateFlags stringSliceFlag
+	fs.Var(&rateFlags, "rate", "Requests per minute limit of a provider as <provider>=<rpm>, can be repeated")
+	resumeFlag := fs.Bool("resume", false, "Skip requests that already have a successful result in the output file")
+	fs.Parse(args)
+
+	if *inputFlag == "" || *outputFlag == "" {
+		fmt.Println("Usage: polyllm-cli batch -i input.jsonl -o output.jsonl [-concurrency n] [-rpm n] [-rate provider=rpm] [-resume]")
+		os.Exit(1)
+	}
+
+	providerRPM := make(map[string]int)
+	for _, rate := range rateFlags {
+		name, value, ok := strings.Cut(rate, "=")
+		rpm, err := strconv.Atoi(value)
+		if !ok || err != nil {
+			exitWithError(fmt.Errorf("invalid rate %q, expected <provider>=<rpm>", rate))
+		}
+		providerRPM[name] = rpm
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	summary, err := service.Batch(ctx, cli.BatchOptions{
+		Input:                     *inputFlag,
+		Output:                    *outputFlag,
+		Concurrency:               *concurrencyFlag,
+		RequestsPerMinute:         *rpmFlag,
+		ProviderRequestsPerMinute: providerRPM,
+		Resume:                    *resumeFlag,
+	})
+	cost := ""
+	if summary.Usage.Cost != nil {
+		cost = fmt.Sprintf(", cost: $%.6f", *summary.Usage.Cost)
+	}
+	fmt.Fprintf(os.Stderr, "total: %d, skipped: %d, succeeded: %d, failed: %d, tokens: %d%s\n",
+		summary.Total, summary.Skipped, summary.Succeeded, summary.Failed, summary.Usage.TotalTokens, cost)
+	if err != nil {
+		exitWithError(err)
+	}
+	if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runEvalCommand runs the eval subcommand, it exits with 1 when any case fails
+func runEvalCommand(service *cli.LLMService, args []string) {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	modelsFlag := fs.String("m", "", "Comma separated list of models overriding the suite models")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: polyllm-cli eval [-m model1,model2] <suite.yaml>")
+		os.Exit(1)
+	}
+
+	suite, err := cli.LoadEvalSuite(fs.Arg(0))
+	if err != nil {
+		exitWithError(err)
+	}
+	if models := splitList(*modelsFlag); len(models) > 0 {
+		for i := range suite.Cases {
+			suite.Cases[i].Models = models
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := service.Eval(ctx, suite)
+	if err != nil {
+		exitWithError(err)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// readInput builds the user input from the prompt arguments, piped stdin and attachments
+func readInput(args []string, files, images []string) cli.Input {
+	input := cli.Input{
+		Prompt: strings.Join(args, " "),
+		Files:  files,
+		Images: images,
+	}
+	if cli.StdinIsPiped() {
+		stdin, err := cli.ReadStdin()
+		if err != nil {
+			exitWithError(err)
+		}
+		input.Stdin = stdin
+	}
+	if input.Empty() && len(input.Images) == 0 {
+		exitWithError(fmt.Errorf("no prompt provided"))
+	}
+	return input
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// exitWithError prints the error to stderr and exits with a non-zero code
+func exitWithError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(1)
+}
+
+// stringSliceFlag is a flag that can be repeated
+type stringSliceFlag []string
+
+func (f *stringSliceFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringSliceFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
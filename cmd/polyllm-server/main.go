@@ -15,6 +15,7 @@ func main() {
 	flag.Parse()
 
 	config := polyllm.Config{}
+	serverConfig := server.Config{}
 	if *configFlag != "" {
 		// Set the config file if provided
 		cfg, err := polyllm.LoadConfig(*configFlag)
@@ -23,7 +24,12 @@ func main() {
 			os.Exit(1)
 		}
 		config = cfg
+		serverConfig, err = server.LoadConfig(*configFlag)
+		if err != nil {
+			fmt.Printf("Error loading config file: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	server.StartServer(config)
+	server.StartServer(*configFlag, config, serverConfig)
 }
@@ -0,0 +1,195 @@
+package polyllm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// interpolation matches ${VAR}, ${VAR:-default} and ${file:path} references, $${ escapes them.
+var interpolation = regexp.MustCompile(`\$\$\{|\$\{file:([^}]+)\}|\$\{([^}:]+)(:-([^}]*))?\}`)
+
+// ReadConfigFile reads a config file into v, which is decoded with its JSON field names.
+// The format is JSON, YAML (.yaml, .yml) or TOML (.toml) by the file extension.
+//
+// The files listed in the top level "include" field, relative to the including file, are read first:
+// their maps are merged and their lists, e.g. the llms, are concatenated, the including file overriding other values.
+// In string values, ${VAR} is replaced by the VAR env var, ${VAR:-default} by default when VAR is unset or empty,
+// ${file:path} by the trimmed content of the file, e.g. a secret, relative to the file containing the reference,
+// and $${ by a literal ${.
+func ReadConfigFile(path string, v any) error {
+	config, err := readConfigFile(path, nil)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to load config file %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to load config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// readConfigFile decodes and interpolates a config file and merges it over its includes, seen are the files being read.
+func readConfigFile(path string, seen []string) (map[string]any, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	for _, p := range seen {
+		if p == absPath {
+			return nil, fmt.Errorf("config file %s includes itself", path)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	config := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &config)
+	case ".toml":
+		// arrays of tables are decoded as []map[string]any, convert them through JSON
+		var tomlConfig map[string]any
+		if err = toml.Unmarshal(data, &tomlConfig); err == nil {
+			data, err = json.Marshal(tomlConfig)
+		}
+		if err == nil {
+			err = decodeJSONConfig(data, &config)
+		}
+	default:
+		err = decodeJSONConfig(data, &config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file %s: %w", path, err)
+	}
+
+	var includes []string
+	switch include := config["include"].(type) {
+	case nil:
+	case string:
+		includes = []string{include}
+	case []any:
+		for _, item := range include {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid include in config file %s: %v is not a path", path, item)
+			}
+			includes = append(includes, s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid include in config file %s: use a path or a list of paths", path)
+	}
+	delete(config, "include")
+	// interpolate before merging, so that file references are relative to the file containing them
+	if _, err := interpolate(config, filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("failed to load config file %s: %w", path, err)
+	}
+
+	merged := map[string]any{}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		included, err := readConfigFile(include, append(seen, absPath))
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeConfig(merged, included).(map[string]any)
+	}
+	return mergeConfig(merged, config).(map[string]any), nil
+}
+
+// decodeJSONConfig decodes JSON keeping numbers as they are written, e.g. large durations in nanoseconds.
+func decodeJSONConfig(data []byte, config *map[string]any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(config)
+}
+
+// mergeConfig merges src into dst: maps are merged, lists are concatenated and other values replaced.
+func mergeConfig(dst, src any) any {
+	switch src := src.(type) {
+	case map[string]any:
+		dstMap, ok := dst.(map[string]any)
+		if !ok {
+			return src
+		}
+		for key, value := range src {
+			dstMap[key] = mergeConfig(dstMap[key], value)
+		}
+		return dstMap
+	case []any:
+		if dstList, ok := dst.([]any); ok {
+			return append(dstList, src...)
+		}
+	}
+	return src
+}
+
+// interpolate replaces the env var and file references of the string values of a decoded config,
+// relative file references are resolved in dir.
+func interpolate(value any, dir string) (any, error) {
+	switch value := value.(type) {
+	case string:
+		return interpolateString(value, dir)
+	case map[string]any:
+		for key, item := range value {
+			interpolated, err := interpolate(item, dir)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			value[key] = interpolated
+		}
+	case []any:
+		for i, item := range value {
+			interpolated, err := interpolate(item, dir)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			value[i] = interpolated
+		}
+	}
+	return value, nil
+}
+
+func interpolateString(s, dir string) (string, error) {
+	var err error
+	result := interpolation.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		groups := interpolation.FindStringSubmatch(match)
+		if path := groups[1]; path != "" {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			data, readErr := os.ReadFile(path)
+			if readErr != nil {
+				err = fmt.Errorf("failed to read referenced file: %w", readErr)
+				return ""
+			}
+			return strings.TrimSpace(string(data))
+		}
+		if value := os.Getenv(groups[2]); value != "" {
+			return value
+		}
+		// unset variables are empty, Config.Validate reports the settings they leave missing
+		if groups[3] == "" {
+			slog.Warn("env var referenced by the config is not set", "var", groups[2])
+		}
+		return groups[4]
+	})
+	return result, err
+}
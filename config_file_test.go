@@ -0,0 +1,156 @@
+package polyllm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/mcps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return dir
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	t.Setenv("TEST_OPENAI_KEY", "sk-test")
+	dir := writeConfigFiles(t, map[string]string{
+		"config.json": `{
+  "llms": [{"name": "openai", "type": "openai", "api_key": "${TEST_OPENAI_KEY}", "timeout": 30000000000}],
+  "mcps": {"fetch": {"command": "uvx", "args": ["mcp-server-fetch"]}}
+}`,
+		"config.yaml": `
+llms:
+  - name: openai
+    type: openai
+    api_key: ${TEST_OPENAI_KEY}
+    timeout: 30000000000
+mcps:
+  fetch:
+    command: uvx
+    args: [mcp-server-fetch]
+`,
+		"config.toml": `
+[[llms]]
+name = "openai"
+type = "openai"
+api_key = "${TEST_OPENAI_KEY}"
+timeout = 30000000000
+
+[mcps.fetch]
+command = "uvx"
+args = ["mcp-server-fetch"]
+`,
+	})
+
+	for _, name := range []string{"config.json", "config.yaml", "config.toml"} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := LoadConfig(filepath.Join(dir, name))
+			require.NoError(t, err)
+			assert.Equal(t, []llms.Provider{{Name: "openai", Type: llms.ProviderTypeOpenAI, APIKey: "sk-test", HttpTimeout: 30 * time.Second}}, cfg.LLMProvides)
+			assert.Equal(t, map[string]mcps.Provider{"fetch": {Command: "uvx", Args: []string{"mcp-server-fetch"}}}, cfg.MCPProviders)
+		})
+	}
+}
+
+func TestLoadConfigInterpolation(t *testing.T) {
+	t.Setenv("TEST_MCP_TOKEN", "token")
+	t.Setenv("TEST_EMPTY", "")
+	dir := writeConfigFiles(t, map[string]string{"secrets/openai": "sk-from-file\n"})
+	dir = writeConfigFiles(t, map[string]string{"config.yaml": `
+llms:
+  - name: openai
+    type: openai
+    api_key: ${file:` + filepath.Join(dir, "secrets/openai") + `}
+    base_url: ${TEST_BASE_URL:-https://api.openai.com/v1}
+    model_prefix: ${TEST_EMPTY:-openai}/
+mcps:
+  github:
+    command: docker
+    args: [run, -e, "GITHUB_TOKEN=${TEST_MCP_TOKEN}", "$${NOT_INTERPOLATED}"]
+    env:
+      GITHUB_TOKEN: ${TEST_MCP_TOKEN}
+`})
+
+	cfg, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	require.Len(t, cfg.LLMProvides, 1)
+	assert.Equal(t, "sk-from-file", cfg.LLMProvides[0].APIKey)
+	assert.Equal(t, "https://api.openai.com/v1", cfg.LLMProvides[0].BaseURL)
+	assert.Equal(t, "openai/", cfg.LLMProvides[0].ModelPrefix)
+	assert.Equal(t, []string{"run", "-e", "GITHUB_TOKEN=token", "${NOT_INTERPOLATED}"}, cfg.MCPProviders["github"].Args)
+	assert.Equal(t, map[string]string{"GITHUB_TOKEN": "token"}, cfg.MCPProviders["github"].Env)
+
+	dir = writeConfigFiles(t, map[string]string{"config.json": `{"llms": [{"name": "openai", "api_key": "${TEST_UNSET_KEY}"}]}`})
+	// unset env vars are empty, the missing API key is reported by the validation
+	cfg, err = LoadConfig(filepath.Join(dir, "config.json"))
+	require.NoError(t, err)
+	assert.Empty(t, cfg.LLMProvides[0].APIKey)
+	assert.ErrorContains(t, cfg.Validate(), "llms[0].api_key")
+}
+
+func TestLoadConfigRelativeFileReferences(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml":              "include: providers/openai.yaml\nllms: [{name: local, type: mock, api_key: \"${file:secrets/local}\"}]",
+		"secrets/local":            "local-key",
+		"providers/openai.yaml":    "llms: [{name: openai, type: openai, api_key: \"${file:secrets/openai}\"}]",
+		"providers/secrets/openai": "openai-key\n",
+	})
+	// references do not depend on the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	cfg, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	require.Len(t, cfg.LLMProvides, 2)
+	assert.Equal(t, "openai-key", cfg.LLMProvides[0].APIKey)
+	assert.Equal(t, "local-key", cfg.LLMProvides[1].APIKey)
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `
+include: [providers/openai.json, providers/others.toml]
+llms:
+  - name: local
+    type: mock
+truncation:
+  strategy: keep_last
+`,
+		"providers/openai.json": `{"llms": [{"name": "openai", "type": "openai"}], "truncation": {"strategy": "summarize", "summary_model": "gpt-4o-mini"}}`,
+		"providers/others.toml": `
+include = "groq.yaml"
+
+[[llms]]
+name = "deepseek"
+type = "deepseek"
+`,
+		"providers/groq.yaml": `llms: [{name: groq, type: groq}]`,
+		"loop.yaml":           `include: loop.yaml`,
+	})
+
+	cfg, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	var names []string
+	for _, provider := range cfg.LLMProvides {
+		names = append(names, provider.Name)
+	}
+	assert.Equal(t, []string{"openai", "groq", "deepseek", "local"}, names)
+	assert.Equal(t, &TruncationConfig{Strategy: TruncationKeepLast, SummaryModel: "gpt-4o-mini"}, cfg.Truncation)
+
+	_, err = LoadConfig(filepath.Join(dir, "loop.yaml"))
+	assert.ErrorContains(t, err, "includes itself")
+}
@@ -23,4 +23,13 @@ var (
 
 	// ErrUnsupportedOperation is returned when an operation is not supported
 	ErrUnsupportedOperation = errors.New("unsupported operation")
+
+	// ErrUnsupportedCapability is returned when a request uses a feature its model does not support
+	ErrUnsupportedCapability = errors.New("unsupported capability")
+
+	// ErrCircuitOpen is returned without calling a provider while its circuit breaker is open
+	ErrCircuitOpen = errors.New("circuit breaker open")
+
+	// ErrContextWindowExceeded is returned when a request does not fit the context window of its model
+	ErrContextWindowExceeded = errors.New("context window exceeded")
 )
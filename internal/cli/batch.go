@@ -0,0 +1,448 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/recally-io/polyllm"
+	"github.com/recally-io/polyllm/llms"
+)
+
+// BatchRequest is a line of an OpenAI batch input file.
+type BatchRequest struct {
+	CustomID string                     `json:"custom_id"`
+	Method   string                     `json:"method,omitempty"`
+	URL      string                     `json:"url,omitempty"`
+	Body     llms.ChatCompletionRequest `json:"body"`
+}
+
+// BatchResult is a line of an OpenAI batch output file.
+type BatchResult struct {
+	ID       string         `json:"id"`
+	CustomID string         `json:"custom_id"`
+	Response *BatchResponse `json:"response"`
+	Error    *BatchError    `json:"error"`
+}
+
+// BatchResponse is the response of a successful batch request.
+type BatchResponse struct {
+	StatusCode int                          `json:"status_code"`
+	RequestID  string                       `json:"request_id"`
+	Body       *llms.ChatCompletionResponse `json:"body"`
+}
+
+// BatchError is the error of a failed batch request.
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchOptions configures a batch run.
+type BatchOptions struct {
+	// Input is the path of the JSONL input file
+	Input string
+	// Output is the path of the JSONL output file
+	Output string
+	// Concurrency is the maximum number of requests in flight
+	Concurrency int
+	// RequestsPerMinute is the default rate limit for every provider, 0 means unlimited
+	RequestsPerMinute int
+	// ProviderRequestsPerMinute overrides the rate limit per provider name
+	ProviderRequestsPerMinute map[string]int
+	// Resume skips requests that already have a successful result in the output file
+	Resume bool
+}
+
+// BatchSummary summarizes a batch run.
+type BatchSummary struct {
+	Total     int
+	Skipped   int
+	Succeeded int
+	Failed    int
+	Usage     llms.Usage
+}
+
+// providerResolver resolves the provider serving a model, PolyLLM implements it.
+type providerResolver interface {
+	GetLLMByModel(model string) (polyllm.LLM, error)
+}
+
+// ReadBatchRequests reads and validates an OpenAI batch input file.
+func ReadBatchRequests(r io.Reader) ([]BatchRequest, error) {
+	requests := make([]BatchRequest, 0)
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 32*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req BatchRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			return nil, fmt.Errorf("line %d: invalid batch request: %w", lineNumber, err)
+		}
+		if req.CustomID == "" {
+			return nil, fmt.Errorf("line %d: custom_id is required", lineNumber)
+		}
+		if seen[req.CustomID] {
+			return nil, fmt.Errorf("line %d: duplicate custom_id %q", lineNumber, req.CustomID)
+		}
+		if req.Body.Model == "" {
+			return nil, fmt.Errorf("line %d: body.model is required", lineNumber)
+		}
+		seen[req.CustomID] = true
+		requests = append(requests, req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch input: %w", err)
+	}
+	return requests, nil
+}
+
+// readCompletedResults adds the successful results of a previous run to completed by custom id.
+func readCompletedResults(path string, completed map[string]BatchResult) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 32*1024*1024)
+	for scanner.Scan() {
+		var result BatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			// the last line may be truncated if the previous run was killed
+			continue
+		}
+		if result.Error == nil && result.Response != nil {
+			completed[result.CustomID] = result
+		}
+	}
+	return scanner.Err()
+}
+
+// batchOutput is the output file of a batch run.
+type batchOutput struct {
+	*os.File
+	// path is the path of the output, the file is written next to it when resuming
+	path string
+	// completed are the successful results of the previous runs by custom id
+	completed map[string]BatchResult
+}
+
+// openBatchOutput opens the output file. When resuming, it reads the successful results of the previous run,
+// including those of a resumed run that was killed, and writes to a file next to the output that replaces it
+// on commit, so that the previous results are merged with the new ones in input order.
+func openBatchOutput(path string, resume bool) (*batchOutput, error) {
+	out := &batchOutput{path: path, completed: make(map[string]BatchResult)}
+	if !resume {
+		file, err := os.Create(path)
+		out.File = file
+		return out, err
+	}
+
+	for _, previous := range []string{path, resumePath(path)} {
+		if err := readCompletedResults(previous, out.completed); err != nil {
+			return nil, fmt.Errorf("failed to read previous results: %w", err)
+		}
+	}
+	file, err := os.Create(resumePath(path))
+	out.File = file
+	return out, err
+}
+
+func resumePath(path string) string {
+	return path + ".resume.tmp"
+}
+
+// commit closes the file and replaces the output with it when resuming.
+func (o *batchOutput) commit() error {
+	if err := o.Close(); err != nil {
+		return err
+	}
+	if o.Name() == o.path {
+		return nil
+	}
+	return os.Rename(o.Name(), o.path)
+}
+
+// Batch runs the requests of an OpenAI batch input file and writes the results in input order.
+func (s *LLMService) Batch(ctx context.Context, opts BatchOptions) (BatchSummary, error) {
+	var summary BatchSummary
+
+	input, err := os.Open(opts.Input)
+	if err != nil {
+		return summary, fmt.Errorf("failed to open batch input: %w", err)
+	}
+	requests, err := ReadBatchRequests(input)
+	input.Close()
+	if err != nil {
+		return summary, err
+	}
+	summary.Total = len(requests)
+
+	output, err := openBatchOutput(opts.Output, opts.Resume)
+	if err != nil {
+		return summary, fmt.Errorf("failed to open batch output: %w", err)
+	}
+	defer output.Close()
+
+	// pending holds the indexes of the requests to run, the index is kept in the result id
+	pending := make([]int, 0, len(requests))
+	for idx, req := range requests {
+		if _, ok := output.completed[req.CustomID]; ok {
+			summary.Skipped++
+			continue
+		}
+		pending = append(pending, idx)
+	}
+
+	concurrency := max(opts.Concurrency, 1)
+	limiters := newProviderLimiters(opts.RequestsPerMinute, opts.ProviderRequestsPerMinute)
+
+	type indexedResult struct {
+		index  int
+		result BatchResult
+	}
+	jobs := make(chan int)
+	results := make(chan indexedResult)
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pos := range jobs {
+				idx := pending[pos]
+				req := requests[idx]
+				limiter := limiters.get(s.providerName(req.Body.Model))
+				if err := limiter.Wait(ctx); err != nil {
+					results <- indexedResult{index: idx, result: batchErrorResult(idx, req, err)}
+					continue
+				}
+				results <- indexedResult{index: idx, result: s.runBatchRequest(ctx, idx, req)}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for pos := range pending {
+			select {
+			case jobs <- pos:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	encoder := json.NewEncoder(output)
+	var writeErr error
+	encode := func(result BatchResult) {
+		if writeErr == nil {
+			writeErr = encoder.Encode(result)
+		}
+	}
+	writeResult := func(result BatchResult) {
+		// cancelled requests are not written so that a resumed run retries them
+		if result.Error != nil && result.Error.Code == "cancelled" {
+			return
+		}
+		if result.Error != nil {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+			summary.Usage.Add(result.Response.Body.Usage)
+		}
+		encode(result)
+		fmt.Fprintf(os.Stderr, "\rcompleted %d/%d, failed %d", summary.Skipped+summary.Succeeded+summary.Failed, summary.Total, summary.Failed)
+	}
+
+	// write results in input order with the results of the previous run, buffering the ones that finished early
+	buffered := make(map[int]BatchResult)
+	next := 0
+	for res := range results {
+		buffered[res.index] = res.result
+		for ; next < len(requests); next++ {
+			if result, ok := output.completed[requests[next].CustomID]; ok {
+				encode(result)
+			} else if result, ok := buffered[next]; ok {
+				delete(buffered, next)
+				writeResult(result)
+			} else {
+				break
+			}
+		}
+	}
+	// requests never started after a cancellation leave gaps, write what finished after them
+	for ; next < len(requests); next++ {
+		if result, ok := output.completed[requests[next].CustomID]; ok {
+			encode(result)
+		} else if result, ok := buffered[next]; ok {
+			writeResult(result)
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if writeErr != nil {
+		return summary, fmt.Errorf("failed to write batch output: %w", writeErr)
+	}
+	if err := output.commit(); err != nil {
+		return summary, fmt.Errorf("failed to write batch output: %w", err)
+	}
+	return summary, ctx.Err()
+}
+
+// runBatchRequest runs a single batch request without streaming.
+func (s *LLMService) runBatchRequest(ctx context.Context, idx int, req BatchRequest) BatchResult {
+	body := req.Body
+	body.Stream = false
+	body.StreamOptions = nil
+
+	var (
+		response *llms.ChatCompletionResponse
+		respErr  error
+	)
+	s.provider.ChatCompletion(ctx, body, func(resp llms.StreamingChatCompletionResponse) {
+		if resp.Err != nil && resp.Err != io.EOF {
+			respErr = resp.Err
+			return
+		}
+		if resp.Response != nil {
+			response = resp.Response
+		}
+	})
+
+	if respErr == nil && response == nil {
+		respErr = errors.New("no response generated")
+	}
+	if respErr != nil {
+		return batchErrorResult(idx, req, respErr)
+	}
+	return BatchResult{
+		ID:       fmt.Sprintf("batch_req_%d", idx),
+		CustomID: req.CustomID,
+		Response: &BatchResponse{
+			StatusCode: 200,
+			RequestID:  response.ID,
+			Body:       response,
+		},
+	}
+}
+
+func batchErrorResult(idx int, req BatchRequest, err error) BatchResult {
+	code := "request_failed"
+	if errors.Is(err, context.Canceled) {
+		code = "cancelled"
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		code = "timeout"
+	} else if errors.Is(err, polyllm.ErrProviderNotFound) {
+		code = "model_not_found"
+	}
+	return BatchResult{
+		ID:       fmt.Sprintf("batch_req_%d", idx),
+		CustomID: req.CustomID,
+		Error:    &BatchError{Code: code, Message: err.Error()},
+	}
+}
+
+// providerName returns the name of the provider serving the model, used as the rate limit key.
+func (s *LLMService) providerName(model string) string {
+	model, _, _ = strings.Cut(model, "?")
+	if resolver, ok := s.provider.(providerResolver); ok {
+		if llm, err := resolver.GetLLMByModel(model); err == nil {
+			return llm.GetProvider().Name
+		}
+	}
+	return model
+}
+
+// rateLimiter spaces requests evenly to stay under a requests per minute limit.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// Wait blocks until the next request is allowed or the context is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.interval == 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// providerLimiters holds a rate limiter per provider.
+type providerLimiters struct {
+	mu       sync.Mutex
+	rpm      int
+	override map[string]int
+	limiters map[string]*rateLimiter
+}
+
+func newProviderLimiters(rpm int, override map[string]int) *providerLimiters {
+	return &providerLimiters{
+		rpm:      rpm,
+		override: override,
+		limiters: make(map[string]*rateLimiter),
+	}
+}
+
+func (p *providerLimiters) get(provider string) *rateLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if limiter, ok := p.limiters[provider]; ok {
+		return limiter
+	}
+	rpm := p.rpm
+	if v, ok := p.override[provider]; ok {
+		rpm = v
+	}
+	limiter := &rateLimiter{}
+	if rpm > 0 {
+		limiter.interval = time.Minute / time.Duration(rpm)
+	}
+	p.limiters[provider] = limiter
+	return limiter
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider echoes the last user message, requests for the "fail" model return an error
+type fakeProvider struct {
+	calls atomic.Int32
+}
+
+func (p *fakeProvider) ListModels(ctx context.Context) ([]llms.Model, error) {
+	return []llms.Model{{ID: "echo"}, {ID: "fail"}}, nil
+}
+
+func (p *fakeProvider) ListMCPTools(ctx context.Context) ([]llms.Tool, error) {
+	return nil, nil
+}
+
+func (p *fakeProvider) ChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
+	n := p.calls.Add(1)
+	// finish out of order to exercise the ordered writer
+	time.Sleep(time.Duration(5-n%5) * time.Millisecond)
+	if req.Model == "fail" {
+		streamingFunc(llms.StreamingChatCompletionResponse{Err: errors.New("upstream error")})
+		return
+	}
+	content := req.Messages[len(req.Messages)-1].Content
+	streamingFunc(llms.StreamingChatCompletionResponse{
+		Response: &llms.ChatCompletionResponse{
+			ID:    fmt.Sprintf("resp-%d", n),
+			Model: req.Model,
+			Choices: []llms.ChatCompletionChoice{{
+				Message:      &llms.ChatCompletionMessage{Role: llms.ChatMessageRoleAssistant, Content: content},
+				FinishReason: llms.FinishReasonStop,
+			}},
+			Usage: llms.Usage{PromptTokens: 2, CompletionTokens: 1, TotalTokens: 3},
+		},
+		Err: io.EOF,
+	})
+}
+
+func writeBatchInput(t *testing.T, path string, models ...string) {
+	t.Helper()
+	var lines []string
+	for i, model := range models {
+		line, err := json.Marshal(BatchRequest{
+			CustomID: fmt.Sprintf("req-%d", i),
+			Method:   "POST",
+			URL:      "/v1/chat/completions",
+			Body: llms.ChatCompletionRequest{
+				Model:    model,
+				Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: fmt.Sprintf("prompt %d", i)}},
+			},
+		})
+		require.NoError(t, err)
+		lines = append(lines, string(line))
+	}
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+}
+
+func readBatchOutput(t *testing.T, path string) []BatchResult {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var results []BatchResult
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var result BatchResult
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &result))
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.jsonl")
+	output := filepath.Join(dir, "output.jsonl")
+	writeBatchInput(t, input, "echo", "echo", "fail", "echo", "echo", "echo")
+
+	provider := &fakeProvider{}
+	service := NewLLMService(provider)
+	summary, err := service.Batch(context.Background(), BatchOptions{Input: input, Output: output, Concurrency: 4})
+	require.NoError(t, err)
+	assert.Equal(t, BatchSummary{Total: 6, Succeeded: 5, Failed: 1, Usage: llms.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}}, summary)
+
+	results := readBatchOutput(t, output)
+	require.Len(t, results, 6)
+	for i, result := range results {
+		assert.Equal(t, fmt.Sprintf("req-%d", i), result.CustomID)
+		assert.Equal(t, fmt.Sprintf("batch_req_%d", i), result.ID)
+		if i == 2 {
+			require.NotNil(t, result.Error)
+			assert.Nil(t, result.Response)
+			continue
+		}
+		require.NotNil(t, result.Response)
+		assert.Equal(t, fmt.Sprintf("prompt %d", i), result.Response.Body.Choices[0].Message.Content)
+	}
+
+	// resuming only retries the failed request and merges its result with the previous ones in input order
+	provider.calls.Store(0)
+	summary, err = service.Batch(context.Background(), BatchOptions{Input: input, Output: output, Concurrency: 4, Resume: true})
+	require.NoError(t, err)
+	assert.Equal(t, 5, summary.Skipped)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, int32(1), provider.calls.Load())
+
+	results = readBatchOutput(t, output)
+	require.Len(t, results, 6)
+	for i, result := range results {
+		assert.Equal(t, fmt.Sprintf("req-%d", i), result.CustomID)
+		assert.Equal(t, fmt.Sprintf("batch_req_%d", i), result.ID)
+	}
+	assert.NotNil(t, results[2].Error)
+	assert.NoFileExists(t, output+".resume.tmp")
+}
+
+func TestReadBatchRequests(t *testing.T) {
+	_, err := ReadBatchRequests(strings.NewReader(`{"custom_id":"a","body":{"model":"m"}}` + "\n" + `{"custom_id":"a","body":{"model":"m"}}`))
+	assert.ErrorContains(t, err, "duplicate custom_id")
+
+	_, err = ReadBatchRequests(strings.NewReader(`{"body":{"model":"m"}}`))
+	assert.ErrorContains(t, err, "custom_id is required")
+
+	requests, err := ReadBatchRequests(strings.NewReader("\n" + `{"custom_id":"a","body":{"model":"m","messages":[{"role":"user","content":"hi"}]}}` + "\n"))
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "hi", requests[0].Body.Messages[0].Content)
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newProviderLimiters(0, map[string]int{"slow": 600}).get("slow")
+	start := time.Now()
+	for range 3 {
+		require.NoError(t, limiter.Wait(context.Background()))
+	}
+	// 600 rpm spaces requests by 100ms, the first one is immediate
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, limiter.Wait(ctx), context.Canceled)
+}
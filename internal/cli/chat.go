@@ -0,0 +1,334 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/logger"
+)
+
+// chatSession holds the state of an interactive chat.
+type chatSession struct {
+	*Session
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// interrupt cancels the in-flight request, it returns false if there is none.
+func (c *chatSession) interrupt() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel == nil {
+		return false
+	}
+	c.cancel()
+	return true
+}
+
+func (c *chatSession) setCancel(cancel context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancel = cancel
+}
+
+// Chat starts an interactive multi-turn chat reading user input from stdin.
+// Named sessions are saved to the session store after every turn.
+func (s *LLMService) Chat(session *Session) {
+	chat := &chatSession{Session: session}
+
+	// Ctrl-C cancels the in-flight request instead of killing the session
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+	go func() {
+		for range sigCh {
+			if !chat.interrupt() {
+				fmt.Printf("\n%s\n> ", s.paint(logger.ColorYellow, "(use /exit or Ctrl-D to quit)"))
+			}
+		}
+	}()
+
+	fmt.Println(s.paint(logger.ColorBlue, fmt.Sprintf("Chatting with %s. Type /help for commands.", displayModel(session.Model))))
+	if session.Name != "" && len(session.Messages) > 0 {
+		fmt.Println(s.paint(logger.ColorBlue, fmt.Sprintf("Resumed session %s with %d messages", session.Name, len(session.Messages))))
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			if exit := s.handleChatCommand(chat, line); exit {
+				return
+			}
+			continue
+		}
+
+		session.Messages = append(session.Messages, llms.ChatCompletionMessage{
+			Role:    llms.ChatMessageRoleUser,
+			Content: line,
+		})
+		s.chatTurn(chat)
+	}
+}
+
+// chatTurn sends the conversation to the model and appends the reply to the history.
+func (s *LLMService) chatTurn(chat *chatSession) {
+	if chat.Model == "" {
+		fmt.Println(s.paint(logger.ColorRed, "No model selected, use /model <name>"))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chat.setCancel(cancel)
+	defer func() {
+		chat.setCancel(nil)
+		cancel()
+	}()
+
+	req := chat.NewRequest()
+	req.Stream = true
+	req.StreamOptions = &llms.StreamOptions{IncludeUsage: true}
+
+	reply, usage, err := s.streamReply(ctx, req, func(chunk *llms.ChatCompletionResponse) {
+		fmt.Print(s.paint(logger.ColorCyan, deltaContent(chunk)))
+	})
+	fmt.Println()
+
+	if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+		fmt.Println(s.paint(logger.ColorYellow, "(interrupted)"))
+		if reply == "" {
+			return
+		}
+	} else if err != nil {
+		fmt.Println(s.paint(logger.ColorRed, fmt.Sprintf("Error: %v", err)))
+		return
+	}
+
+	chat.Messages = append(chat.Messages, llms.ChatCompletionMessage{
+		Role:    llms.ChatMessageRoleAssistant,
+		Content: reply,
+	})
+	chat.AddUsage(usage)
+	if usage.TotalTokens > 0 {
+		line := fmt.Sprintf("[tokens] prompt: %d, completion: %d, total: %d", usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+		if usage.Cost != nil {
+			line += ", cost: " + formatCost(*usage.Cost)
+		}
+		fmt.Println(s.paint(logger.ColorPurple, line))
+	}
+	s.saveSession(chat.Session)
+}
+
+// streamReply runs a chat completion, calling onChunk for every response chunk.
+// It returns the reply content and the usage summed over all model calls of the turn.
+func (s *LLMService) streamReply(ctx context.Context, req llms.ChatCompletionRequest, onChunk func(chunk *llms.ChatCompletionResponse)) (string, llms.Usage, error) {
+	var (
+		reply  strings.Builder
+		usage  llms.Usage
+		outErr error
+	)
+
+	s.provider.ChatCompletion(ctx, req, func(resp llms.StreamingChatCompletionResponse) {
+		if resp.Err != nil && resp.Err != io.EOF {
+			if outErr == nil {
+				outErr = resp.Err
+			}
+			return
+		}
+		if resp.Response == nil {
+			return
+		}
+
+		usage.Add(resp.Response.Usage)
+
+		if len(resp.Response.Choices) > 0 {
+			if message := resp.Response.Choices[0].Message; message != nil {
+				// non-streaming responses carry the whole reply
+				reply.Reset()
+				reply.WriteString(message.Content)
+			}
+		}
+		reply.WriteString(deltaContent(resp.Response))
+		onChunk(resp.Response)
+	})
+
+	if outErr == nil && ctx.Err() != nil {
+		outErr = ctx.Err()
+	}
+	return reply.String(), usage, outErr
+}
+
+// deltaContent returns the content delta of a streaming chunk.
+func deltaContent(chunk *llms.ChatCompletionResponse) string {
+	if len(chunk.Choices) == 0 || chunk.Choices[0].Delta == nil {
+		return ""
+	}
+	return chunk.Choices[0].Delta.Content
+}
+
+// handleChatCommand executes a slash command, it returns true when the chat should end.
+func (s *LLMService) handleChatCommand(chat *chatSession, line string) bool {
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch command {
+	case "/exit", "/quit":
+		return true
+	case "/help":
+		printChatHelp()
+	case "/model":
+		if arg == "" {
+			fmt.Printf("Current model: %s\n", displayModel(chat.Model))
+			return false
+		}
+		chat.Model = arg
+		fmt.Printf("Switched to model: %s\n", arg)
+		s.saveSession(chat.Session)
+	case "/system":
+		chat.System = arg
+		if arg == "" {
+			fmt.Println("System prompt cleared")
+		} else {
+			fmt.Println("System prompt set")
+		}
+		s.saveSession(chat.Session)
+	case "/clear":
+		chat.Messages = nil
+		fmt.Println("Conversation cleared")
+		s.saveSession(chat.Session)
+	case "/save":
+		if arg == "" {
+			fmt.Println("Usage: /save <file>")
+			return false
+		}
+		if err := saveChatMessages(arg, chat.RequestMessages()); err != nil {
+			fmt.Println(s.paint(logger.ColorRed, fmt.Sprintf("Failed to save conversation: %v", err)))
+			return false
+		}
+		fmt.Printf("Saved %d messages to %s\n", len(chat.Messages), arg)
+	case "/load":
+		if arg == "" {
+			fmt.Println("Usage: /load <file>")
+			return false
+		}
+		messages, err := loadChatMessages(arg)
+		if err != nil {
+			fmt.Println(s.paint(logger.ColorRed, fmt.Sprintf("Failed to load conversation: %v", err)))
+			return false
+		}
+		chat.System = ""
+		chat.Messages = nil
+		for _, msg := range messages {
+			if msg.Role == llms.ChatMessageRoleSystem && chat.System == "" && len(chat.Messages) == 0 {
+				chat.System = msg.Content
+				continue
+			}
+			chat.Messages = append(chat.Messages, msg)
+		}
+		fmt.Printf("Loaded %d messages from %s\n", len(chat.Messages), arg)
+		s.saveSession(chat.Session)
+	case "/tools":
+		s.handleToolsCommand(chat, arg)
+	case "/retry":
+		// drop the last assistant reply and resend the last user message
+		for len(chat.Messages) > 0 && chat.Messages[len(chat.Messages)-1].Role != llms.ChatMessageRoleUser {
+			chat.Messages = chat.Messages[:len(chat.Messages)-1]
+		}
+		if len(chat.Messages) == 0 {
+			fmt.Println("Nothing to retry")
+			return false
+		}
+		s.chatTurn(chat)
+	default:
+		fmt.Printf("Unknown command: %s, type /help for commands\n", command)
+	}
+	return false
+}
+
+// handleToolsCommand lists MCP tools or selects the MCP servers used by the chat.
+func (s *LLMService) handleToolsCommand(chat *chatSession, arg string) {
+	switch arg {
+	case "":
+		tools, err := s.provider.ListMCPTools(context.Background())
+		if err != nil {
+			fmt.Println(s.paint(logger.ColorRed, fmt.Sprintf("Failed to list MCP tools: %v", err)))
+			return
+		}
+		for _, tool := range tools {
+			fmt.Printf(" %s - %s\n", s.paint(logger.ColorCyan, tool.Function.Name), tool.Function.Description)
+		}
+		if chat.Options.MCP == "" {
+			fmt.Println("MCP tools are disabled, use /tools <server1,server2|all> to enable them")
+		} else {
+			fmt.Printf("Enabled MCP servers: %s\n", chat.Options.MCP)
+		}
+		return
+	case "off", "none":
+		chat.Options.MCP = ""
+		fmt.Println("MCP tools disabled")
+	default:
+		chat.Options.MCP = arg
+		fmt.Printf("Enabled MCP servers: %s\n", arg)
+	}
+	s.saveSession(chat.Session)
+}
+
+func saveChatMessages(path string, messages []llms.ChatCompletionMessage) error {
+	data, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func loadChatMessages(path string) ([]llms.ChatCompletionMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var messages []llms.ChatCompletionMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func displayModel(model string) string {
+	if model == "" {
+		return "<no model>"
+	}
+	return model
+}
+
+func printChatHelp() {
+	fmt.Println("Commands:")
+	fmt.Println("  /model [name]             - Show or switch the model")
+	fmt.Println("  /system [prompt]          - Set the system prompt, empty to clear it")
+	fmt.Println("  /clear                    - Clear the conversation history")
+	fmt.Println("  /save <file>              - Save the conversation to a JSON file")
+	fmt.Println("  /load <file>              - Load a conversation from a JSON file")
+	fmt.Println("  /tools [servers|all|off]  - List MCP tools or select the MCP servers to use")
+	fmt.Println("  /retry                    - Regenerate the last reply")
+	fmt.Println("  /exit                     - Quit, Ctrl-D also works")
+	fmt.Println("Press Ctrl-C to cancel a reply without leaving the chat.")
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newChatService(t *testing.T, provider *streamProvider) *LLMService {
+	t.Helper()
+	return NewLLMService(provider, WithColors(false), WithSessionStore(NewSessionStore(t.TempDir())))
+}
+
+func TestChat(t *testing.T) {
+	provider := newHelloProvider()
+	s := newChatService(t, provider)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() { os.Stdin = stdin })
+	_, err = w.WriteString("hi\n\n/system Be brief\nagain\n/exit\nnot sent\n")
+	require.NoError(t, err)
+	w.Close()
+
+	session := NewSession("work", "gpt-4o")
+	output := captureStdout(t, func() { s.Chat(session) })
+	assert.Contains(t, output, "> Hello!\n[tokens] prompt: 5, completion: 2, total: 7\n")
+
+	require.Len(t, provider.requests, 2)
+	assert.True(t, provider.requests[1].Stream)
+	assert.Equal(t, []llms.ChatCompletionMessage{
+		{Role: llms.ChatMessageRoleSystem, Content: "Be brief"},
+		{Role: llms.ChatMessageRoleUser, Content: "hi"},
+		{Role: llms.ChatMessageRoleAssistant, Content: "Hello!"},
+		{Role: llms.ChatMessageRoleUser, Content: "again"},
+	}, provider.requests[1].Messages)
+	assert.Equal(t, llms.Usage{PromptTokens: 10, CompletionTokens: 4, TotalTokens: 14}, session.Usage)
+
+	// named sessions are saved after every turn
+	saved, err := s.sessions.Load("work")
+	require.NoError(t, err)
+	assert.Len(t, saved.Messages, 4)
+}
+
+func TestChatLoadAndSave(t *testing.T) {
+	s := newChatService(t, newHelloProvider())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "conversation.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+  {"role": "system", "content": "You are a reviewer"},
+  {"role": "user", "content": "review this"},
+  {"role": "assistant", "content": "looks good"},
+  {"role": "system", "content": "Be strict"}
+]`), 0o644))
+
+	chat := &chatSession{Session: NewSession("", "gpt-4o")}
+	chat.System = "previous"
+	chat.Messages = []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "previous"}}
+	output := captureStdout(t, func() { s.handleChatCommand(chat, "/load "+path) })
+	assert.Equal(t, "Loaded 3 messages from "+path+"\n", output)
+	// only a leading system message becomes the system prompt
+	assert.Equal(t, "You are a reviewer", chat.System)
+	assert.Equal(t, []llms.ChatCompletionMessage{
+		{Role: llms.ChatMessageRoleUser, Content: "review this"},
+		{Role: llms.ChatMessageRoleAssistant, Content: "looks good"},
+		{Role: llms.ChatMessageRoleSystem, Content: "Be strict"},
+	}, chat.Messages)
+
+	saved := filepath.Join(dir, "saved.json")
+	captureStdout(t, func() { s.handleChatCommand(chat, "/save "+saved) })
+	messages, err := loadChatMessages(saved)
+	require.NoError(t, err)
+	assert.Equal(t, chat.RequestMessages(), messages)
+
+	output = captureStdout(t, func() { s.handleChatCommand(chat, "/load "+filepath.Join(dir, "missing.json")) })
+	assert.Contains(t, output, "Failed to load conversation")
+	assert.Len(t, chat.Messages, 3)
+}
+
+func TestChatRetry(t *testing.T) {
+	provider := newHelloProvider()
+	s := newChatService(t, provider)
+	chat := &chatSession{Session: NewSession("", "gpt-4o")}
+
+	output := captureStdout(t, func() { s.handleChatCommand(chat, "/retry") })
+	assert.Equal(t, "Nothing to retry\n", output)
+	assert.Empty(t, provider.requests)
+
+	chat.Messages = []llms.ChatCompletionMessage{
+		{Role: llms.ChatMessageRoleUser, Content: "first"},
+		{Role: llms.ChatMessageRoleAssistant, Content: "first reply"},
+		{Role: llms.ChatMessageRoleUser, Content: "second"},
+		{Role: llms.ChatMessageRoleAssistant, Content: "", ToolCalls: []llms.ToolCall{{ID: "call-1"}}},
+		{Role: llms.ChatMessageRoleTool, Content: "result", ToolCallID: "call-1"},
+		{Role: llms.ChatMessageRoleAssistant, Content: "second reply"},
+	}
+	captureStdout(t, func() { s.handleChatCommand(chat, "/retry") })
+
+	// the replies after the last user message are dropped before resending
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, chat.Messages[:3], provider.requests[0].Messages)
+	assert.Equal(t, []llms.ChatCompletionMessage{
+		{Role: llms.ChatMessageRoleUser, Content: "first"},
+		{Role: llms.ChatMessageRoleAssistant, Content: "first reply"},
+		{Role: llms.ChatMessageRoleUser, Content: "second"},
+		{Role: llms.ChatMessageRoleAssistant, Content: "Hello!"},
+	}, chat.Messages)
+}
+
+func TestChatTools(t *testing.T) {
+	provider := newHelloProvider()
+	provider.tools = []llms.Tool{{Type: llms.ToolTypeFunction, Function: &llms.FunctionDefinition{Name: "fetch", Description: "Fetch a URL"}}}
+	s := newChatService(t, provider)
+	chat := &chatSession{Session: NewSession("", "gpt-4o")}
+
+	output := captureStdout(t, func() { s.handleChatCommand(chat, "/tools") })
+	assert.Equal(t, " fetch - Fetch a URL\nMCP tools are disabled, use /tools <server1,server2|all> to enable them\n", output)
+
+	captureStdout(t, func() { s.handleChatCommand(chat, "/tools fetch,github") })
+	assert.Equal(t, "fetch,github", chat.Options.MCP)
+	chat.Messages = []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "hi"}}
+	captureStdout(t, func() { s.chatTurn(chat) })
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, "gpt-4o?mcp=fetch,github", provider.requests[0].Model)
+
+	output = captureStdout(t, func() { s.handleChatCommand(chat, "/tools") })
+	assert.Contains(t, output, "Enabled MCP servers: fetch,github\n")
+	captureStdout(t, func() { s.handleChatCommand(chat, "/tools off") })
+	assert.Empty(t, chat.Options.MCP)
+}
+
+func TestStreamReplyUsage(t *testing.T) {
+	cost := func(v float64) *float64 { return &v }
+	// an agent loop turn streams the usage of every model call
+	provider := &streamProvider{chunks: []llms.ChatCompletionResponse{
+		{Choices: []llms.ChatCompletionChoice{{Delta: &llms.ChatCompletionMessage{Content: "Let me check. "}}}},
+		{Usage: llms.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Cost: cost(0.5)}},
+		{Choices: []llms.ChatCompletionChoice{{Delta: &llms.ChatCompletionMessage{Content: "Done."}}}},
+		{Usage: llms.Usage{PromptTokens: 20, CompletionTokens: 3, TotalTokens: 23}},
+		{Usage: llms.Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2, Cost: cost(0.25)}},
+	}}
+	s := newChatService(t, provider)
+
+	var chunks int
+	reply, usage, err := s.streamReply(context.Background(), llms.ChatCompletionRequest{Model: "gpt-4o", Stream: true}, func(chunk *llms.ChatCompletionResponse) {
+		chunks++
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Let me check. Done.", reply)
+	assert.Equal(t, 5, chunks)
+	assert.Equal(t, llms.Usage{PromptTokens: 31, CompletionTokens: 9, TotalTokens: 40, Cost: cost(0.75)}, usage)
+
+	// non-streaming responses carry the whole reply
+	reply, _, err = s.streamReply(context.Background(), llms.ChatCompletionRequest{Model: "gpt-4o"}, func(*llms.ChatCompletionResponse) {})
+	require.NoError(t, err)
+	assert.Empty(t, reply)
+	provider.response = llms.ChatCompletionResponse{Choices: []llms.ChatCompletionChoice{{Message: &llms.ChatCompletionMessage{Content: "whole"}}}}
+	reply, _, err = s.streamReply(context.Background(), llms.ChatCompletionRequest{Model: "gpt-4o"}, func(*llms.ChatCompletionResponse) {})
+	require.NoError(t, err)
+	assert.Equal(t, "whole", reply)
+
+	provider.err = assert.AnError
+	_, _, err = s.streamReply(context.Background(), llms.ChatCompletionRequest{Model: "gpt-4o", Stream: true}, func(*llms.ChatCompletionResponse) {})
+	assert.ErrorIs(t, err, assert.AnError)
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/logger"
+)
+
+// CompareResult is the outcome of a model in a comparison.
+type CompareResult struct {
+	Model   string `json:"model"`
+	Content string `json:"content"`
+	Error   string `json:"error,omitempty"`
+	// TimeToFirstToken is the latency until the first content token in milliseconds
+	TimeToFirstToken int64 `json:"time_to_first_token_ms"`
+	// Latency is the total latency in milliseconds
+	Latency int64      `json:"latency_ms"`
+	Usage   llms.Usage `json:"usage"`
+	// Cost is the estimated cost in USD, nil if the model has no known price
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+// CompareReport is the JSON output of a comparison.
+type CompareReport struct {
+	Messages []llms.ChatCompletionMessage `json:"messages"`
+	Results  []CompareResult              `json:"results"`
+}
+
+// costEstimator estimates the cost of a request, providers with a price catalog implement it.
+type costEstimator interface {
+	EstimateCost(model string, usage llms.Usage) (float64, bool)
+}
+
+// labelColors are the colors used to tell the models apart
+var labelColors = []string{logger.ColorCyan, logger.ColorGreen, logger.ColorYellow, logger.ColorPurple, logger.ColorBlue, logger.ColorRed}
+
+// Compare sends the same request to several models concurrently and prints the replies and a summary table.
+// In text and raw output every model streams its reply line by line prefixed with its label.
+func (s *LLMService) Compare(ctx context.Context, models []string, session *Session, input Input) ([]CompareResult, error) {
+	message, err := input.Message()
+	if err != nil {
+		return nil, err
+	}
+	session.Messages = append(session.Messages, message)
+	req := session.NewRequest()
+
+	width := 0
+	for _, model := range models {
+		width = max(width, len(model))
+	}
+
+	var mu sync.Mutex
+	results := make([]CompareResult, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			label := s.paint(labelColors[i%len(labelColors)], fmt.Sprintf("[%-*s]", width, model))
+			var out *labeledWriter
+			if !s.machineReadable() {
+				out = &labeledWriter{mu: &mu, w: os.Stdout, label: label}
+			}
+			results[i] = s.compareModel(ctx, req, model, out)
+		}()
+	}
+	wg.Wait()
+
+	switch s.output {
+	case OutputJSON:
+		return results, writeJSON(os.Stdout, CompareReport{Messages: req.Messages, Results: results})
+	case OutputJSONL:
+		return results, writeJSONLines(os.Stdout, results)
+	}
+
+	fmt.Println()
+	writeCompareTable(os.Stdout, results)
+	return results, nil
+}
+
+// compareModel runs the request on a model, streaming the reply to out when it is not nil.
+func (s *LLMService) compareModel(ctx context.Context, req llms.ChatCompletionRequest, model string, out *labeledWriter) CompareResult {
+	result := CompareResult{Model: model}
+	req.Model = model
+	req.Stream = true
+	req.StreamOptions = &llms.StreamOptions{IncludeUsage: true}
+
+	start := time.Now()
+	var firstToken time.Duration
+	content, usage, err := s.streamReply(ctx, req, func(chunk *llms.ChatCompletionResponse) {
+		delta := deltaContent(chunk)
+		if delta == "" {
+			return
+		}
+		if firstToken == 0 {
+			firstToken = time.Since(start)
+		}
+		if out != nil {
+			out.Write(delta)
+		}
+	})
+	result.Latency = time.Since(start).Milliseconds()
+	result.TimeToFirstToken = firstToken.Milliseconds()
+	result.Content = content
+	result.Usage = usage
+	if out != nil {
+		out.Flush()
+	}
+	if err != nil {
+		result.Error = err.Error()
+		if out != nil {
+			out.printLines(s.paint(logger.ColorRed, "Error: "+err.Error()))
+		}
+	}
+
+	if usage.Cost != nil {
+		result.Cost = usage.Cost
+	} else if estimator, ok := s.provider.(costEstimator); ok && usage.TotalTokens > 0 {
+		if cost, ok := estimator.EstimateCost(model, usage); ok {
+			result.Cost = &cost
+		}
+	}
+	return result
+}
+
+// writeCompareTable prints the latency, usage and cost of every model.
+func writeCompareTable(w io.Writer, results []CompareResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tFIRST TOKEN\tTOTAL\tPROMPT\tCOMPLETION\tTOTAL TOKENS\tCOST\tSTATUS")
+	for _, r := range results {
+		cost := "-"
+		if r.Cost != nil {
+			cost = formatCost(*r.Cost)
+		}
+		status := "ok"
+		if r.Error != "" {
+			status = "error"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			r.Model,
+			time.Duration(r.TimeToFirstToken)*time.Millisecond,
+			time.Duration(r.Latency)*time.Millisecond,
+			r.Usage.PromptTokens, r.Usage.CompletionTokens, r.Usage.TotalTokens,
+			cost, status)
+	}
+	tw.Flush()
+}
+
+// labeledWriter buffers streamed text and prints complete lines prefixed with a label,
+// so that concurrent streams do not interleave within a line.
+type labeledWriter struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	label string
+	buf   strings.Builder
+}
+
+func (l *labeledWriter) Write(text string) {
+	l.buf.WriteString(text)
+	pending := l.buf.String()
+	idx := strings.LastIndex(pending, "\n")
+	if idx < 0 {
+		return
+	}
+	l.printLines(pending[:idx])
+	l.buf.Reset()
+	l.buf.WriteString(pending[idx+1:])
+}
+
+// Flush prints the remaining partial line.
+func (l *labeledWriter) Flush() {
+	if l.buf.Len() > 0 {
+		l.printLines(l.buf.String())
+		l.buf.Reset()
+	}
+}
+
+func (l *labeledWriter) printLines(text string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(l.w, "%s %s\n", l.label, line)
+	}
+}
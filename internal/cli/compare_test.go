@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/recally-io/polyllm"
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCompareProvider() *polyllm.PolyLLM {
+	return polyllm.New(polyllm.WithLLMProviders(llms.Provider{
+		Name:        "test-compare",
+		Type:        llms.ProviderTypeMock,
+		ModelPrefix: "cmp/",
+		Models: []llms.Model{
+			{ID: "cmp/echo"},
+			{ID: "cmp/priced", Pricing: &llms.ModelPricing{Input: 2, Output: 4}},
+		},
+	}))
+}
+
+func TestCompare(t *testing.T) {
+	s := NewLLMService(newCompareProvider(), WithColors(false))
+	var results []CompareResult
+	var err error
+	output := captureStdout(t, func() {
+		results, err = s.Compare(context.Background(), []string{"cmp/echo", "cmp/priced", "cmp/missing"}, NewSession("", ""), Input{Prompt: "one two\nthree"})
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	for _, r := range results[:2] {
+		assert.Equal(t, "one two\nthree", r.Content)
+		assert.Empty(t, r.Error)
+		assert.Equal(t, []int{3, 3, 6}, []int{r.Usage.PromptTokens, r.Usage.CompletionTokens, r.Usage.TotalTokens})
+	}
+	assert.Nil(t, results[0].Cost)
+	require.NotNil(t, results[1].Cost)
+	assert.InDelta(t, 0.000018, *results[1].Cost, 1e-12)
+	assert.Contains(t, results[2].Error, polyllm.ErrProviderNotFound.Error())
+
+	// every model streams complete lines with its label, the table follows
+	lines := strings.Split(output, "\n")
+	for _, model := range []string{"cmp/echo   ", "cmp/priced "} {
+		label := "[" + model + "] "
+		var streamed []string
+		for _, line := range lines {
+			if strings.HasPrefix(line, label) {
+				streamed = append(streamed, strings.TrimPrefix(line, label))
+			}
+		}
+		assert.Equal(t, []string{"one two", "three"}, streamed, model)
+	}
+	assert.Contains(t, output, "[cmp/missing] Error: "+results[2].Error+"\n")
+
+	table := output[strings.Index(output, "MODEL"):]
+	tableLines := strings.Split(strings.TrimSpace(table), "\n")
+	require.Len(t, tableLines, 4)
+	assert.Regexp(t, `^MODEL\s+FIRST TOKEN\s+TOTAL\s+PROMPT\s+COMPLETION\s+TOTAL TOKENS\s+COST\s+STATUS$`, tableLines[0])
+	assert.Regexp(t, `^cmp/echo\s+\S+\s+\S+\s+3\s+3\s+6\s+-\s+ok$`, tableLines[1])
+	assert.Regexp(t, `^cmp/priced\s+\S+\s+\S+\s+3\s+3\s+6\s+\$0\.000018\s+ok$`, tableLines[2])
+	assert.Regexp(t, `^cmp/missing\s+0s\s+\S+\s+0\s+0\s+0\s+-\s+error$`, tableLines[3])
+}
+
+func TestCompareJSON(t *testing.T) {
+	s := NewLLMService(newCompareProvider(), WithOutputFormat(OutputJSONL))
+	output := captureStdout(t, func() {
+		_, err := s.Compare(context.Background(), []string{"cmp/echo", "cmp/missing"}, NewSession("", ""), Input{Prompt: "hello"})
+		require.NoError(t, err)
+	})
+	// machine readable output has no streamed lines
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"model":"cmp/echo","content":"hello"`)
+	assert.Contains(t, lines[1], `"model":"cmp/missing","content":"","error":`)
+}
+
+func TestLabeledWriter(t *testing.T) {
+	var mu sync.Mutex
+	var out strings.Builder
+	a := &labeledWriter{mu: &mu, w: &out, label: "[a]"}
+	b := &labeledWriter{mu: &mu, w: &out, label: "[b]"}
+
+	a.Write("hel")
+	b.Write("wor")
+	a.Write("lo\nsec")
+	b.Write("ld\n\nnext\nlast")
+	a.Write("ond")
+	a.Flush()
+	b.Flush()
+	b.Flush()
+
+	assert.Equal(t, "[a] hello\n[b] world\n[b] \n[b] next\n[a] second\n[b] last\n", out.String())
+}
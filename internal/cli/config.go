@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/recally-io/polyllm"
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/logger"
+	"github.com/recally-io/polyllm/mcps"
+)
+
+// probeTimeout limits how long a provider or an MCP server may take to answer a probe.
+const probeTimeout = 30 * time.Second
+
+// ConfigCheck is the result of checking a configuration.
+type ConfigCheck struct {
+	Issues []polyllm.ConfigIssue `json:"issues"`
+	Probes []ProbeResult         `json:"probes,omitempty"`
+}
+
+// OK reports whether the configuration has no issue and all probes succeeded.
+func (c ConfigCheck) OK() bool {
+	for _, probe := range c.Probes {
+		if probe.Error != "" {
+			return false
+		}
+	}
+	return len(c.Issues) == 0
+}
+
+// ProbeResult is the result of listing the models of a provider or initializing an MCP server.
+type ProbeResult struct {
+	// Kind is provider or mcp
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Models    int    `json:"models,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CheckConfig validates the configuration and, with probe, lists the models of each provider from its API
+// and initializes each MCP server.
+func (s *LLMService) CheckConfig(ctx context.Context, cfg polyllm.Config, probe bool) (ConfigCheck, error) {
+	check := ConfigCheck{Issues: []polyllm.ConfigIssue{}}
+	var validationErr *polyllm.ValidationError
+	if err := cfg.Validate(); errors.As(err, &validationErr) {
+		check.Issues = validationErr.Issues
+	} else if err != nil {
+		return check, err
+	}
+
+	if probe {
+		for _, provider := range cfg.LLMProvides {
+			check.Probes = append(check.Probes, probeProvider(ctx, provider))
+		}
+		for _, name := range slices.Sorted(maps.Keys(cfg.MCPProviders)) {
+			check.Probes = append(check.Probes, probeMCP(ctx, name, cfg.MCPProviders[name]))
+		}
+	}
+
+	switch s.output {
+	case OutputJSON:
+		return check, writeJSON(os.Stdout, check)
+	case OutputJSONL:
+		return check, json.NewEncoder(os.Stdout).Encode(check)
+	}
+
+	for _, issue := range check.Issues {
+		fmt.Printf("%s %s\n", s.paint(logger.ColorRed, "✗"), issue)
+	}
+	for _, probe := range check.Probes {
+		if probe.Error != "" {
+			fmt.Printf("%s %s %s: %s\n", s.paint(logger.ColorRed, "✗"), probe.Kind, probe.Name, probe.Error)
+		} else if probe.Kind == "provider" {
+			fmt.Printf("%s provider %s: %d models in %dms\n", s.paint(logger.ColorGreen, "✓"), probe.Name, probe.Models, probe.LatencyMS)
+		} else {
+			fmt.Printf("%s mcp %s: initialized in %dms\n", s.paint(logger.ColorGreen, "✓"), probe.Name, probe.LatencyMS)
+		}
+	}
+	if check.OK() {
+		fmt.Println("Configuration is valid")
+	}
+	return check, nil
+}
+
+// probeProvider lists the models of a provider from its API, ignoring the configured models.
+func probeProvider(ctx context.Context, provider llms.Provider) ProbeResult {
+	result := ProbeResult{Kind: "provider", Name: provider.Name}
+	provider.Load()
+	provider.Models = nil
+	provider.ModelAlias = nil
+
+	llm, err := polyllm.NewLLM(&provider)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	models, err := llm.ListModels(ctx)
+	result.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Models = len(models)
+	return result
+}
+
+// probeMCP starts and initializes an MCP server.
+func probeMCP(ctx context.Context, name string, provider mcps.Provider) ProbeResult {
+	result := ProbeResult{Kind: "mcp", Name: name}
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	clients, err := mcps.CreateMCPClientsWithContext(ctx, map[string]mcps.Provider{name: provider})
+	result.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, client := range clients {
+		client.Close()
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/recally-io/polyllm"
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/mcps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		if r.URL.Path != "/models" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			http.Error(w, `{"error": {"message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object": "list", "data": [{"id": "model-a", "object": "model"}, {"id": "model-b", "object": "model"}]}`))
+	}))
+	defer server.Close()
+
+	cfg := polyllm.Config{
+		LLMProvides: []llms.Provider{
+			{Name: "test-check-up", Type: llms.ProviderTypeOpenAICompatible, BaseURL: server.URL, APIKey: "sk-test",
+				Models: []llms.Model{{ID: "configured"}}},
+			{Name: "test-check-down", Type: llms.ProviderTypeOpenAICompatible, BaseURL: server.URL + "/missing", APIKey: "sk-test"},
+		},
+		MCPProviders: map[string]mcps.Provider{"broken": {}},
+	}
+	service := NewLLMService(nil, WithOutputFormat(OutputJSON))
+
+	check, err := service.CheckConfig(context.Background(), cfg, false)
+	require.NoError(t, err)
+	assert.Equal(t, []polyllm.ConfigIssue{{Path: "mcps.broken", Message: "the MCP server needs a command or a base_url"}}, check.Issues)
+	assert.Empty(t, check.Probes)
+	assert.False(t, check.OK())
+
+	delete(cfg.MCPProviders, "broken")
+	check, err = service.CheckConfig(context.Background(), cfg, true)
+	require.NoError(t, err)
+	assert.Empty(t, check.Issues)
+	require.Len(t, check.Probes, 2)
+	assert.Equal(t, "test-check-up", check.Probes[0].Name)
+	assert.Equal(t, 2, check.Probes[0].Models)
+	assert.Empty(t, check.Probes[0].Error)
+	assert.Positive(t, check.Probes[0].LatencyMS)
+	assert.Equal(t, "test-check-down", check.Probes[1].Name)
+	assert.NotEmpty(t, check.Probes[1].Error)
+	assert.False(t, check.OK())
+}
@@ -0,0 +1,438 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/recally-io/polyllm"
+	"github.com/recally-io/polyllm/jsonschema"
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// Assertion types supported by eval suites
+const (
+	AssertContains    = "contains"
+	AssertNotContains = "not_contains"
+	AssertRegex       = "regex"
+	AssertJSONSchema  = "json_schema"
+	AssertMaxLatency  = "max_latency"
+	AssertLLMJudge    = "llm_judge"
+)
+
+// EvalSuite is a set of prompts and the assertions their replies must satisfy.
+type EvalSuite struct {
+	Name string `json:"name"`
+	// Models are the default target models of the cases
+	Models []string `json:"models"`
+	// JudgeModel is the default model of llm_judge assertions
+	JudgeModel  string     `json:"judge_model,omitempty"`
+	System      string     `json:"system,omitempty"`
+	Temperature float32    `json:"temperature,omitempty"`
+	MaxTokens   int        `json:"max_tokens,omitempty"`
+	Cases       []EvalCase `json:"cases"`
+}
+
+// EvalCase is a single prompt of a suite.
+type EvalCase struct {
+	Name   string `json:"name"`
+	System string `json:"system,omitempty"`
+	Prompt string `json:"prompt,omitempty"`
+	// Messages is the conversation to send, the prompt is appended as the last user message
+	Messages []llms.ChatCompletionMessage `json:"messages,omitempty"`
+	// Models overrides the suite models for this case
+	Models []string        `json:"models,omitempty"`
+	Assert []EvalAssertion `json:"assert"`
+}
+
+// EvalAssertion is a check on the reply of a model.
+type EvalAssertion struct {
+	Type string `json:"type"`
+	// Value is the text for contains, the pattern for regex and the duration for max_latency,
+	// plain numbers are milliseconds
+	Value      any                    `json:"value,omitempty"`
+	IgnoreCase bool                   `json:"ignore_case,omitempty"`
+	Schema     *jsonschema.Definition `json:"schema,omitempty"`
+	// Criteria is what the judge model checks the reply against
+	Criteria string `json:"criteria,omitempty"`
+	// Model overrides the judge model of the suite
+	Model string `json:"model,omitempty"`
+}
+
+// EvalResult is the outcome of a case on a model.
+type EvalResult struct {
+	Case       string                `json:"case"`
+	Model      string                `json:"model"`
+	Passed     bool                  `json:"passed"`
+	Content    string                `json:"content"`
+	Error      string                `json:"error,omitempty"`
+	Latency    int64                 `json:"latency_ms"`
+	Usage      llms.Usage            `json:"usage"`
+	Assertions []EvalAssertionResult `json:"assertions"`
+}
+
+// EvalAssertionResult is the outcome of an assertion.
+type EvalAssertionResult struct {
+	Type    string `json:"type"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// EvalReport is the JSON output of an eval run.
+type EvalReport struct {
+	Suite   string       `json:"suite"`
+	Passed  int          `json:"passed"`
+	Failed  int          `json:"failed"`
+	Results []EvalResult `json:"results"`
+}
+
+// LoadEvalSuite reads a suite from a YAML or JSON file.
+func LoadEvalSuite(path string) (*EvalSuite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read eval suite: %w", err)
+	}
+	suite, err := ParseEvalSuite(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load eval suite %s: %w", path, err)
+	}
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return suite, nil
+}
+
+// ParseEvalSuite parses and validates a suite, JSON is accepted as it is a subset of YAML.
+func ParseEvalSuite(data []byte) (*EvalSuite, error) {
+	// decode YAML generically and map it through JSON, so that the suite
+	// reuses the json tags of the request and schema types
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var suite EvalSuite
+	if err := json.Unmarshal(jsonData, &suite); err != nil {
+		return nil, err
+	}
+	if err := suite.validate(); err != nil {
+		return nil, err
+	}
+	return &suite, nil
+}
+
+func (suite *EvalSuite) validate() error {
+	if len(suite.Cases) == 0 {
+		return errors.New("suite has no cases")
+	}
+	for i := range suite.Cases {
+		c := &suite.Cases[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case-%d", i+1)
+		}
+		if c.Prompt == "" && len(c.Messages) == 0 {
+			return fmt.Errorf("case %s: prompt or messages is required", c.Name)
+		}
+		if len(c.Models) == 0 {
+			c.Models = suite.Models
+		}
+		if len(c.Models) == 0 {
+			return fmt.Errorf("case %s: no models, set models on the suite or the case", c.Name)
+		}
+		for _, a := range c.Assert {
+			if err := a.validate(suite.JudgeModel); err != nil {
+				return fmt.Errorf("case %s: %w", c.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (a EvalAssertion) validate(judgeModel string) error {
+	switch a.Type {
+	case AssertContains, AssertNotContains:
+		if a.value() == "" {
+			return fmt.Errorf("%s assertion requires a value", a.Type)
+		}
+	case AssertRegex:
+		if _, err := a.regexp(); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	case AssertJSONSchema:
+		if a.Schema == nil {
+			return errors.New("json_schema assertion requires a schema")
+		}
+	case AssertMaxLatency:
+		if _, err := a.duration(); err != nil {
+			return err
+		}
+	case AssertLLMJudge:
+		if a.Criteria == "" {
+			return errors.New("llm_judge assertion requires criteria")
+		}
+		if a.Model == "" && judgeModel == "" {
+			return errors.New("llm_judge assertion requires a model or a suite judge_model")
+		}
+	default:
+		return fmt.Errorf("unknown assertion type: %q", a.Type)
+	}
+	return nil
+}
+
+func (a EvalAssertion) value() string {
+	if a.Value == nil {
+		return ""
+	}
+	return fmt.Sprint(a.Value)
+}
+
+func (a EvalAssertion) regexp() (*regexp.Regexp, error) {
+	pattern := a.value()
+	if a.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+func (a EvalAssertion) duration() (time.Duration, error) {
+	value := a.value()
+	if ms, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max_latency %q, use a duration like 2s or milliseconds", value)
+	}
+	return d, nil
+}
+
+// request builds the chat completion request of the case.
+func (c EvalCase) request(suite *EvalSuite, model string) llms.ChatCompletionRequest {
+	session := NewSession("", model)
+	session.System = suite.System
+	if c.System != "" {
+		session.System = c.System
+	}
+	session.Options.Temperature = suite.Temperature
+	session.Options.MaxTokens = suite.MaxTokens
+	session.Messages = append(session.Messages, c.Messages...)
+	if c.Prompt != "" {
+		session.Messages = append(session.Messages, llms.ChatCompletionMessage{
+			Role:    llms.ChatMessageRoleUser,
+			Content: c.Prompt,
+		})
+	}
+	return session.NewRequest()
+}
+
+// Eval runs every case of the suite on its models and prints a pass/fail report.
+// It returns the report, callers should fail when report.Failed is not zero.
+func (s *LLMService) Eval(ctx context.Context, suite *EvalSuite) (EvalReport, error) {
+	report := EvalReport{Suite: suite.Name, Results: make([]EvalResult, 0)}
+	for _, c := range suite.Cases {
+		for _, model := range c.Models {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			result := s.evalCase(ctx, suite, c, model)
+			if result.Passed {
+				report.Passed++
+			} else {
+				report.Failed++
+			}
+			report.Results = append(report.Results, result)
+
+			switch s.output {
+			case OutputJSONL:
+				if err := writeJSONLines(os.Stdout, []EvalResult{result}); err != nil {
+					return report, err
+				}
+			case OutputText, OutputRaw:
+				s.printEvalResult(os.Stdout, result)
+			}
+		}
+	}
+
+	switch s.output {
+	case OutputJSON:
+		return report, writeJSON(os.Stdout, report)
+	case OutputText, OutputRaw:
+		fmt.Println()
+		writeEvalTable(os.Stdout, report)
+	}
+	return report, nil
+}
+
+// evalCase runs a case on a model and checks its assertions.
+func (s *LLMService) evalCase(ctx context.Context, suite *EvalSuite, c EvalCase, model string) EvalResult {
+	result := EvalResult{Case: c.Name, Model: model, Assertions: make([]EvalAssertionResult, 0, len(c.Assert))}
+	req := c.request(suite, model)
+
+	start := time.Now()
+	content, usage, err := s.streamReply(ctx, req, func(*llms.ChatCompletionResponse) {})
+	latency := time.Since(start)
+	result.Latency = latency.Milliseconds()
+	result.Content = content
+	result.Usage = usage
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Passed = true
+	for _, a := range c.Assert {
+		ar := s.checkAssertion(ctx, suite, c, a, content, latency)
+		if !ar.Passed {
+			result.Passed = false
+		}
+		result.Assertions = append(result.Assertions, ar)
+	}
+	return result
+}
+
+func (s *LLMService) checkAssertion(ctx context.Context, suite *EvalSuite, c EvalCase, a EvalAssertion, content string, latency time.Duration) EvalAssertionResult {
+	ar := EvalAssertionResult{Type: a.Type}
+	switch a.Type {
+	case AssertContains, AssertNotContains:
+		haystack, needle := content, a.value()
+		if a.IgnoreCase {
+			haystack, needle = strings.ToLower(haystack), strings.ToLower(needle)
+		}
+		found := strings.Contains(haystack, needle)
+		ar.Passed = found == (a.Type == AssertContains)
+		if !ar.Passed && found {
+			ar.Message = fmt.Sprintf("reply contains %q", a.value())
+		} else if !ar.Passed {
+			ar.Message = fmt.Sprintf("reply does not contain %q", a.value())
+		}
+	case AssertRegex:
+		re, err := a.regexp()
+		if err != nil {
+			ar.Message = err.Error()
+			break
+		}
+		ar.Passed = re.MatchString(content)
+		if !ar.Passed {
+			ar.Message = fmt.Sprintf("reply does not match %q", a.value())
+		}
+	case AssertJSONSchema:
+		if err := jsonschema.ValidateJSON(*a.Schema, []byte(polyllm.TrimJSONFence(content))); err != nil {
+			ar.Message = err.Error()
+			break
+		}
+		ar.Passed = true
+	case AssertMaxLatency:
+		limit, err := a.duration()
+		if err != nil {
+			ar.Message = err.Error()
+			break
+		}
+		ar.Passed = latency <= limit
+		if !ar.Passed {
+			ar.Message = fmt.Sprintf("latency %s exceeds %s", latency.Round(time.Millisecond), limit)
+		}
+	case AssertLLMJudge:
+		judgeModel := a.Model
+		if judgeModel == "" {
+			judgeModel = suite.JudgeModel
+		}
+		passed, reason, err := s.judge(ctx, judgeModel, c, a.Criteria, content)
+		if err != nil {
+			ar.Message = fmt.Sprintf("judge %s failed: %v", judgeModel, err)
+			break
+		}
+		ar.Passed = passed
+		ar.Message = reason
+	default:
+		ar.Message = fmt.Sprintf("unknown assertion type: %q", a.Type)
+	}
+	return ar
+}
+
+const judgeSystemPrompt = `You are an impartial judge evaluating the reply of an AI assistant.
+Decide whether the reply satisfies the given criteria.
+Answer only with a JSON object: {"pass": true or false, "reason": "<one sentence>"}`
+
+// judge asks the judge model whether the reply meets the criteria.
+func (s *LLMService) judge(ctx context.Context, model string, c EvalCase, criteria, reply string) (bool, string, error) {
+	prompt := c.Prompt
+	if prompt == "" && len(c.Messages) > 0 {
+		prompt = messageText(c.Messages[len(c.Messages)-1])
+	}
+	req := llms.ChatCompletionRequest{
+		Model: model,
+		Messages: []llms.ChatCompletionMessage{
+			{Role: llms.ChatMessageRoleSystem, Content: judgeSystemPrompt},
+			{Role: llms.ChatMessageRoleUser, Content: fmt.Sprintf("Criteria:\n%s\n\nPrompt:\n%s\n\nReply:\n%s", criteria, prompt, reply)},
+		},
+	}
+	content, _, err := s.streamReply(ctx, req, func(*llms.ChatCompletionResponse) {})
+	if err != nil {
+		return false, "", err
+	}
+
+	var verdict struct {
+		Pass   bool   `json:"pass"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(polyllm.TrimJSONFence(content)), &verdict); err != nil {
+		return false, "", fmt.Errorf("invalid verdict %q: %w", content, err)
+	}
+	return verdict.Pass, verdict.Reason, nil
+}
+
+func (s *LLMService) printEvalResult(w io.Writer, result EvalResult) {
+	status := s.paint(logger.ColorGreen, "PASS")
+	if !result.Passed {
+		status = s.paint(logger.ColorRed, "FAIL")
+	}
+	fmt.Fprintf(w, "%s %s [%s] (%s)\n", status, result.Case, result.Model, time.Duration(result.Latency)*time.Millisecond)
+	if result.Error != "" {
+		fmt.Fprintf(w, "    error: %s\n", result.Error)
+	}
+	for _, a := range result.Assertions {
+		if !a.Passed {
+			fmt.Fprintf(w, "    %s: %s\n", a.Type, a.Message)
+		}
+	}
+}
+
+// writeEvalTable prints the number of passed cases per model.
+func writeEvalTable(w io.Writer, report EvalReport) {
+	type modelStats struct{ passed, failed int }
+	stats := make(map[string]*modelStats)
+	models := make([]string, 0)
+	for _, r := range report.Results {
+		if _, ok := stats[r.Model]; !ok {
+			stats[r.Model] = &modelStats{}
+			models = append(models, r.Model)
+		}
+		if r.Passed {
+			stats[r.Model].passed++
+		} else {
+			stats[r.Model].failed++
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tPASSED\tFAILED")
+	for _, model := range models {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", model, stats[model].passed, stats[model].failed)
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t%d\n", report.Passed, report.Failed)
+	tw.Flush()
+}
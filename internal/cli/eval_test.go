@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replyProvider replies with a fixed message per model
+type replyProvider map[string]string
+
+func (p replyProvider) ListModels(ctx context.Context) ([]llms.Model, error) {
+	return nil, nil
+}
+
+func (p replyProvider) ListMCPTools(ctx context.Context) ([]llms.Tool, error) {
+	return nil, nil
+}
+
+func (p replyProvider) ChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
+	streamingFunc(llms.StreamingChatCompletionResponse{
+		Response: &llms.ChatCompletionResponse{
+			Choices: []llms.ChatCompletionChoice{{
+				Message: &llms.ChatCompletionMessage{Role: llms.ChatMessageRoleAssistant, Content: p[req.Model]},
+			}},
+		},
+		Err: io.EOF,
+	})
+}
+
+const testEvalSuite = `
+name: smoke
+models: [good, bad]
+judge_model: judge
+cases:
+  - name: greeting
+    prompt: Say hello
+    assert:
+      - type: contains
+        value: HELLO
+        ignore_case: true
+      - type: regex
+        value: "^Hello"
+      - type: max_latency
+        value: 5s
+  - name: structured
+    prompt: Return a user as JSON
+    models: [good]
+    assert:
+      - type: json_schema
+        schema:
+          type: object
+          properties:
+            name: {type: string}
+            age: {type: integer}
+          required: [name, age]
+      - type: llm_judge
+        criteria: The reply is a JSON object
+`
+
+func TestEval(t *testing.T) {
+	suite, err := ParseEvalSuite([]byte(testEvalSuite))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"good", "bad"}, suite.Cases[0].Models)
+
+	provider := replyProvider{
+		"good":  "Hello world",
+		"bad":   "Goodbye",
+		"judge": "```json\n{\"pass\": true, \"reason\": \"looks good\"}\n```",
+	}
+	service := NewLLMService(provider, WithOutputFormat(OutputJSON))
+
+	// the good model replies the same to both cases, so the schema assertion fails
+	report, err := service.Eval(context.Background(), suite)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 3)
+	assert.Equal(t, 1, report.Passed)
+	assert.Equal(t, 2, report.Failed)
+
+	assert.True(t, report.Results[0].Passed)
+	bad := report.Results[1]
+	assert.Equal(t, "bad", bad.Model)
+	assert.False(t, bad.Passed)
+	assert.False(t, bad.Assertions[0].Passed)
+	assert.False(t, bad.Assertions[1].Passed)
+	assert.True(t, bad.Assertions[2].Passed)
+
+	structured := report.Results[2]
+	assert.False(t, structured.Assertions[0].Passed)
+	assert.True(t, structured.Assertions[1].Passed)
+	assert.Equal(t, "looks good", structured.Assertions[1].Message)
+
+	provider["good"] = `{"name": "Ann", "age": 30}`
+	report, err = service.Eval(context.Background(), &EvalSuite{Cases: suite.Cases[1:], JudgeModel: "judge"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Passed)
+}
+
+func TestEvalAdditionalProperties(t *testing.T) {
+	suite, err := ParseEvalSuite([]byte(`
+models: [good, bad]
+cases:
+  - prompt: Count the words
+    assert:
+      - type: json_schema
+        schema:
+          type: object
+          additionalProperties: {type: integer}
+`))
+	require.NoError(t, err)
+
+	provider := replyProvider{"good": `{"hello": 1, "world": 1}`, "bad": `{"hello": "one"}`}
+	report, err := NewLLMService(provider, WithOutputFormat(OutputJSON)).Eval(context.Background(), suite)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 2)
+	assert.True(t, report.Results[0].Passed)
+	assert.False(t, report.Results[1].Passed)
+	assert.Contains(t, report.Results[1].Assertions[0].Message, "$.hello: expected integer, got string")
+}
+
+func TestParseEvalSuite(t *testing.T) {
+	tests := []struct {
+		name  string
+		suite string
+		err   string
+	}{
+		{"no cases", `models: [m]`, "suite has no cases"},
+		{"no models", `cases: [{prompt: hi}]`, "no models"},
+		{"no prompt", `{"models": ["m"], "cases": [{"name": "empty"}]}`, "prompt or messages is required"},
+		{"unknown assertion", `{models: [m], cases: [{prompt: hi, assert: [{type: equals}]}]}`, "unknown assertion type"},
+		{"judge without model", `{models: [m], cases: [{prompt: hi, assert: [{type: llm_judge, criteria: polite}]}]}`, "requires a model"},
+		{"invalid latency", `{models: [m], cases: [{prompt: hi, assert: [{type: max_latency, value: fast}]}]}`, "invalid max_latency"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseEvalSuite([]byte(tt.suite))
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
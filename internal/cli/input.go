@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/recally-io/polyllm/llms"
+)
+
+const (
+	// MaxAttachmentFileSize is the maximum size of a text file attached with -f
+	MaxAttachmentFileSize = 1 << 20
+	// MaxImageFileSize is the maximum size of a local image attached with -i
+	MaxImageFileSize = 20 << 20
+	// MaxStdinSize is the maximum size of the input read from stdin
+	MaxStdinSize = 10 << 20
+)
+
+// supportedImageTypes are the image MIME types accepted by the vision models
+var supportedImageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// Input is the user input of a single prompt.
+type Input struct {
+	// Prompt is the prompt given as arguments
+	Prompt string
+	// Stdin is the content piped to the CLI
+	Stdin string
+	// Files are paths of text files attached as context
+	Files []string
+	// Images are paths or URLs of images attached to the prompt
+	Images []string
+}
+
+// StdinIsPiped reports whether stdin is a pipe or a file rather than a terminal.
+func StdinIsPiped() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice == 0
+}
+
+// ReadStdin reads the content piped to the CLI.
+func ReadStdin() (string, error) {
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, MaxStdinSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
+	}
+	if len(data) > MaxStdinSize {
+		return "", fmt.Errorf("stdin exceeds the %d bytes limit", MaxStdinSize)
+	}
+	return string(data), nil
+}
+
+// Empty reports whether the input has no text.
+func (in Input) Empty() bool {
+	return strings.TrimSpace(in.Prompt) == "" && strings.TrimSpace(in.Stdin) == "" && len(in.Files) == 0
+}
+
+// Message builds the user message from the prompt, stdin, attached files and images.
+// Messages with images use multi content parts, other messages use plain content.
+func (in Input) Message() (llms.ChatCompletionMessage, error) {
+	sections := make([]string, 0, 2+len(in.Files))
+	if prompt := strings.TrimSpace(in.Prompt); prompt != "" {
+		sections = append(sections, prompt)
+	}
+	if stdin := strings.TrimSpace(in.Stdin); stdin != "" {
+		sections = append(sections, stdin)
+	}
+	for _, path := range in.Files {
+		content, err := readTextFile(path)
+		if err != nil {
+			return llms.ChatCompletionMessage{}, err
+		}
+		sections = append(sections, fmt.Sprintf("File: %s\n```\n%s\n```", path, strings.TrimRight(content, "\n")))
+	}
+	text := strings.Join(sections, "\n\n")
+
+	if len(in.Images) == 0 {
+		return llms.ChatCompletionMessage{
+			Role:    llms.ChatMessageRoleUser,
+			Content: text,
+		}, nil
+	}
+
+	parts := make([]llms.ChatMessagePart, 0, len(in.Images)+1)
+	if text != "" {
+		parts = append(parts, llms.ChatMessagePart{
+			Type: llms.ChatMessagePartTypeText,
+			Text: text,
+		})
+	}
+	for _, image := range in.Images {
+		url, err := imageURL(image)
+		if err != nil {
+			return llms.ChatCompletionMessage{}, err
+		}
+		parts = append(parts, llms.ChatMessagePart{
+			Type:     llms.ChatMessagePartTypeImageURL,
+			ImageURL: &llms.ChatMessageImageURL{URL: url, Detail: llms.ImageURLDetailAuto},
+		})
+	}
+	return llms.ChatCompletionMessage{
+		Role:         llms.ChatMessageRoleUser,
+		MultiContent: parts,
+	}, nil
+}
+
+// readTextFile reads a text file to attach as context, rejecting large and binary files.
+func readTextFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to attach file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("failed to attach file %s: is a directory", path)
+	}
+	if info.Size() > MaxAttachmentFileSize {
+		return "", fmt.Errorf("failed to attach file %s: size %d exceeds the %d bytes limit", path, info.Size(), MaxAttachmentFileSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to attach file: %w", err)
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("failed to attach file %s: not a text file", path)
+	}
+	return string(data), nil
+}
+
+// imageURL returns the URL of an image, local files are encoded as base64 data URLs.
+func imageURL(image string) (string, error) {
+	if strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") || strings.HasPrefix(image, "data:") {
+		return image, nil
+	}
+
+	info, err := os.Stat(image)
+	if err != nil {
+		return "", fmt.Errorf("failed to attach image: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("failed to attach image %s: is a directory", image)
+	}
+	if info.Size() > MaxImageFileSize {
+		return "", fmt.Errorf("failed to attach image %s: size %d exceeds the %d bytes limit", image, info.Size(), MaxImageFileSize)
+	}
+	data, err := os.ReadFile(image)
+	if err != nil {
+		return "", fmt.Errorf("failed to attach image: %w", err)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !slices.Contains(supportedImageTypes, mimeType) {
+		return "", fmt.Errorf("failed to attach image %s: unsupported type %s (%s)", image, mimeType, filepath.Ext(image))
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)), nil
+}
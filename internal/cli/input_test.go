@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeInputFiles writes the files and a "dir" directory in a temp dir and returns the dir,
+// sizes are sparse files of the given size.
+func writeInputFiles(t *testing.T, files map[string]string, sizes map[string]int64) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	for name, size := range sizes {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+		require.NoError(t, os.Truncate(filepath.Join(dir, name), size))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "dir"), 0o755))
+	return dir
+}
+
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestReadTextFile(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"main.go":    "package main\n",
+		"binary.bin": "\xff\xfe\x00bad",
+	}, map[string]int64{
+		"max.txt":   MaxAttachmentFileSize,
+		"large.txt": MaxAttachmentFileSize + 1,
+	})
+
+	for _, tc := range []struct {
+		name string
+		want string
+		err  string
+	}{
+		{name: "main.go", want: "package main\n"},
+		{name: "max.txt"},
+		{name: "large.txt", err: "exceeds the 1048576 bytes limit"},
+		{name: "binary.bin", err: "not a text file"},
+		{name: "dir", err: "is a directory"},
+		{name: "missing.txt", err: "no such file or directory"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := readTextFile(filepath.Join(dir, tc.name))
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.want != "" {
+				assert.Equal(t, tc.want, content)
+			}
+		})
+	}
+}
+
+func TestImageURL(t *testing.T) {
+	images := map[string]string{
+		"image.png":  pngHeader,
+		"photo.jpg":  "\xff\xd8\xff\xe0\x00\x10JFIF",
+		"anim.gif":   "GIF89a\x01\x00\x01\x00",
+		"image.webp": "RIFF\x00\x00\x00\x00WEBPVP8 ",
+		"fake.png":   "not an image",
+		"vector.svg": `<svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+	}
+	dir := writeInputFiles(t, images, map[string]int64{"large.png": MaxImageFileSize + 1})
+
+	for _, tc := range []struct {
+		image string
+		want  string
+		err   string
+	}{
+		{image: "https://example.com/cat.png", want: "https://example.com/cat.png"},
+		{image: "http://example.com/cat.png", want: "http://example.com/cat.png"},
+		{image: "data:image/png;base64,AAAA", want: "data:image/png;base64,AAAA"},
+		{image: "image.png", want: "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte(images["image.png"]))},
+		{image: "photo.jpg", want: "data:image/jpeg;base64,"},
+		{image: "anim.gif", want: "data:image/gif;base64,"},
+		{image: "image.webp", want: "data:image/webp;base64,"},
+		{image: "fake.png", err: "unsupported type text/plain; charset=utf-8 (.png)"},
+		{image: "vector.svg", err: "unsupported type text/plain; charset=utf-8 (.svg)"},
+		{image: "large.png", err: "exceeds the 20971520 bytes limit"},
+		{image: "dir", err: "is a directory"},
+		{image: "missing.png", err: "no such file or directory"},
+	} {
+		t.Run(tc.image, func(t *testing.T) {
+			image := tc.image
+			if _, ok := images[image]; ok || tc.err != "" {
+				image = filepath.Join(dir, image)
+			}
+			url, err := imageURL(image)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(url, tc.want), url)
+		})
+	}
+}
+
+func TestInputMessage(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"main.go":   "package main\n\n",
+		"image.png": pngHeader,
+	}, nil)
+	mainGo := filepath.Join(dir, "main.go")
+	imagePNG := filepath.Join(dir, "image.png")
+	imageData := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte(pngHeader))
+
+	for _, tc := range []struct {
+		name  string
+		input Input
+		want  llms.ChatCompletionMessage
+		err   string
+	}{
+		{
+			name:  "prompt",
+			input: Input{Prompt: "  explain  "},
+			want:  llms.ChatCompletionMessage{Role: llms.ChatMessageRoleUser, Content: "explain"},
+		},
+		{
+			name:  "stdin and files",
+			input: Input{Prompt: "review this", Stdin: "diff\n", Files: []string{mainGo}},
+			want: llms.ChatCompletionMessage{
+				Role:    llms.ChatMessageRoleUser,
+				Content: "review this\n\ndiff\n\nFile: " + mainGo + "\n```\npackage main\n```",
+			},
+		},
+		{
+			name:  "images",
+			input: Input{Prompt: "what is this?", Images: []string{imagePNG, "https://example.com/cat.png"}},
+			want: llms.ChatCompletionMessage{Role: llms.ChatMessageRoleUser, MultiContent: []llms.ChatMessagePart{
+				{Type: llms.ChatMessagePartTypeText, Text: "what is this?"},
+				{Type: llms.ChatMessagePartTypeImageURL, ImageURL: &llms.ChatMessageImageURL{URL: imageData, Detail: llms.ImageURLDetailAuto}},
+				{Type: llms.ChatMessagePartTypeImageURL, ImageURL: &llms.ChatMessageImageURL{URL: "https://example.com/cat.png", Detail: llms.ImageURLDetailAuto}},
+			}},
+		},
+		{
+			name:  "image only",
+			input: Input{Images: []string{"https://example.com/cat.png"}},
+			want: llms.ChatCompletionMessage{Role: llms.ChatMessageRoleUser, MultiContent: []llms.ChatMessagePart{
+				{Type: llms.ChatMessagePartTypeImageURL, ImageURL: &llms.ChatMessageImageURL{URL: "https://example.com/cat.png", Detail: llms.ImageURLDetailAuto}},
+			}},
+		},
+		{
+			name:  "missing file",
+			input: Input{Prompt: "hi", Files: []string{filepath.Join(dir, "missing.go")}},
+			err:   "failed to attach file",
+		},
+		{
+			name:  "invalid image",
+			input: Input{Prompt: "hi", Images: []string{mainGo}},
+			err:   "unsupported type",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := tc.input.Message()
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, msg)
+		})
+	}
+
+	assert.True(t, Input{Prompt: " ", Stdin: "\n", Images: []string{imagePNG}}.Empty())
+	assert.False(t, Input{Files: []string{mainGo}}.Empty())
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/recally-io/polyllm/logger"
+)
+
+// OutputFormat is the format the CLI prints results in.
+type OutputFormat string
+
+const (
+	// OutputText prints human readable colored text
+	OutputText OutputFormat = "text"
+	// OutputJSON prints a single JSON document
+	OutputJSON OutputFormat = "json"
+	// OutputJSONL prints one JSON document per line, e.g. one per streaming chunk
+	OutputJSONL OutputFormat = "jsonl"
+	// OutputRaw prints plain content without colors or decorations
+	OutputRaw OutputFormat = "raw"
+)
+
+// ParseOutputFormat parses an output format name.
+func ParseOutputFormat(format string) (OutputFormat, error) {
+	switch f := OutputFormat(format); f {
+	case OutputText, OutputJSON, OutputJSONL, OutputRaw:
+		return f, nil
+	case "":
+		return OutputText, nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s, use text, json, jsonl or raw", format)
+	}
+}
+
+// ColorsEnabled reports whether colored output should be used:
+// stdout must be a terminal and NO_COLOR must not be set.
+func ColorsEnabled() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	stat, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// ServiceOption configures the LLMService.
+type ServiceOption func(*LLMService)
+
+// WithOutputFormat sets the output format.
+func WithOutputFormat(format OutputFormat) ServiceOption {
+	return func(s *LLMService) {
+		s.output = format
+	}
+}
+
+// WithColors enables or disables colored output.
+func WithColors(enabled bool) ServiceOption {
+	return func(s *LLMService) {
+		s.colors = enabled
+	}
+}
+
+// WithSessionStore sets the store used for named sessions.
+func WithSessionStore(store *SessionStore) ServiceOption {
+	return func(s *LLMService) {
+		s.sessions = store
+	}
+}
+
+// paint wraps text in the color when colors are enabled.
+func (s *LLMService) paint(color, text string) string {
+	if !s.colors || s.output != OutputText || text == "" {
+		return text
+	}
+	return color + text + logger.ColorReset
+}
+
+// machineReadable reports whether the output is meant for scripts.
+func (s *LLMService) machineReadable() bool {
+	return s.output == OutputJSON || s.output == OutputJSONL
+}
+
+// writeJSON writes v as an indented JSON document.
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// writeJSONLines writes every item as a JSON document on its own line.
+func writeJSONLines[T any](w io.Writer, items []T) error {
+	encoder := json.NewEncoder(w)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// streamProvider streams its chunks or replies with its response to non-streaming requests,
+// and records the requests.
+type streamProvider struct {
+	chunks   []llms.ChatCompletionResponse
+	response llms.ChatCompletionResponse
+	err      error
+	models   []llms.Model
+	tools    []llms.Tool
+	requests []llms.ChatCompletionRequest
+}
+
+func (p *streamProvider) ListModels(ctx context.Context) ([]llms.Model, error) {
+	return p.models, nil
+}
+
+func (p *streamProvider) ListMCPTools(ctx context.Context) ([]llms.Tool, error) {
+	return p.tools, nil
+}
+
+func (p *streamProvider) ChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
+	p.requests = append(p.requests, req)
+	if p.err != nil {
+		streamingFunc(llms.StreamingChatCompletionResponse{Err: p.err})
+		return
+	}
+	if !req.Stream {
+		response := p.response
+		streamingFunc(llms.StreamingChatCompletionResponse{Response: &response, Err: io.EOF})
+		return
+	}
+	for _, chunk := range p.chunks {
+		streamingFunc(llms.StreamingChatCompletionResponse{Response: &chunk})
+	}
+	streamingFunc(llms.StreamingChatCompletionResponse{Err: io.EOF})
+}
+
+// newHelloProvider replies "Hello!" with 5 prompt and 2 completion tokens.
+func newHelloProvider() *streamProvider {
+	usage := llms.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}
+	delta := func(content string) llms.ChatCompletionResponse {
+		return llms.ChatCompletionResponse{ID: "chatcmpl-1", Created: 1760788800, Model: "gpt-4o", Object: "chat.completion.chunk",
+			Choices: []llms.ChatCompletionChoice{{Delta: &llms.ChatCompletionMessage{Role: llms.ChatMessageRoleAssistant, Content: content}}}}
+	}
+	return &streamProvider{
+		chunks: []llms.ChatCompletionResponse{
+			delta("Hel"), delta("lo!"),
+			{ID: "chatcmpl-1", Created: 1760788800, Model: "gpt-4o", Object: "chat.completion.chunk", Choices: []llms.ChatCompletionChoice{}, Usage: usage},
+		},
+		response: llms.ChatCompletionResponse{ID: "chatcmpl-1", Created: 1760788800, Model: "gpt-4o", Object: "chat.completion", Usage: usage,
+			Choices: []llms.ChatCompletionChoice{{Message: &llms.ChatCompletionMessage{Role: llms.ChatMessageRoleAssistant, Content: "Hello!"}, FinishReason: llms.FinishReasonStop}}},
+		models: []llms.Model{
+			{ID: "gpt-4o", Object: "model", Name: "GPT-4o", ContextWindow: 128000},
+			{ID: "mock/echo", Object: "model"},
+		},
+	}
+}
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+// assertGolden compares the output with the golden file in testdata, -update rewrites it.
+func assertGolden(t *testing.T, name, output string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, os.WriteFile(path, []byte(output), 0o644))
+	}
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(golden), output)
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for format, want := range map[string]OutputFormat{
+		"": OutputText, "text": OutputText, "json": OutputJSON, "jsonl": OutputJSONL, "raw": OutputRaw,
+	} {
+		got, err := ParseOutputFormat(format)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseOutputFormat("yaml")
+	assert.EqualError(t, err, "unsupported output format: yaml, use text, json, jsonl or raw")
+}
+
+func TestColorsEnabled(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	assert.False(t, ColorsEnabled())
+
+	// stdout is a pipe
+	os.Unsetenv("NO_COLOR")
+	captureStdout(t, func() { assert.False(t, ColorsEnabled()) })
+}
+
+func TestPaint(t *testing.T) {
+	colored := NewLLMService(nil, WithColors(true))
+	assert.Equal(t, logger.ColorRed+"error"+logger.ColorReset, colored.paint(logger.ColorRed, "error"))
+	assert.Equal(t, "", colored.paint(logger.ColorRed, ""))
+	assert.Equal(t, "error", NewLLMService(nil, WithColors(false)).paint(logger.ColorRed, "error"))
+	for _, format := range []OutputFormat{OutputJSON, OutputJSONL, OutputRaw} {
+		assert.Equal(t, "error", NewLLMService(nil, WithColors(true), WithOutputFormat(format)).paint(logger.ColorRed, "error"))
+	}
+}
+
+func TestMachineReadableOutput(t *testing.T) {
+	for _, tc := range []struct {
+		golden string
+		format OutputFormat
+		run    func(s *LLMService) error
+	}{
+		{golden: "chat.json", format: OutputJSON, run: func(s *LLMService) error {
+			return s.ChatCompletion(NewSession("", "gpt-4o"), Input{Prompt: "hi"})
+		}},
+		{golden: "chat.jsonl", format: OutputJSONL, run: func(s *LLMService) error {
+			return s.ChatCompletion(NewSession("", "gpt-4o"), Input{Prompt: "hi"})
+		}},
+		{golden: "models.json", format: OutputJSON, run: func(s *LLMService) error { return s.ListModels() }},
+		{golden: "models.jsonl", format: OutputJSONL, run: func(s *LLMService) error { return s.ListModels() }},
+	} {
+		t.Run(tc.golden, func(t *testing.T) {
+			provider := newHelloProvider()
+			s := NewLLMService(provider, WithOutputFormat(tc.format), WithColors(true))
+			var err error
+			output := captureStdout(t, func() { err = tc.run(s) })
+			require.NoError(t, err)
+			assertGolden(t, tc.golden, output)
+		})
+	}
+}
@@ -2,9 +2,15 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/recally-io/polyllm/llms"
 	"github.com/recally-io/polyllm/logger"
@@ -12,6 +18,9 @@ import (
 
 type LLMService struct {
 	provider LLMProvider
+	sessions *SessionStore
+	output   OutputFormat
+	colors   bool
 }
 
 type LLMProvider interface {
@@ -21,72 +30,260 @@ type LLMProvider interface {
 	ListMCPTools(ctx context.Context) ([]llms.Tool, error)
 }
 
-func NewLLMService(provider LLMProvider) *LLMService {
-	return &LLMService{
+func NewLLMService(provider LLMProvider, opts ...ServiceOption) *LLMService {
+	s := &LLMService{
 		provider: provider,
+		sessions: DefaultSessionStore(),
+		output:   OutputText,
+		colors:   ColorsEnabled(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func (s *LLMService) ListModels() {
+func (s *LLMService) ListModels() error {
 	ctx := context.Background()
 	models, err := s.provider.ListModels(ctx)
 	if err != nil {
-		fmt.Printf("Failed to list models: %v\n", err)
-		return
+		return fmt.Errorf("failed to list models: %w", err)
+	}
+
+	switch s.output {
+	case OutputJSON:
+		return writeJSON(os.Stdout, models)
+	case OutputJSONL:
+		return writeJSONLines(os.Stdout, models)
+	case OutputRaw:
+		for _, model := range models {
+			fmt.Println(model.ID)
+		}
+		return nil
 	}
 
 	fmt.Println("Available models:")
 	for _, model := range models {
-		fmt.Printf(" %s - %s\n", model.Name, model.ID)
+		fmt.Printf(" %s - %s%s\n", model.Name, model.ID, s.paint(logger.ColorCyan, describeModel(model)))
 	}
+	return nil
 }
 
-func (s *LLMService) ChatCompletion(modelName, prompt string) {
-	slog.Debug(fmt.Sprintf("%sChatting with model: %s%s\n", logger.ColorBlue, modelName, logger.ColorReset))
-	slog.Debug(fmt.Sprintf("%sPrompt: %s%s\n\n", logger.ColorGreen, prompt, logger.ColorReset))
+// describeModel formats the limits and capabilities of a model, e.g. " (128k context, 16k output, vision, tools)".
+func describeModel(model llms.Model) string {
+	details := make([]string, 0)
+	if model.ContextWindow > 0 {
+		details = append(details, formatTokens(model.ContextWindow)+" context")
+	}
+	if model.MaxOutputTokens > 0 {
+		details = append(details, formatTokens(model.MaxOutputTokens)+" output")
+	}
+	if c := model.Capabilities; c != nil {
+		for _, capability := range []struct {
+			name      string
+			supported bool
+		}{
+			{"vision", c.Vision},
+			{"tools", c.Tools},
+			{"json_mode", c.JSONMode},
+			{"json_schema", c.JSONSchema},
+			{"reasoning_effort", c.ReasoningEffort},
+			{"reasoning", c.Reasoning},
+			{"developer_role", c.DeveloperRole},
+			{"stream_usage", c.StreamUsage},
+		} {
+			if capability.supported {
+				details = append(details, capability.name)
+			}
+		}
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, ", ") + ")"
+}
+
+// formatCost formats a cost in USD.
+func formatCost(cost float64) string {
+	return fmt.Sprintf("$%.6f", cost)
+}
+
+// formatTokens formats a token count in thousands or millions, e.g. 128k or 1M.
+func formatTokens(n int) string {
+	switch {
+	case n >= 1_000_000 && n%1_000_000 < 100_000:
+		return fmt.Sprintf("%dM", n/1_000_000)
+	case n >= 1000:
+		return fmt.Sprintf("%dk", n/1000)
+	}
+	return strconv.Itoa(n)
+}
+
+// ChatCompletion sends the input after the session history and prints the reply in the output format.
+// Named sessions are saved with the input and reply appended.
+func (s *LLMService) ChatCompletion(session *Session, input Input) error {
+	message, err := input.Message()
+	if err != nil {
+		return err
+	}
+	slog.Debug("Chatting with model", "model", session.Model)
+	slog.Debug("Prompt", "prompt", messageText(message))
 
 	// Create a context
 	ctx := context.Background()
 
-	// Create a request
-	req := llms.ChatCompletionRequest{
-		Model: modelName,
-		Messages: []llms.ChatCompletionMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		Stream: true,
-	}
-
-	// Stream the response
-	s.provider.ChatCompletion(ctx, req, func(resp llms.StreamingChatCompletionResponse) {
-		if resp.Err != nil && resp.Err != io.EOF {
-			slog.Error("Error streaming response", "err", resp.Err)
-			return
-		}
+	// Create a request, json output needs the full response so it does not stream
+	session.Messages = append(session.Messages, message)
+	req := session.NewRequest()
+	req.Stream = s.output != OutputJSON
+	if req.Stream && (session.Name != "" || s.output == OutputJSONL) {
+		req.StreamOptions = &llms.StreamOptions{IncludeUsage: true}
+	}
 
-		if resp.Response != nil && len(resp.Response.Choices) > 0 {
-			if resp.Response.Choices[0].Delta != nil {
-				fmt.Printf("%s%s%s", logger.ColorCyan, resp.Response.Choices[0].Delta.Content, logger.ColorReset)
+	var (
+		final    *llms.ChatCompletionResponse
+		writeErr error
+		encoder  = json.NewEncoder(os.Stdout)
+	)
+	reply, usage, err := s.streamReply(ctx, req, func(chunk *llms.ChatCompletionResponse) {
+		switch s.output {
+		case OutputJSON:
+			final = chunk
+		case OutputJSONL:
+			if err := encoder.Encode(chunk); err != nil && writeErr == nil {
+				writeErr = err
 			}
+		default:
+			fmt.Print(s.paint(logger.ColorCyan, deltaContent(chunk)))
 		}
 	})
+	if !s.machineReadable() {
+		fmt.Println() // Add a newline at the end
+	}
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if s.output == OutputJSON && final != nil {
+		if err := writeJSON(os.Stdout, final); err != nil {
+			return err
+		}
+	}
 
-	fmt.Println() // Add a newline at the end
+	session.Messages = append(session.Messages, llms.ChatCompletionMessage{
+		Role:    llms.ChatMessageRoleAssistant,
+		Content: reply,
+	})
+	session.AddUsage(usage)
+	s.saveSession(session)
+	return nil
 }
 
-func (s *LLMService) ListMCPTools() {
+// LoadSession loads a named session, creating a new one if it does not exist.
+func (s *LLMService) LoadSession(name, model string) (*Session, error) {
+	session, err := s.sessions.Load(name)
+	if errors.Is(err, ErrSessionNotFound) {
+		return NewSession(name, model), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if model != "" {
+		session.Model = model
+	}
+	return session, nil
+}
+
+// saveSession persists named sessions, unnamed sessions are not stored.
+func (s *LLMService) saveSession(session *Session) {
+	if session.Name == "" {
+		return
+	}
+	if err := s.sessions.Save(session); err != nil {
+		fmt.Fprintln(os.Stderr, s.paint(logger.ColorRed, fmt.Sprintf("Failed to save session %s: %v", session.Name, err)))
+	}
+}
+
+// ListSessions prints all stored sessions.
+func (s *LLMService) ListSessions() {
+	sessions, err := s.sessions.List()
+	if err != nil {
+		fmt.Printf("Failed to list sessions: %v\n", err)
+		return
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No sessions found")
+		return
+	}
+
+	fmt.Println("Sessions:")
+	for _, session := range sessions {
+		cost := ""
+		if session.Usage.Cost != nil {
+			cost = ", " + formatCost(*session.Usage.Cost)
+		}
+		fmt.Printf(" %s - %s, %d messages, %d tokens%s, updated %s\n",
+			s.paint(logger.ColorCyan, session.Name),
+			displayModel(session.Model), len(session.Messages), session.Usage.TotalTokens, cost,
+			session.UpdatedAt.Format(time.DateTime))
+	}
+}
+
+// ShowSession prints the transcript of a session.
+func (s *LLMService) ShowSession(name string) error {
+	session, err := s.sessions.Load(name)
+	if err != nil {
+		return err
+	}
+	return ExportSessions(os.Stdout, ExportFormatMarkdown, session)
+}
+
+// RemoveSession deletes a session.
+func (s *LLMService) RemoveSession(name string) error {
+	if err := s.sessions.Remove(name); err != nil {
+		return err
+	}
+	fmt.Printf("Removed session %s\n", name)
+	return nil
+}
+
+// ExportSessions writes the named sessions in the given format to w.
+func (s *LLMService) ExportSessions(w io.Writer, format string, names ...string) error {
+	sessions := make([]*Session, 0, len(names))
+	for _, name := range names {
+		session, err := s.sessions.Load(name)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, session)
+	}
+	return ExportSessions(w, format, sessions...)
+}
+
+func (s *LLMService) ListMCPTools() error {
 	ctx := context.Background()
 	tools, err := s.provider.ListMCPTools(ctx)
 	if err != nil {
-		fmt.Printf("Failed to list MCP tools: %v\n", err)
-		return
+		return fmt.Errorf("failed to list MCP tools: %w", err)
+	}
+
+	switch s.output {
+	case OutputJSON:
+		return writeJSON(os.Stdout, tools)
+	case OutputJSONL:
+		return writeJSONLines(os.Stdout, tools)
+	case OutputRaw:
+		for _, tool := range tools {
+			fmt.Println(tool.Function.Name)
+		}
+		return nil
 	}
 
-	fmt.Printf("Available MCP tools (format: %smcp_{server_name}_{tool_name}%s)\n", logger.ColorYellow, logger.ColorReset)
+	fmt.Printf("Available MCP tools (format: %s)\n", s.paint(logger.ColorYellow, "mcp_{server_name}_{tool_name}"))
 	for idx, tool := range tools {
-		fmt.Printf("\n%d: %s%s%s - %s\n", idx+1, logger.ColorCyan, tool.Function.Name, logger.ColorReset, tool.Function.Description)
+		fmt.Printf("\n%d: %s - %s\n", idx+1, s.paint(logger.ColorCyan, tool.Function.Name), tool.Function.Description)
 	}
+	return nil
 }
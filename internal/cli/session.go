@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+)
+
+// ErrSessionNotFound is returned when a session does not exist in the store
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a persisted CLI conversation.
+type Session struct {
+	Name      string                       `json:"name"`
+	Model     string                       `json:"model,omitempty"`
+	System    string                       `json:"system,omitempty"`
+	Options   SessionOptions               `json:"options"`
+	Messages  []llms.ChatCompletionMessage `json:"messages"`
+	Usage     llms.Usage                   `json:"usage"`
+	CreatedAt time.Time                    `json:"created_at"`
+	UpdatedAt time.Time                    `json:"updated_at"`
+}
+
+// SessionOptions are the request options stored with a session.
+type SessionOptions struct {
+	// MCP is the comma separated list of MCP servers whose tools are enabled
+	MCP         string  `json:"mcp,omitempty"`
+	Temperature float32 `json:"temperature,omitempty"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+}
+
+// NewSession creates an empty session.
+func NewSession(name, model string) *Session {
+	now := time.Now()
+	return &Session{
+		Name:      name,
+		Model:     model,
+		Messages:  make([]llms.ChatCompletionMessage, 0),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// RequestModel returns the model name including the mcp query when tools are enabled.
+func (s *Session) RequestModel() string {
+	if s.Options.MCP == "" {
+		return s.Model
+	}
+	return s.Model + "?mcp=" + s.Options.MCP
+}
+
+// RequestMessages returns the history prefixed with the system prompt.
+func (s *Session) RequestMessages() []llms.ChatCompletionMessage {
+	messages := make([]llms.ChatCompletionMessage, 0, len(s.Messages)+1)
+	if s.System != "" {
+		messages = append(messages, llms.ChatCompletionMessage{
+			Role:    llms.ChatMessageRoleSystem,
+			Content: s.System,
+		})
+	}
+	return append(messages, s.Messages...)
+}
+
+// NewRequest builds a chat completion request from the session history and options.
+func (s *Session) NewRequest() llms.ChatCompletionRequest {
+	return llms.ChatCompletionRequest{
+		Model:       s.RequestModel(),
+		Messages:    s.RequestMessages(),
+		Temperature: s.Options.Temperature,
+		MaxTokens:   s.Options.MaxTokens,
+	}
+}
+
+// AddUsage adds the usage of a turn to the session totals.
+func (s *Session) AddUsage(usage llms.Usage) {
+	s.Usage.Add(usage)
+}
+
+// SessionStore stores sessions as JSON files in a directory.
+type SessionStore struct {
+	dir string
+}
+
+// NewSessionStore creates a store rooted at dir.
+func NewSessionStore(dir string) *SessionStore {
+	return &SessionStore{dir: dir}
+}
+
+// DefaultSessionStore returns the store in the user config directory.
+func DefaultSessionStore() *SessionStore {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		slog.Error("Error getting user config directory", "err", err)
+		configDir = os.TempDir()
+	}
+	return NewSessionStore(filepath.Join(configDir, "polyllm", "sessions"))
+}
+
+func (s *SessionStore) path(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid session name: %q", name)
+	}
+	return filepath.Join(s.dir, name+".json"), nil
+}
+
+// Load loads a session by name, it returns ErrSessionNotFound if it does not exist.
+func (s *SessionStore) Load(name string) (*Session, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+		}
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", name, err)
+	}
+	return &session, nil
+}
+
+// Save writes the session to the store.
+func (s *SessionStore) Save(session *Session) error {
+	path, err := s.path(session.Name)
+	if err != nil {
+		return err
+	}
+	session.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Remove deletes a session from the store.
+func (s *SessionStore) Remove(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// List returns all sessions, most recently updated first.
+func (s *SessionStore) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sessions := make([]*Session, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		session, err := s.Load(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			slog.Error("failed to load session", "file", entry.Name(), "err", err)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// Session export formats
+const (
+	ExportFormatMarkdown = "md"
+	ExportFormatJSONL    = "jsonl"
+)
+
+// ExportSessions writes the sessions in the given format.
+// Markdown renders a transcript per session, JSONL writes one OpenAI-style
+// {"messages": [...]} line per session.
+func ExportSessions(w io.Writer, format string, sessions ...*Session) error {
+	switch format {
+	case ExportFormatMarkdown, "markdown":
+		for i, session := range sessions {
+			if i > 0 {
+				fmt.Fprint(w, "\n---\n\n")
+			}
+			writeSessionMarkdown(w, session)
+		}
+		return nil
+	case ExportFormatJSONL:
+		encoder := json.NewEncoder(w)
+		for _, session := range sessions {
+			line := struct {
+				Messages []llms.ChatCompletionMessage `json:"messages"`
+			}{Messages: session.RequestMessages()}
+			if err := encoder.Encode(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+func writeSessionMarkdown(w io.Writer, session *Session) {
+	fmt.Fprintf(w, "# %s\n\n", session.Name)
+	fmt.Fprintf(w, "- Model: %s\n", displayModel(session.Model))
+	fmt.Fprintf(w, "- Updated: %s\n", session.UpdatedAt.Format(time.RFC1123))
+	fmt.Fprintf(w, "- Tokens: %d (prompt %d, completion %d)\n", session.Usage.TotalTokens, session.Usage.PromptTokens, session.Usage.CompletionTokens)
+	if cost := session.Usage.Cost; cost != nil {
+		fmt.Fprintf(w, "- Cost: %s\n", formatCost(*cost))
+	}
+	fmt.Fprintln(w)
+	for _, msg := range session.RequestMessages() {
+		fmt.Fprintf(w, "## %s\n\n%s\n\n", roleTitle(msg.Role), messageText(msg))
+	}
+}
+
+// messageText returns the text content of a message, including text parts of multi content messages.
+func messageText(msg llms.ChatCompletionMessage) string {
+	if msg.Content != "" || len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+	parts := make([]string, 0, len(msg.MultiContent))
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case llms.ChatMessagePartTypeText:
+			parts = append(parts, part.Text)
+		case llms.ChatMessagePartTypeImageURL:
+			parts = append(parts, "[image]")
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func roleTitle(role string) string {
+	if role == "" {
+		return role
+	}
+	return strings.ToUpper(role[:1]) + role[1:]
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store := NewSessionStore(dir)
+
+	// the directory is created on the first save
+	sessions, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+	_, err = store.Load("work")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	work := NewSession("work", "gpt-4o")
+	work.System = "Be brief"
+	work.Options = SessionOptions{MCP: "fetch", Temperature: 0.5, MaxTokens: 100}
+	work.Messages = append(work.Messages, llms.ChatCompletionMessage{Role: llms.ChatMessageRoleUser, Content: "hi"})
+	cost := 0.25
+	work.AddUsage(llms.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5, Cost: &cost})
+	work.AddUsage(llms.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5, Cost: &cost})
+	require.NotNil(t, work.Usage.Cost)
+	assert.InDelta(t, 0.5, *work.Usage.Cost, 1e-12)
+	require.NoError(t, store.Save(work))
+	time.Sleep(time.Millisecond)
+	require.NoError(t, store.Save(NewSession("notes", "")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("ignored"), 0o644))
+
+	loaded, err := store.Load("work")
+	require.NoError(t, err)
+	assert.Equal(t, work.Options, loaded.Options)
+	assert.Equal(t, work.Messages, loaded.Messages)
+	assert.Equal(t, work.Usage, loaded.Usage)
+	assert.Equal(t, "gpt-4o?mcp=fetch", loaded.RequestModel())
+
+	// broken files are skipped, the most recently updated session is first
+	sessions, err = store.List()
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "notes", sessions[0].Name)
+	assert.Equal(t, "work", sessions[1].Name)
+
+	require.NoError(t, store.Remove("notes"))
+	assert.ErrorIs(t, store.Remove("notes"), ErrSessionNotFound)
+	_, err = store.Load("notes")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestSessionStoreNames(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+	for _, name := range []string{"", ".hidden", "../escape", "a/b", "."} {
+		_, err := store.Load(name)
+		assert.ErrorContains(t, err, "invalid session name", name)
+		assert.ErrorContains(t, store.Save(NewSession(name, "")), "invalid session name", name)
+		assert.ErrorContains(t, store.Remove(name), "invalid session name", name)
+	}
+}
+
+func TestExportSessions(t *testing.T) {
+	updated := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	cost := 0.00015
+	work := &Session{
+		Name:   "work",
+		Model:  "gpt-4o",
+		System: "Be brief",
+		Messages: []llms.ChatCompletionMessage{
+			{Role: llms.ChatMessageRoleUser, MultiContent: []llms.ChatMessagePart{
+				{Type: llms.ChatMessagePartTypeText, Text: "What is this?"},
+				{Type: llms.ChatMessagePartTypeImageURL, ImageURL: &llms.ChatMessageImageURL{URL: "https://example.com/cat.png"}},
+			}},
+			{Role: llms.ChatMessageRoleAssistant, Content: "A cat."},
+		},
+		Usage:     llms.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12, Cost: &cost},
+		UpdatedAt: updated,
+	}
+	empty := &Session{Name: "empty", UpdatedAt: updated}
+
+	var b strings.Builder
+	require.NoError(t, ExportSessions(&b, ExportFormatMarkdown, work, empty))
+	assert.Equal(t, `# work
+
+- Model: gpt-4o
+- Updated: Sun, 18 Oct 2026 12:00:00 UTC
+- Tokens: 12 (prompt 10, completion 2)
+- Cost: $0.000150
+
+## System
+
+Be brief
+
+## User
+
+What is this?
+
+[image]
+
+## Assistant
+
+A cat.
+
+
+---
+
+# empty
+
+- Model: <no model>
+- Updated: Sun, 18 Oct 2026 12:00:00 UTC
+- Tokens: 0 (prompt 0, completion 0)
+
+`, b.String())
+
+	b.Reset()
+	require.NoError(t, ExportSessions(&b, ExportFormatJSONL, work, empty))
+	assert.Equal(t, `{"messages":[{"role":"system","content":"Be brief"},{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]},{"role":"assistant","content":"A cat."}]}
+{"messages":[]}
+`, b.String())
+
+	assert.EqualError(t, ExportSessions(&b, "html", work), "unsupported export format: html")
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// adminMiddleware checks the bearer token of admin requests against the ADMIN_API_KEY env var,
+// the admin API is disabled without it.
+func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminKey := os.Getenv("ADMIN_API_KEY")
+		if adminKey == "" {
+			(&apiError{status: http.StatusNotFound, Message: "the admin API is disabled, set ADMIN_API_KEY to enable it", Type: "invalid_request_error"}).write(w)
+			return
+		}
+		headerKey, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(headerKey), []byte(adminKey)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// keyResponse is a virtual key returned by the admin API, the secret is only returned when the key is created or rotated.
+type keyResponse struct {
+	VirtualKey
+	Key string `json:"key,omitempty"`
+}
+
+func newKeyResponse(key VirtualKey, secret string) keyResponse {
+	key.Hash = ""
+	return keyResponse{VirtualKey: key, Key: secret}
+}
+
+type listKeysResponse struct {
+	Data   []keyResponse `json:"data"`
+	Object string        `json:"object"`
+}
+
+func (s *LLMService) createKey(w http.ResponseWriter, r *http.Request) {
+	var metadata KeyMetadata
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&metadata); err != nil {
+		invalidRequest("failed to parse request body: " + err.Error()).write(w)
+		return
+	}
+	if metadata.Name == "" {
+		invalidRequest("the key needs a name").write(w)
+		return
+	}
+	if metadata.expired(s.now()) {
+		invalidRequest("expires_at is in the past").write(w)
+		return
+	}
+
+	id, err := newKeyID()
+	if err != nil {
+		serverError(w, "failed to create key", err)
+		return
+	}
+	key := VirtualKey{ID: id, KeyMetadata: metadata, CreatedAt: s.now().UTC()}
+	secret, err := key.newSecret()
+	if err != nil {
+		serverError(w, "failed to create key", err)
+		return
+	}
+	if err := s.keyStore.Put(r.Context(), key); err != nil {
+		serverError(w, "failed to store key", err)
+		return
+	}
+	slog.Info("Created key", "id", key.ID, "name", key.Name, "owner", key.Owner, "team", key.Team)
+	writeJSON(w, http.StatusCreated, newKeyResponse(key, secret))
+}
+
+func (s *LLMService) listKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.keyStore.List(r.Context())
+	if err != nil {
+		serverError(w, "failed to list keys", err)
+		return
+	}
+	resp := listKeysResponse{Data: make([]keyResponse, 0, len(keys)), Object: "list"}
+	for _, key := range keys {
+		resp.Data = append(resp.Data, newKeyResponse(key, ""))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *LLMService) getKey(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.loadKey(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newKeyResponse(key, ""))
+}
+
+// revokeKey disables a key, revoked keys are kept to list them.
+func (s *LLMService) revokeKey(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.loadKey(w, r)
+	if !ok {
+		return
+	}
+	if key.RevokedAt == nil {
+		now := s.now().UTC()
+		key.RevokedAt = &now
+		if err := s.keyStore.Put(r.Context(), key); err != nil {
+			serverError(w, "failed to store key", err)
+			return
+		}
+		slog.Info("Revoked key", "id", key.ID, "name", key.Name)
+	}
+	writeJSON(w, http.StatusOK, newKeyResponse(key, ""))
+}
+
+// rotateKey replaces the secret of a key, the previous secret stops working immediately.
+func (s *LLMService) rotateKey(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.loadKey(w, r)
+	if !ok {
+		return
+	}
+	if key.RevokedAt != nil {
+		invalidRequest("the key " + key.ID + " is revoked").write(w)
+		return
+	}
+	secret, err := key.newSecret()
+	if err != nil {
+		serverError(w, "failed to rotate key", err)
+		return
+	}
+	now := s.now().UTC()
+	key.RotatedAt = &now
+	if err := s.keyStore.Put(r.Context(), key); err != nil {
+		serverError(w, "failed to store key", err)
+		return
+	}
+	slog.Info("Rotated key", "id", key.ID, "name", key.Name)
+	writeJSON(w, http.StatusOK, newKeyResponse(key, secret))
+}
+
+// loadKey loads the key of the id path value, writing an error response when it fails.
+func (s *LLMService) loadKey(w http.ResponseWriter, r *http.Request) (VirtualKey, bool) {
+	id := r.PathValue("id")
+	key, err := s.keyStore.Get(r.Context(), id)
+	if errors.Is(err, ErrKeyNotFound) {
+		(&apiError{status: http.StatusNotFound, Message: "key " + id + " not found", Type: "invalid_request_error"}).write(w)
+		return VirtualKey{}, false
+	}
+	if err != nil {
+		serverError(w, "failed to load key", err)
+		return VirtualKey{}, false
+	}
+	return key, true
+}
+
+func invalidRequest(message string) *apiError {
+	return &apiError{status: http.StatusBadRequest, Message: message, Type: "invalid_request_error"}
+}
+
+func serverError(w http.ResponseWriter, message string, err error) {
+	slog.Error(message, "err", err)
+	(&apiError{status: http.StatusInternalServerError, Message: message, Type: "server_error"}).write(w)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to encode response", "err", err)
+	}
+}
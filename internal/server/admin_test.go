@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProviderFunc calls the function with the request context before replying like fakeProvider.
+type fakeProviderFunc func(ctx context.Context)
+
+func (f fakeProviderFunc) ListModels(ctx context.Context) ([]llms.Model, error) {
+	return fakeProvider{}.ListModels(ctx)
+}
+
+func (f fakeProviderFunc) ChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
+	f(ctx)
+	fakeProvider{}.ChatCompletion(ctx, req, streamingFunc, options...)
+}
+
+func adminRequest(t *testing.T, server *httptest.Server, method, path, body string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode < 300 {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp.StatusCode
+}
+
+func TestAdminKeys(t *testing.T) {
+	s, server := newTestService(t, Config{})
+	t.Setenv("ADMIN_API_KEY", "admin-secret")
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	// virtual keys are required once the admin API is enabled
+	assert.Equal(t, http.StatusUnauthorized, postChat(t, server, "", chatBody).StatusCode)
+
+	var created keyResponse
+	status := adminRequest(t, server, http.MethodPost, "/admin/keys",
+		`{"name":"ci","owner":"alice","team":"platform","models":["fake"],"rate_limit":{"rpm":60},"budget":{"daily_usd":10}}`, &created)
+	require.Equal(t, http.StatusCreated, status)
+	assert.True(t, strings.HasPrefix(created.Key, virtualKeyPrefix))
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	assert.Empty(t, created.Hash)
+	assert.Equal(t, "platform", created.Team)
+	assert.Equal(t, &RateLimit{RequestsPerMinute: 60}, created.RateLimit)
+
+	stored, err := s.keyStore.Get(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, hashKey(created.Key), stored.Hash)
+
+	t.Run("identity", func(t *testing.T) {
+		var identity *Identity
+		s.provider = fakeProviderFunc(func(ctx context.Context) { identity = IdentityFromContext(ctx) })
+		t.Cleanup(func() { s.provider = fakeProvider{} })
+		require.Equal(t, http.StatusOK, postChat(t, server, created.Key, chatBody).StatusCode)
+		require.NotNil(t, identity)
+		assert.Equal(t, created.ID, identity.ID)
+		assert.Equal(t, "alice", identity.Owner)
+
+		resp := postChat(t, server, created.Key, `{"model":"other","messages":[]}`)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	var list listKeysResponse
+	require.Equal(t, http.StatusOK, adminRequest(t, server, http.MethodGet, "/admin/keys", "", &list))
+	require.Len(t, list.Data, 1)
+	assert.Equal(t, created.ID, list.Data[0].ID)
+	assert.Empty(t, list.Data[0].Key)
+	assert.Empty(t, list.Data[0].Hash)
+
+	var rotated keyResponse
+	require.Equal(t, http.StatusOK, adminRequest(t, server, http.MethodPost, "/admin/keys/"+created.ID+"/rotate", "", &rotated))
+	assert.NotEqual(t, created.Key, rotated.Key)
+	assert.Equal(t, http.StatusUnauthorized, postChat(t, server, created.Key, chatBody).StatusCode)
+	assert.Equal(t, http.StatusOK, postChat(t, server, rotated.Key, chatBody).StatusCode)
+
+	var revoked keyResponse
+	require.Equal(t, http.StatusOK, adminRequest(t, server, http.MethodDelete, "/admin/keys/"+created.ID, "", &revoked))
+	assert.NotNil(t, revoked.RevokedAt)
+	assert.Equal(t, http.StatusUnauthorized, postChat(t, server, rotated.Key, chatBody).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, http.MethodPost, "/admin/keys/"+created.ID+"/rotate", "", nil))
+
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, http.MethodGet, "/admin/keys/key_unknown", "", nil))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, http.MethodPost, "/admin/keys", `{"owner":"alice"}`, nil))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, http.MethodPost, "/admin/keys", `{"name":"ci","modles":["fake"]}`, nil))
+
+	t.Run("expiry", func(t *testing.T) {
+		var key keyResponse
+		require.Equal(t, http.StatusCreated, adminRequest(t, server, http.MethodPost, "/admin/keys",
+			`{"name":"temp","expires_at":"2026-10-19T00:00:00Z"}`, &key))
+		assert.Equal(t, http.StatusOK, postChat(t, server, key.Key, chatBody).StatusCode)
+		now = now.Add(24 * time.Hour)
+		assert.Equal(t, http.StatusUnauthorized, postChat(t, server, key.Key, chatBody).StatusCode)
+	})
+}
+
+func TestAdminAuth(t *testing.T) {
+	_, server := newTestService(t, Config{})
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, http.MethodGet, "/admin/keys", "", nil))
+	// without keys, API_KEY or ADMIN_API_KEY the API is open
+	assert.Equal(t, http.StatusOK, postChat(t, server, "", chatBody).StatusCode)
+
+	t.Setenv("ADMIN_API_KEY", "other-secret")
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, server, http.MethodGet, "/admin/keys", "", nil))
+	// the admin key does not grant access to the API
+	assert.Equal(t, http.StatusUnauthorized, postChat(t, server, "other-secret", chatBody).StatusCode)
+}
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	store, err := NewFileKeyStore(path)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	key := VirtualKey{ID: "key_1", KeyMetadata: KeyMetadata{Name: "ci"}, CreatedAt: time.Now().UTC()}
+	secret, err := key.newSecret()
+	require.NoError(t, err)
+	require.NoError(t, store.Put(ctx, key))
+	oldHash := key.Hash
+	_, err = key.newSecret()
+	require.NoError(t, err)
+	require.NoError(t, store.Put(ctx, key))
+
+	reopened, err := NewFileKeyStore(path)
+	require.NoError(t, err)
+	loaded, err := reopened.GetByHash(ctx, key.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", loaded.Name)
+	_, err = reopened.GetByHash(ctx, oldHash)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = reopened.Get(ctx, "key_2")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), secret)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+)
+
+// Budget limits the spend of a client, zero limits are unlimited.
+// The usage of a request is recorded once it completes, so the last request may exceed a limit.
+type Budget struct {
+	// DailyUSD and MonthlyUSD limit the estimated cost, keys with a USD limit may not use models without pricing
+	DailyUSD   float64 `json:"daily_usd,omitempty"`
+	MonthlyUSD float64 `json:"monthly_usd,omitempty"`
+	// DailyTokens and MonthlyTokens limit the total tokens
+	DailyTokens   int `json:"daily_tokens,omitempty"`
+	MonthlyTokens int `json:"monthly_tokens,omitempty"`
+}
+
+// usagePeriods returns the day and month periods of t in UTC.
+func usagePeriods(t time.Time) (day, month string) {
+	t = t.UTC()
+	return t.Format(time.DateOnly), t.Format("2006-01")
+}
+
+// checkBudget returns an error response when the client exceeded its budget
+// or when the model has no pricing and the budget limits the cost.
+func (s *LLMService) checkBudget(ctx context.Context, id *Identity, model string) *apiError {
+	budget := id.Budget
+	if budget == nil {
+		return nil
+	}
+	if (budget.DailyUSD > 0 || budget.MonthlyUSD > 0) && !s.priced(model) {
+		name, _, _ := strings.Cut(model, "?")
+		return &apiError{
+			status:  http.StatusForbidden,
+			Message: fmt.Sprintf("the model %s has no pricing, the key %s with a USD budget may not use it", name, id.Name),
+			Type:    "invalid_request_error",
+			Code:    "model_not_priced",
+		}
+	}
+
+	day, month := usagePeriods(s.now())
+	for _, limit := range []struct {
+		period string
+		name   string
+		usd    float64
+		tokens int
+	}{
+		{day, "daily", budget.DailyUSD, budget.DailyTokens},
+		{month, "monthly", budget.MonthlyUSD, budget.MonthlyTokens},
+	} {
+		if limit.usd <= 0 && limit.tokens <= 0 {
+			continue
+		}
+		usage, err := s.usage.Usage(ctx, id.ID, limit.period)
+		if err != nil {
+			slog.Error("failed to load usage", "client", id.Name, "err", err)
+			return &apiError{status: http.StatusInternalServerError, Message: "failed to load usage", Type: "server_error"}
+		}
+		exceeded := ""
+		if limit.usd > 0 && usage.Cost >= limit.usd {
+			exceeded = fmt.Sprintf("%s budget of $%g", limit.name, limit.usd)
+		} else if limit.tokens > 0 && usage.Tokens >= limit.tokens {
+			exceeded = fmt.Sprintf("%s budget of %d tokens", limit.name, limit.tokens)
+		}
+		if exceeded != "" {
+			return &apiError{
+				status:  http.StatusTooManyRequests,
+				Message: fmt.Sprintf("the key %s exceeded its %s", id.Name, exceeded),
+				Type:    "insufficient_quota",
+				Code:    "budget_exceeded",
+			}
+		}
+	}
+	return nil
+}
+
+// priced reports whether the cost of the requests to a model is known,
+// models of providers that do not describe their models are assumed to be priced.
+func (s *LLMService) priced(model string) bool {
+	describer, ok := s.provider.(ModelDescriber)
+	if !ok {
+		return true
+	}
+	m, ok := describer.GetModel(model)
+	return ok && m.Pricing != nil
+}
+
+// recordUsage adds the usage of a completed request to the day and month of the client.
+func (s *LLMService) recordUsage(ctx context.Context, id *Identity, usage llms.Usage) {
+	if id == nil {
+		return
+	}
+	record := Usage{Requests: 1, Tokens: usageTokens(usage)}
+	if usage.Cost != nil {
+		record.Cost = *usage.Cost
+	}
+	day, month := usagePeriods(s.now())
+	// the request context may be canceled once the response is sent
+	if err := s.usage.Record(context.WithoutCancel(ctx), id.ID, []string{day, month}, record); err != nil {
+		slog.Error("failed to record usage", "client", id.Name, "err", err)
+	}
+}
+
+// usageTokens returns the total tokens of a request.
+func usageTokens(usage llms.Usage) int {
+	return cmp.Or(usage.TotalTokens, usage.PromptTokens+usage.CompletionTokens)
+}
+
+// apiError is an error in the OpenAI API format.
+type apiError struct {
+	status  int
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	// retryAfter is sent in the Retry-After header when set
+	retryAfter time.Duration
+}
+
+func (e *apiError) write(w http.ResponseWriter) {
+	if e.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.retryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(map[string]*apiError{"error": e})
+}
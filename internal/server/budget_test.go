@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider replies "ok" with 100 tokens costing $1.
+type fakeProvider struct{}
+
+func (fakeProvider) ListModels(ctx context.Context) ([]llms.Model, error) {
+	return []llms.Model{{ID: "fake"}}, nil
+}
+
+// ResolveModel serves fake, the openai/ models and gpt-4o of the openai provider, fast is an alias of gpt-4o.
+func (fakeProvider) ResolveModel(model string) (string, string, bool) {
+	model, _, _ = strings.Cut(model, "?")
+	if id, ok := strings.CutPrefix(model, "openai/"); ok {
+		return "openai", id, true
+	}
+	switch model {
+	case "gpt-4o":
+		return "openai", model, true
+	case "fast":
+		return "openai", "gpt-4o", true
+	}
+	return "fake", model, model == "fake"
+}
+
+// GetModel prices the models served by the provider, other models have no pricing.
+func (f fakeProvider) GetModel(model string) (llms.Model, bool) {
+	if _, _, ok := f.ResolveModel(model); !ok {
+		return llms.Model{}, false
+	}
+	return llms.Model{ID: model, Pricing: &llms.ModelPricing{Input: 1, Output: 1}}, true
+}
+
+func (fakeProvider) ChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
+	cost := 1.0
+	usage := llms.Usage{PromptTokens: 60, CompletionTokens: 40, TotalTokens: 100, Cost: &cost}
+	if req.Stream {
+		streamingFunc(llms.StreamingChatCompletionResponse{Response: &llms.ChatCompletionResponse{
+			Choices: []llms.ChatCompletionChoice{{Delta: &llms.ChatCompletionMessage{Content: "ok"}}},
+		}})
+		streamingFunc(llms.StreamingChatCompletionResponse{Response: &llms.ChatCompletionResponse{Usage: usage}})
+		streamingFunc(llms.StreamingChatCompletionResponse{Err: io.EOF})
+		return
+	}
+	streamingFunc(llms.StreamingChatCompletionResponse{Response: &llms.ChatCompletionResponse{
+		Choices: []llms.ChatCompletionChoice{{Message: &llms.ChatCompletionMessage{Role: llms.ChatMessageRoleAssistant, Content: "ok"}}},
+		Usage:   usage,
+	}, Err: io.EOF})
+}
+
+func newTestService(t *testing.T, cfg Config) (*LLMService, *httptest.Server) {
+	t.Helper()
+	t.Setenv("API_KEY", "")
+	t.Setenv("ADMIN_API_KEY", "")
+	s, err := NewLLMService(fakeProvider{}, cfg)
+	require.NoError(t, err)
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func postChat(t *testing.T, server *httptest.Server, key, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader(body))
+	require.NoError(t, err)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func decodeAPIError(t *testing.T, resp *http.Response) apiError {
+	t.Helper()
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return body.Error
+}
+
+const chatBody = `{"model":"fake","messages":[{"role":"user","content":"hi"}]}`
+
+func TestBudget(t *testing.T) {
+	s, server := newTestService(t, Config{Keys: []KeyConfig{
+		{KeyMetadata: KeyMetadata{Name: "team-a", Models: []string{"fake"}, Budget: &Budget{DailyUSD: 2}}, Key: "key-a"},
+		{KeyMetadata: KeyMetadata{Name: "team-b", Budget: &Budget{MonthlyTokens: 150}}, Key: "key-b"},
+		{KeyMetadata: KeyMetadata{Name: "unlimited"}, Key: "key-c"},
+	}})
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	assert.Equal(t, http.StatusUnauthorized, postChat(t, server, "", chatBody).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, postChat(t, server, "wrong", chatBody).StatusCode)
+
+	t.Run("daily cost", func(t *testing.T) {
+		for range 2 {
+			resp := postChat(t, server, "key-a", chatBody)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "1", resp.Header.Get(costHeader))
+		}
+		resp := postChat(t, server, "key-a", chatBody)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		apiErr := decodeAPIError(t, resp)
+		assert.Equal(t, "budget_exceeded", apiErr.Code)
+		assert.Equal(t, "insufficient_quota", apiErr.Type)
+		assert.Contains(t, apiErr.Message, "daily budget of $2")
+
+		// the budget is reset the next day
+		now = now.Add(24 * time.Hour)
+		assert.Equal(t, http.StatusOK, postChat(t, server, "key-a", chatBody).StatusCode)
+	})
+
+	t.Run("model allowlist", func(t *testing.T) {
+		resp := postChat(t, server, "key-a", `{"model":"other","messages":[]}`)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "model_not_allowed", decodeAPIError(t, resp).Code)
+	})
+
+	t.Run("unpriced model", func(t *testing.T) {
+		s, server := newTestService(t, Config{Keys: []KeyConfig{
+			{KeyMetadata: KeyMetadata{Name: "usd", Budget: &Budget{MonthlyUSD: 10}}, Key: "key-usd"},
+			{KeyMetadata: KeyMetadata{Name: "tokens", Budget: &Budget{MonthlyTokens: 1000}}, Key: "key-tokens"},
+		}})
+		s.now = func() time.Time { return now }
+		body := `{"model":"unpriced","messages":[{"role":"user","content":"hi"}]}`
+
+		// the cost of the request is unknown, it would not be charged to the USD budget
+		resp := postChat(t, server, "key-usd", body)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		apiErr := decodeAPIError(t, resp)
+		assert.Equal(t, "model_not_priced", apiErr.Code)
+		assert.Contains(t, apiErr.Message, "the model unpriced has no pricing")
+		assert.Equal(t, http.StatusOK, postChat(t, server, "key-usd", chatBody).StatusCode)
+
+		// token budgets apply to every model
+		assert.Equal(t, http.StatusOK, postChat(t, server, "key-tokens", body).StatusCode)
+	})
+
+	t.Run("monthly tokens with streaming", func(t *testing.T) {
+		streamBody := `{"model":"fake","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+		for range 2 {
+			resp := postChat(t, server, "key-b", streamBody)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			_, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "1", resp.Trailer.Get(costHeader))
+		}
+		resp := postChat(t, server, "key-b", chatBody)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Contains(t, decodeAPIError(t, resp).Message, "monthly budget of 150 tokens")
+
+		usage, err := s.usage.Usage(context.Background(), "team-b", "2026-10")
+		require.NoError(t, err)
+		assert.Equal(t, Usage{Requests: 2, Tokens: 200, Cost: 2}, usage)
+	})
+
+	t.Run("no budget", func(t *testing.T) {
+		for range 3 {
+			assert.Equal(t, http.StatusOK, postChat(t, server, "key-c", chatBody).StatusCode)
+		}
+	})
+}
+
+func TestAPIKeyWithClientKeys(t *testing.T) {
+	_, server := newTestService(t, Config{Keys: []KeyConfig{{KeyMetadata: KeyMetadata{Name: "team-a"}, Key: "key-a"}}})
+	t.Setenv("API_KEY", "admin")
+	assert.Equal(t, http.StatusOK, postChat(t, server, "admin", chatBody).StatusCode)
+	assert.Equal(t, http.StatusOK, postChat(t, server, "key-a", chatBody).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, postChat(t, server, "key-b", chatBody).StatusCode)
+}
+
+func TestStreamUsageChunk(t *testing.T) {
+	s, server := newTestService(t, Config{Keys: []KeyConfig{{KeyMetadata: KeyMetadata{Name: "team-a"}, Key: "key-a"}}})
+	for _, tt := range []struct {
+		streamOptions string
+		chunks        int
+	}{
+		{"", 1},
+		{`"stream_options":{"include_usage":false},`, 1},
+		{`"stream_options":{"include_usage":true},`, 2},
+	} {
+		body := `{"model":"fake","stream":true,` + tt.streamOptions + `"messages":[{"role":"user","content":"hi"}]}`
+		resp := postChat(t, server, "key-a", body)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		// the usage chunk is only sent to clients asking for it, the usage is charged in any case
+		assert.Equal(t, tt.chunks+1, strings.Count(string(data), "data: "), body)
+		assert.Equal(t, tt.chunks == 2, strings.Contains(string(data), `"total_tokens":100`), body)
+		assert.Equal(t, "1", resp.Trailer.Get(costHeader))
+	}
+
+	_, month := usagePeriods(s.now())
+	usage, err := s.usage.Usage(context.Background(), "team-a", month)
+	require.NoError(t, err)
+	assert.Equal(t, 300, usage.Tokens)
+}
+
+func TestFileUsageStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage", "usage.json")
+	store, err := NewFileUsageStore(path)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, store.Record(ctx, "team-a", []string{"2026-10-18", "2026-10"}, Usage{Requests: 1, Tokens: 10, Cost: 0.5}))
+	require.NoError(t, store.Record(ctx, "team-a", []string{"2026-10-19", "2026-10"}, Usage{Requests: 1, Tokens: 5}))
+
+	reopened, err := NewFileUsageStore(path)
+	require.NoError(t, err)
+	usage, err := reopened.Usage(ctx, "team-a", "2026-10")
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Requests: 2, Tokens: 15, Cost: 0.5}, usage)
+	usage, err = reopened.Usage(ctx, "team-b", "2026-10")
+	require.NoError(t, err)
+	assert.Zero(t, usage)
+}
+
+func TestUsageStorePrunesPastMonths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	store, err := NewFileUsageStore(path)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, store.Record(ctx, "team-a", []string{"2026-09-30", "2026-09"}, Usage{Requests: 1}))
+	require.NoError(t, store.Record(ctx, "team-b", []string{"2026-09-30", "2026-09", "all"}, Usage{Requests: 1}))
+	require.NoError(t, store.Record(ctx, "team-b", []string{"2026-10-01", "2026-10"}, Usage{Requests: 1}))
+
+	// late records of a past month are kept until the next month starts
+	require.NoError(t, store.Record(ctx, "team-c", []string{"2026-09-30", "2026-09"}, Usage{Requests: 1}))
+	require.NoError(t, store.Record(ctx, "team-b", []string{"2026-11-01", "2026-11"}, Usage{Requests: 1}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var persisted map[string]map[string]Usage
+	require.NoError(t, json.Unmarshal(data, &persisted))
+	assert.Equal(t, map[string]map[string]Usage{
+		"team-b": {"2026-11-01": {Requests: 1}, "2026-11": {Requests: 1}, "all": {Requests: 1}},
+	}, persisted)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/recally-io/polyllm"
+)
+
+// Config is the configuration of the proxy server, the "server" section of the polyllm config file.
+type Config struct {
+	// Keys are the client API keys. When keys or the API_KEY env var are set, requests must use one of them.
+	Keys []KeyConfig `json:"keys,omitempty"`
+	// UsageStore is where the usage of the keys is tracked: "memory" (default) or "file:<path>" for a JSON file
+	UsageStore string `json:"usage_store,omitempty"`
+	// RateLimit limits all requests to the server, nil means unlimited
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+	// UpstreamRateLimits limit the requests to a provider, e.g. "openai", or to a model, e.g. "openai/gpt-4o"
+	UpstreamRateLimits map[string]RateLimit `json:"upstream_rate_limits,omitempty"`
+	// KeyStore is where the virtual keys of the admin API are stored: "memory" (default) or "file:<path>" for a JSON file
+	KeyStore string `json:"key_store,omitempty"`
+	// Listen configures where and how the server accepts connections
+	Listen ListenConfig `json:"listen,omitempty"`
+	// MetricsPublic serves /metrics without authentication, by default it requires the ADMIN_API_KEY
+	MetricsPublic bool `json:"metrics_public,omitempty"`
+}
+
+// ListenConfig is the listen address, timeouts and TLS settings of the server.
+// Durations are in nanoseconds like the provider timeouts, zero timeouts mean no timeout.
+type ListenConfig struct {
+	// Address is the TCP address, ":$PORT" by default with PORT defaulting to 8088, or "unix:<path>" for a unix socket
+	Address      string        `json:"address,omitempty"`
+	ReadTimeout  time.Duration `json:"read_timeout,omitempty"`
+	WriteTimeout time.Duration `json:"write_timeout,omitempty"`
+	IdleTimeout  time.Duration `json:"idle_timeout,omitempty"`
+	// ShutdownTimeout is how long in-flight requests, e.g. streaming responses, may run once the server is stopping,
+	// 30 seconds by default
+	ShutdownTimeout time.Duration `json:"shutdown_timeout,omitempty"`
+	// TLSCertFile and TLSKeyFile are the PEM files of the certificate and key to serve HTTPS with
+	TLSCertFile string `json:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `json:"tls_key_file,omitempty"`
+}
+
+// address returns the listen network and address.
+func (c ListenConfig) address() (string, string) {
+	if path, ok := strings.CutPrefix(c.Address, "unix:"); ok {
+		return "unix", path
+	}
+	if c.Address != "" {
+		return "tcp", c.Address
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8088"
+	}
+	return "tcp", ":" + port
+}
+
+// KeyConfig is a client API key of the config file, its name identifies the client in the usage store.
+type KeyConfig struct {
+	KeyMetadata
+	// Key is the bearer token of the client
+	Key string `json:"key"`
+}
+
+// LoadConfig reads the server section of a polyllm config file.
+func LoadConfig(path string) (Config, error) {
+	var file struct {
+		Server Config `json:"server"`
+	}
+	if err := polyllm.ReadConfigFile(path, &file); err != nil {
+		return Config{}, err
+	}
+	return file.Server, nil
+}
+
+// newUsageStore creates the usage store of the config.
+func (c Config) newUsageStore() (UsageStore, error) {
+	switch {
+	case c.UsageStore == "" || c.UsageStore == "memory":
+		return NewMemoryUsageStore(), nil
+	case strings.HasPrefix(c.UsageStore, "file:"):
+		return NewFileUsageStore(strings.TrimPrefix(c.UsageStore, "file:"))
+	}
+	return nil, fmt.Errorf("unsupported usage store: %s, use memory or file:<path>", c.UsageStore)
+}
+
+// newKeyStore creates the key store of the config.
+func (c Config) newKeyStore() (KeyStore, error) {
+	switch {
+	case c.KeyStore == "" || c.KeyStore == "memory":
+		return NewMemoryKeyStore(), nil
+	case strings.HasPrefix(c.KeyStore, "file:"):
+		return NewFileKeyStore(strings.TrimPrefix(c.KeyStore, "file:"))
+	}
+	return nil, fmt.Errorf("unsupported key store: %s, use memory or file:<path>", c.KeyStore)
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/recally-io/polyllm"
+)
+
+// StatusProvider is implemented by providers reporting the status of their upstream providers and MCP servers,
+// e.g. *polyllm.PolyLLM.
+type StatusProvider interface {
+	ProviderStatuses() []polyllm.ProviderStatus
+	MCPStatuses() []polyllm.MCPStatus
+}
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+type providersResponse struct {
+	Providers  []polyllm.ProviderStatus `json:"providers"`
+	MCPServers []polyllm.MCPStatus      `json:"mcp_servers"`
+	// Config is the state of the configuration when it can be reloaded
+	Config *ReloadStatus `json:"config,omitempty"`
+}
+
+// healthz reports that the process is alive.
+func (s *LLMService) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz reports whether the server can serve requests: its config is loaded,
+// at least one provider is usable and all MCP servers are initialized.
+func (s *LLMService) readyz(w http.ResponseWriter, r *http.Request) {
+	resp := readinessResponse{Status: "ready", Checks: map[string]string{"config": "ok", "providers": "ok", "mcp": "ok"}}
+	if statusProvider, ok := s.provider.(StatusProvider); ok {
+		usable := false
+		for _, status := range statusProvider.ProviderStatuses() {
+			usable = usable || status.Usable
+		}
+		if !usable {
+			resp.Checks["providers"] = "no usable provider"
+		}
+		var failed []string
+		for _, status := range statusProvider.MCPStatuses() {
+			if !status.Initialized {
+				failed = append(failed, status.Name)
+			}
+		}
+		if len(failed) > 0 {
+			resp.Checks["mcp"] = "not initialized: " + strings.Join(failed, ", ")
+		}
+	}
+	status := http.StatusOK
+	for _, check := range resp.Checks {
+		if check != "ok" {
+			resp.Status = "not_ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+// listProviders returns the status of the providers and MCP servers.
+func (s *LLMService) listProviders(w http.ResponseWriter, r *http.Request) {
+	resp := providersResponse{Providers: []polyllm.ProviderStatus{}, MCPServers: []polyllm.MCPStatus{}}
+	if statusProvider, ok := s.provider.(StatusProvider); ok {
+		resp.Providers = statusProvider.ProviderStatuses()
+		resp.MCPServers = statusProvider.MCPStatuses()
+	}
+	if reloader, ok := s.provider.(reloader); ok {
+		status := reloader.ReloadStatus()
+		resp.Config = &status
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
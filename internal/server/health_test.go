@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/recally-io/polyllm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statusProvider is a fakeProvider reporting fixed statuses.
+type statusProvider struct {
+	fakeProvider
+	providers []polyllm.ProviderStatus
+	mcps      []polyllm.MCPStatus
+}
+
+func (p statusProvider) ProviderStatuses() []polyllm.ProviderStatus { return p.providers }
+
+func (p statusProvider) MCPStatuses() []polyllm.MCPStatus { return p.mcps }
+
+func getReadiness(t *testing.T, url string) (int, readinessResponse) {
+	t.Helper()
+	resp, err := http.Get(url + "/readyz")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var body readinessResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+func TestHealth(t *testing.T) {
+	s, server := newTestService(t, Config{})
+	t.Setenv("API_KEY", "secret")
+
+	resp, err := http.Get(server.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// providers without statuses are always ready
+	status, _ := getReadiness(t, server.URL)
+	assert.Equal(t, http.StatusOK, status)
+
+	provider := statusProvider{
+		providers: []polyllm.ProviderStatus{{Name: "openai", Models: []string{"openai/gpt-4o"}, Usable: false, LastError: "unauthorized"}},
+		mcps:      []polyllm.MCPStatus{{Name: "fetch", Initialized: true}, {Name: "search", Error: "timeout"}},
+	}
+	s.provider = provider
+	status, body := getReadiness(t, server.URL)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, readinessResponse{Status: "not_ready", Checks: map[string]string{
+		"config": "ok", "providers": "no usable provider", "mcp": "not initialized: search",
+	}}, body)
+
+	provider.providers[0].Usable = true
+	provider.mcps = provider.mcps[:1]
+	s.provider = provider
+	status, body = getReadiness(t, server.URL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ready", body.Status)
+}
+
+func TestAdminProviders(t *testing.T) {
+	s, server := newTestService(t, Config{})
+	t.Setenv("ADMIN_API_KEY", "admin-secret")
+	s.provider = statusProvider{
+		providers: []polyllm.ProviderStatus{{Name: "openai", Models: []string{"openai/gpt-4o"}, Usable: true, Requests: 3, LatencyMS: 12.5}},
+		mcps:      []polyllm.MCPStatus{{Name: "fetch", Initialized: true}},
+	}
+
+	var body providersResponse
+	require.Equal(t, http.StatusOK, adminRequest(t, server, http.MethodGet, "/admin/providers", "", &body))
+	assert.Equal(t, s.provider.(statusProvider).providers, body.Providers)
+	assert.Equal(t, s.provider.(statusProvider).mcps, body.MCPServers)
+
+	resp, err := http.Get(server.URL + "/admin/providers")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// KeyMetadata describes the client of an API key and what it may do.
+type KeyMetadata struct {
+	// Name identifies the client in logs
+	Name  string `json:"name"`
+	Owner string `json:"owner,omitempty"`
+	Team  string `json:"team,omitempty"`
+	// Models are the models the client may use, empty allows all models
+	Models []string `json:"models,omitempty"`
+	// RateLimit limits the request rate of the client, nil means unlimited
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+	// Budget limits the spend of the client, nil means unlimited
+	Budget *Budget `json:"budget,omitempty"`
+	// ExpiresAt is when the key stops working, nil never expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// expired reports whether the key expired at t.
+func (m KeyMetadata) expired(t time.Time) bool {
+	return m.ExpiresAt != nil && !t.Before(*m.ExpiresAt)
+}
+
+// Identity is the authenticated client of a request.
+type Identity struct {
+	// ID identifies the client in the usage store, the name of config keys and the ID of virtual keys
+	ID string `json:"id"`
+	KeyMetadata
+}
+
+// checkModel returns an error response when the client may not use the model.
+func (id *Identity) checkModel(model string) *apiError {
+	if len(id.Models) == 0 {
+		return nil
+	}
+	name, _, _ := strings.Cut(model, "?")
+	if slices.Contains(id.Models, name) {
+		return nil
+	}
+	return &apiError{
+		status:  http.StatusForbidden,
+		Message: fmt.Sprintf("the key %s is not allowed to use the model %s", id.Name, name),
+		Type:    "invalid_request_error",
+		Code:    "model_not_allowed",
+	}
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the identity.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity of the request, nil for requests authenticated with the API_KEY env var
+// or without authentication.
+func IdentityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrKeyNotFound is returned by key stores for unknown keys.
+var ErrKeyNotFound = errors.New("key not found")
+
+const virtualKeyPrefix = "sk-polyllm-"
+
+// VirtualKey is an API key managed with the admin API. Only the hash of the secret is stored.
+type VirtualKey struct {
+	ID string `json:"id"`
+	KeyMetadata
+	// Prefix is the start of the secret, to recognize the key
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"hash,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Identity returns the identity of requests authenticated with the key.
+func (k VirtualKey) Identity() *Identity {
+	return &Identity{ID: k.ID, KeyMetadata: k.KeyMetadata}
+}
+
+// active reports whether the key may be used at t.
+func (k VirtualKey) active(t time.Time) bool {
+	return k.RevokedAt == nil && !k.expired(t)
+}
+
+// newSecret generates a new secret for the key, updating its prefix and hash.
+func (k *VirtualKey) newSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	secret := virtualKeyPrefix + hex.EncodeToString(b)
+	k.Prefix = secret[:len(virtualKeyPrefix)+6]
+	k.Hash = hashKey(secret)
+	return secret, nil
+}
+
+func newKeyID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key id: %w", err)
+	}
+	return "key_" + hex.EncodeToString(b), nil
+}
+
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyStore stores virtual keys.
+type KeyStore interface {
+	// List returns all keys, including revoked and expired keys, by creation time.
+	List(ctx context.Context) ([]VirtualKey, error)
+	// Get returns the key with the ID or ErrKeyNotFound.
+	Get(ctx context.Context, id string) (VirtualKey, error)
+	// GetByHash returns the key with the secret hash or ErrKeyNotFound.
+	GetByHash(ctx context.Context, hash string) (VirtualKey, error)
+	// Put creates or replaces the key with the ID of key.
+	Put(ctx context.Context, key VirtualKey) error
+}
+
+// MemoryKeyStore keeps keys in memory, they are lost when the server restarts.
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]VirtualKey
+	// key IDs by hash
+	hashes map[string]string
+}
+
+// NewMemoryKeyStore creates an empty in-memory key store.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string]VirtualKey), hashes: make(map[string]string)}
+}
+
+func (s *MemoryKeyStore) List(ctx context.Context) ([]VirtualKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list(), nil
+}
+
+func (s *MemoryKeyStore) list() []VirtualKey {
+	keys := make([]VirtualKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b VirtualKey) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return keys
+}
+
+func (s *MemoryKeyStore) Get(ctx context.Context, id string) (VirtualKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return VirtualKey{}, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *MemoryKeyStore) GetByHash(ctx context.Context, hash string) (VirtualKey, error) {
+	s.mu.RLock()
+	id, ok := s.hashes[hash]
+	s.mu.RUnlock()
+	if !ok {
+		return VirtualKey{}, ErrKeyNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *MemoryKeyStore) Put(ctx context.Context, key VirtualKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(key)
+	return nil
+}
+
+func (s *MemoryKeyStore) put(key VirtualKey) {
+	if old, ok := s.keys[key.ID]; ok {
+		delete(s.hashes, old.Hash)
+	}
+	s.keys[key.ID] = key
+	s.hashes[key.Hash] = key.ID
+}
+
+// FileKeyStore keeps keys in memory and persists them to a JSON file after every change.
+type FileKeyStore struct {
+	MemoryKeyStore
+	path string
+}
+
+// NewFileKeyStore opens the key store of a JSON file, the file is created on the first change.
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{MemoryKeyStore: *NewMemoryKeyStore(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key store: %w", err)
+	}
+	var keys []VirtualKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to load key store %s: %w", path, err)
+	}
+	for _, key := range keys {
+		s.put(key)
+	}
+	return s, nil
+}
+
+func (s *FileKeyStore) Put(ctx context.Context, key VirtualKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(key)
+	return writeFileAtomic(s.path, s.list())
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/recally-io/polyllm"
+	"github.com/recally-io/polyllm/llms"
+)
+
+// metric is a counter, gauge or histogram with labels, written in the Prometheus text exposition format.
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	// value of counters and gauges
+	value float64
+	// histograms: the observations per bucket, the last bucket is +Inf
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newMetric(kind, name, help string, labels ...string) *metric {
+	return &metric{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *metric {
+	m := newMetric("histogram", name, help, labels...)
+	m.buckets = buckets
+	return m
+}
+
+func (m *metric) get(labels []string) *series {
+	if len(labels) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d", m.name, len(m.labels), len(labels)))
+	}
+	key := strings.Join(labels, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labels: slices.Clone(labels)}
+		if m.kind == "histogram" {
+			s.counts = make([]uint64, len(m.buckets)+1)
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// add adds v to a counter or gauge.
+func (m *metric) add(v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(labels).value += v
+}
+
+// observe adds an observation to a histogram.
+func (m *metric) observe(v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.get(labels)
+	i, _ := slices.BinarySearch(m.buckets, v)
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+func (m *metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(m.labels, s.labels), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(m.buckets) {
+				le = m.buckets[i]
+			}
+			labels := formatLabels(append(slices.Clone(m.labels), "le"), append(slices.Clone(s.labels), formatFloat(le)))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, labels, cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, formatLabels(m.labels, s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, formatLabels(m.labels, s.labels), s.count)
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, labelValueEscaper.Replace(values[i]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	latencyBuckets  = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	toolCallBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+)
+
+// metrics are the metrics of the proxy, labeled by provider, model and key.
+type metrics struct {
+	// resolveModel returns the provider and the ID of the model of a request, nil labels all models unknown
+	resolveModel func(model string) (provider, id string, ok bool)
+
+	requests         *metric
+	errors           *metric
+	duration         *metric
+	timeToFirstToken *metric
+	tokens           *metric
+	cost             *metric
+	streams          *metric
+	toolCalls        *metric
+	toolCallDuration *metric
+}
+
+func newMetrics() *metrics {
+	labels := []string{"provider", "model", "key"}
+	with := func(extra ...string) []string { return append(slices.Clone(labels), extra...) }
+	return &metrics{
+		requests:         newMetric("counter", "polyllm_requests_total", "Chat completion requests.", labels...),
+		errors:           newMetric("counter", "polyllm_request_errors_total", "Failed chat completion requests by error class.", with("class")...),
+		duration:         newHistogram("polyllm_request_duration_seconds", "Total latency of chat completion requests.", latencyBuckets, labels...),
+		timeToFirstToken: newHistogram("polyllm_time_to_first_token_seconds", "Latency of the first chunk of streaming chat completions.", latencyBuckets, labels...),
+		tokens:           newMetric("counter", "polyllm_tokens_total", "Tokens of chat completions by direction, input or output.", with("direction")...),
+		cost:             newMetric("counter", "polyllm_cost_usd_total", "Estimated cost of chat completions in USD.", labels...),
+		streams:          newMetric("gauge", "polyllm_streams_in_flight", "Streaming chat completions in progress.", labels...),
+		toolCalls:        newMetric("counter", "polyllm_tool_calls_total", "Tool calls executed by the agent loop by status, success or error.", with("tool", "status")...),
+		toolCallDuration: newHistogram("polyllm_tool_call_duration_seconds", "Duration of tool calls executed by the agent loop.", toolCallBuckets, with("tool")...),
+	}
+}
+
+// unknownModel is the provider and model label of the requests of models served by no provider or not allowed,
+// so that clients cannot create series with arbitrary model names.
+const unknownModel = "unknown"
+
+// requestLabels returns the provider, model and key labels of a request.
+func (m *metrics) requestLabels(id *Identity, model string) []string {
+	provider, resolved, ok := "", "", false
+	if m.resolveModel != nil {
+		provider, resolved, ok = m.resolveModel(model)
+	}
+	if !ok {
+		return unknownLabels(id)
+	}
+	return []string{provider, resolved, keyLabel(id)}
+}
+
+// unknownLabels returns the labels of a request of an unknown or rejected model.
+func unknownLabels(id *Identity) []string {
+	return []string{unknownModel, unknownModel, keyLabel(id)}
+}
+
+func keyLabel(id *Identity) string {
+	if id == nil {
+		return ""
+	}
+	return id.ID
+}
+
+// completionResult is the outcome of a chat completion sent to the provider.
+type completionResult struct {
+	usage llms.Usage
+	// timeToFirstToken is the latency of the first chunk of streaming responses
+	timeToFirstToken time.Duration
+	err              error
+}
+
+// observeRequest records a chat completion request, class is the error class of failed requests.
+func (m *metrics) observeRequest(labels []string, class string, duration time.Duration, result completionResult) {
+	m.requests.add(1, labels...)
+	m.duration.observe(duration.Seconds(), labels...)
+	if class != "" {
+		m.errors.add(1, append(slices.Clone(labels), class)...)
+	}
+	if result.timeToFirstToken > 0 {
+		m.timeToFirstToken.observe(result.timeToFirstToken.Seconds(), labels...)
+	}
+	if result.usage.PromptTokens > 0 || result.usage.CompletionTokens > 0 {
+		m.tokens.add(float64(result.usage.PromptTokens), append(slices.Clone(labels), "input")...)
+		m.tokens.add(float64(result.usage.CompletionTokens), append(slices.Clone(labels), "output")...)
+	}
+	if result.usage.Cost != nil {
+		m.cost.add(*result.usage.Cost, labels...)
+	}
+}
+
+// observeToolCall records a tool call of the agent loop, it is the ToolCallHook of the provider.
+func (m *metrics) observeToolCall(ctx context.Context, info polyllm.ToolCallInfo) {
+	labels := append(m.requestLabels(IdentityFromContext(ctx), info.Model), info.Tool)
+	status := "success"
+	if info.Err != nil {
+		status = "error"
+	}
+	m.toolCalls.add(1, append(slices.Clone(labels), status)...)
+	m.toolCallDuration.observe(info.Duration.Seconds(), labels...)
+}
+
+// errorClass returns the error class of a chat completion error.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, polyllm.ErrProviderNotFound):
+		return "not_found"
+	case errors.Is(err, polyllm.ErrUnsupportedCapability), errors.Is(err, polyllm.ErrContextWindowExceeded):
+		return "invalid_request"
+	case errors.Is(err, polyllm.ErrCircuitOpen):
+		return "circuit_open"
+	}
+	return "upstream_error"
+}
+
+func (m *metrics) writeTo(w io.Writer) {
+	for _, metric := range []*metric{
+		m.requests, m.errors, m.duration, m.timeToFirstToken, m.tokens, m.cost, m.streams, m.toolCalls, m.toolCallDuration,
+	} {
+		metric.write(w)
+	}
+}
+
+// serveMetrics serves the metrics in the Prometheus text exposition format.
+func (s *LLMService) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	s.metrics.writeTo(bw)
+	bw.Flush()
+}
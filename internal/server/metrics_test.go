@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/recally-io/polyllm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricExposition(t *testing.T) {
+	counter := newMetric("counter", "test_total", "A counter.", "name")
+	counter.add(1, `a"b`)
+	counter.add(2.5, `a"b`)
+	histogram := newHistogram("test_seconds", "A histogram.", []float64{0.1, 1}, "name")
+	histogram.observe(0.1, "x")
+	histogram.observe(0.5, "x")
+	histogram.observe(3, "x")
+
+	var b strings.Builder
+	counter.write(&b)
+	histogram.write(&b)
+	assert.Equal(t, `# HELP test_total A counter.
+# TYPE test_total counter
+test_total{name="a\"b"} 3.5
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{name="x",le="0.1"} 1
+test_seconds_bucket{name="x",le="1"} 2
+test_seconds_bucket{name="x",le="+Inf"} 3
+test_seconds_sum{name="x"} 3.6
+test_seconds_count{name="x"} 3
+`, b.String())
+}
+
+func getMetrics(t *testing.T, server *httptest.Server, key string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/metrics", nil)
+	require.NoError(t, err)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestMetricsPublic(t *testing.T) {
+	_, server := newTestService(t, Config{MetricsPublic: true})
+	resp := getMetrics(t, server, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+}
+
+func TestMetrics(t *testing.T) {
+	s, server := newTestService(t, Config{Keys: []KeyConfig{
+		{KeyMetadata: KeyMetadata{Name: "team-a", Models: []string{"openai/gpt-4o"}}, Key: "key-a"},
+	}})
+	body := `{"model":"openai/gpt-4o?mcp=all","messages":[{"role":"user","content":"hi"}]}`
+	require.Equal(t, http.StatusOK, postChat(t, server, "key-a", body).StatusCode)
+	resp := postChat(t, server, "key-a", strings.Replace(body, `"messages"`, `"stream":true,"messages"`, 1))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, postChat(t, server, "key-a", chatBody).StatusCode)
+
+	ctx := WithIdentity(context.Background(), &Identity{ID: "team-a"})
+	s.metrics.observeToolCall(ctx, polyllm.ToolCallInfo{Model: "openai/gpt-4o?tools=all", Tool: "search", Duration: 20 * time.Millisecond})
+	s.metrics.observeToolCall(ctx, polyllm.ToolCallInfo{Model: "openai/gpt-4o?tools=all", Tool: "search", Duration: time.Second, Err: errors.New("boom")})
+
+	resp = getMetrics(t, server, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	t.Setenv("ADMIN_API_KEY", "admin")
+	assert.Equal(t, http.StatusUnauthorized, getMetrics(t, server, "key-a").StatusCode)
+	resp = getMetrics(t, server, "admin")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	exposition := string(data)
+
+	labels := `provider="openai",model="gpt-4o",key="team-a"`
+	for _, line := range []string{
+		`polyllm_requests_total{` + labels + `} 2`,
+		`polyllm_requests_total{provider="unknown",model="unknown",key="team-a"} 1`,
+		`polyllm_request_errors_total{provider="unknown",model="unknown",key="team-a",class="model_not_allowed"} 1`,
+		`polyllm_request_duration_seconds_count{` + labels + `} 2`,
+		`polyllm_time_to_first_token_seconds_count{` + labels + `} 1`,
+		`polyllm_tokens_total{` + labels + `,direction="input"} 120`,
+		`polyllm_tokens_total{` + labels + `,direction="output"} 80`,
+		`polyllm_cost_usd_total{` + labels + `} 2`,
+		`polyllm_streams_in_flight{` + labels + `} 0`,
+		`polyllm_tool_calls_total{` + labels + `,tool="search",status="success"} 1`,
+		`polyllm_tool_calls_total{` + labels + `,tool="search",status="error"} 1`,
+		`polyllm_tool_call_duration_seconds_bucket{` + labels + `,tool="search",le="0.05"} 1`,
+		`polyllm_tool_call_duration_seconds_count{` + labels + `,tool="search"} 2`,
+	} {
+		assert.Contains(t, exposition, line+"\n")
+	}
+	assert.NotContains(t, exposition, "polyllm_request_errors_total{"+labels)
+}
+
+func TestMetricsBoundedModelLabels(t *testing.T) {
+	s, server := newTestService(t, Config{})
+	for i := range 50 {
+		body := strings.Replace(chatBody, `"model":"fake"`, fmt.Sprintf(`"model":"random-%d/model-%d"`, i, i), 1)
+		require.Equal(t, http.StatusOK, postChat(t, server, "", body).StatusCode)
+	}
+	require.Equal(t, http.StatusOK, postChat(t, server, "", chatBody).StatusCode)
+
+	var b strings.Builder
+	s.metrics.writeTo(&b)
+	var series []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(line, "polyllm_requests_total{") {
+			series = append(series, line)
+		}
+	}
+	assert.Equal(t, []string{
+		`polyllm_requests_total{provider="fake",model="fake",key=""} 1`,
+		`polyllm_requests_total{provider="unknown",model="unknown",key=""} 50`,
+	}, series)
+}
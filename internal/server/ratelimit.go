@@ -0,0 +1,271 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/tokenizer"
+)
+
+// RateLimit limits the requests and tokens per minute, zero limits are unlimited.
+type RateLimit struct {
+	RequestsPerMinute int `json:"rpm,omitempty"`
+	TokensPerMinute   int `json:"tpm,omitempty"`
+}
+
+// tokenBucket holds up to capacity tokens and refills capacity tokens per minute.
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	return &tokenBucket{capacity: float64(perMinute), tokens: float64(perMinute), last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+b.capacity*elapsed.Minutes())
+		b.last = now
+	}
+}
+
+// wait returns how long until n tokens are available.
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.capacity * float64(time.Minute))
+}
+
+// add returns n tokens to the bucket, negative n takes tokens even below zero.
+func (b *tokenBucket) add(n float64) {
+	b.tokens = math.Min(b.capacity, b.tokens+n)
+}
+
+// rateLimitScope is a rate limit applying to a request, e.g. the limit of its key or of its upstream model.
+type rateLimitScope struct {
+	// key identifies the buckets of the scope, name describes it in errors
+	key   string
+	name  string
+	limit RateLimit
+}
+
+type scopeBuckets struct {
+	limit    RateLimit
+	requests *tokenBucket
+	tokens   *tokenBucket
+}
+
+// rateLimiter enforces the rate limits of scopes with token buckets.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*scopeBuckets
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*scopeBuckets)}
+}
+
+// rateLimitStatus is the state of the most restrictive limits of a request, sent in the x-ratelimit-* headers.
+type rateLimitStatus struct {
+	requests, tokens *bucketStatus
+}
+
+type bucketStatus struct {
+	limit     int
+	remaining int
+	reset     time.Duration
+}
+
+func newBucketStatus(b *tokenBucket) *bucketStatus {
+	return &bucketStatus{
+		limit:     int(b.capacity),
+		remaining: max(0, int(b.tokens)),
+		reset:     b.wait(b.capacity),
+	}
+}
+
+// reservation is the tokens taken from the buckets of a request, reconciled once its usage is known.
+type reservation struct {
+	limiter *rateLimiter
+	tokens  []reservedTokens
+}
+
+type reservedTokens struct {
+	bucket *tokenBucket
+	n      float64
+}
+
+// reconcile replaces the estimated tokens of the reservation with the tokens used,
+// the estimate is kept when the usage is unknown.
+func (r *reservation) reconcile(used int) {
+	if r == nil || used <= 0 {
+		return
+	}
+	r.limiter.mu.Lock()
+	defer r.limiter.mu.Unlock()
+	for _, reserved := range r.tokens {
+		reserved.bucket.add(reserved.n - float64(used))
+	}
+}
+
+// reserve takes a request and the estimated tokens from the buckets of all scopes,
+// or nothing when a limit is exceeded and it returns a 429 error response with the time to wait.
+func (l *rateLimiter) reserve(scopes []rateLimitScope, tokens int, now time.Time) (*reservation, rateLimitStatus, *apiError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := make([]*scopeBuckets, len(scopes))
+	for i, scope := range scopes {
+		buckets[i] = l.scopeBuckets(scope, now)
+	}
+
+	var status rateLimitStatus
+	for i, b := range buckets {
+		if b.requests != nil {
+			if wait := b.requests.wait(1); wait > 0 {
+				return nil, rateLimitStatus{requests: newBucketStatus(b.requests)}, rateLimitError(scopes[i].name, "requests", b.limit.RequestsPerMinute, wait)
+			}
+		}
+		if b.tokens != nil {
+			if wait := b.tokens.wait(reservedTokenCount(b.tokens, tokens)); wait > 0 {
+				return nil, rateLimitStatus{tokens: newBucketStatus(b.tokens)}, rateLimitError(scopes[i].name, "tokens", b.limit.TokensPerMinute, wait)
+			}
+		}
+	}
+
+	r := &reservation{limiter: l}
+	for _, b := range buckets {
+		if b.requests != nil {
+			b.requests.add(-1)
+			status.requests = lowerRemaining(status.requests, newBucketStatus(b.requests))
+		}
+		if b.tokens != nil {
+			n := reservedTokenCount(b.tokens, tokens)
+			b.tokens.add(-n)
+			r.tokens = append(r.tokens, reservedTokens{bucket: b.tokens, n: n})
+			status.tokens = lowerRemaining(status.tokens, newBucketStatus(b.tokens))
+		}
+	}
+	return r, status, nil
+}
+
+// scopeBuckets returns the refilled buckets of a scope, the buckets are replaced when the limit of the scope changes.
+func (l *rateLimiter) scopeBuckets(scope rateLimitScope, now time.Time) *scopeBuckets {
+	b, ok := l.buckets[scope.key]
+	if !ok || b.limit != scope.limit {
+		b = &scopeBuckets{limit: scope.limit}
+		if scope.limit.RequestsPerMinute > 0 {
+			b.requests = newTokenBucket(scope.limit.RequestsPerMinute, now)
+		}
+		if scope.limit.TokensPerMinute > 0 {
+			b.tokens = newTokenBucket(scope.limit.TokensPerMinute, now)
+		}
+		l.buckets[scope.key] = b
+	}
+	if b.requests != nil {
+		b.requests.refill(now)
+	}
+	if b.tokens != nil {
+		b.tokens.refill(now)
+	}
+	return b
+}
+
+// reservedTokenCount caps the tokens of a request to the capacity of the bucket,
+// requests larger than the limit wait for a full bucket instead of never passing.
+func reservedTokenCount(b *tokenBucket, tokens int) float64 {
+	return math.Min(b.capacity, float64(tokens))
+}
+
+func lowerRemaining(a, b *bucketStatus) *bucketStatus {
+	if a == nil || b.remaining < a.remaining {
+		return b
+	}
+	return a
+}
+
+func rateLimitError(scope, kind string, limit int, wait time.Duration) *apiError {
+	return &apiError{
+		status:     http.StatusTooManyRequests,
+		Message:    fmt.Sprintf("rate limit of %d %s per minute reached for %s, retry in %s", limit, kind, scope, formatReset(wait)),
+		Type:       kind,
+		Code:       "rate_limit_exceeded",
+		retryAfter: wait,
+	}
+}
+
+// writeHeaders sets the x-ratelimit-* headers in the format of the OpenAI API.
+func (s rateLimitStatus) writeHeaders(h http.Header) {
+	for kind, status := range map[string]*bucketStatus{"requests": s.requests, "tokens": s.tokens} {
+		if status == nil {
+			continue
+		}
+		h.Set("x-ratelimit-limit-"+kind, strconv.Itoa(status.limit))
+		h.Set("x-ratelimit-remaining-"+kind, strconv.Itoa(status.remaining))
+		h.Set("x-ratelimit-reset-"+kind, formatReset(status.reset))
+	}
+}
+
+func formatReset(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// rateLimitScopes returns the limits applying to a request: the global limit, the limit of its key,
+// and the limits of its upstream provider and model, the model being named <provider>/<upstream model ID>
+// so that prefixes and aliases share the limits of the model they resolve to.
+func (s *LLMService) rateLimitScopes(id *Identity, model string) []rateLimitScope {
+	var scopes []rateLimitScope
+	if s.rateLimit != nil {
+		scopes = append(scopes, rateLimitScope{key: "server", name: "the server", limit: *s.rateLimit})
+	}
+	if id != nil && id.RateLimit != nil {
+		scopes = append(scopes, rateLimitScope{key: "key:" + id.ID, name: "the key " + id.Name, limit: *id.RateLimit})
+	}
+	provider, upstream, ok := s.resolveModel(model)
+	if !ok {
+		return scopes
+	}
+	if limit, ok := s.upstreamRateLimits[provider]; ok {
+		scopes = append(scopes, rateLimitScope{key: "upstream:" + provider, name: "the provider " + provider, limit: limit})
+	}
+	upstream = provider + "/" + upstream
+	if limit, ok := s.upstreamRateLimits[upstream]; ok {
+		scopes = append(scopes, rateLimitScope{key: "upstream:" + upstream, name: "the model " + upstream, limit: limit})
+	}
+	return scopes
+}
+
+// estimateTokens estimates the tokens of a request before it is sent: its prompt and its maximum completion.
+func estimateTokens(req llms.ChatCompletionRequest) int {
+	return tokenizer.CountRequest(tokenizer.ForModel(req.Model), req) + cmp.Or(req.MaxCompletionTokens, req.MaxTokens)
+}
+
+// checkRateLimit reserves a request in the rate limits applying to it and sets the x-ratelimit-* headers.
+func (s *LLMService) checkRateLimit(w http.ResponseWriter, id *Identity, req llms.ChatCompletionRequest) (*reservation, *apiError) {
+	scopes := s.rateLimitScopes(id, req.Model)
+	if len(scopes) == 0 {
+		return nil, nil
+	}
+	tokens := 0
+	for _, scope := range scopes {
+		if scope.limit.TokensPerMinute > 0 {
+			tokens = estimateTokens(req)
+			break
+		}
+	}
+	r, status, apiErr := s.limiter.reserve(scopes, tokens, s.now())
+	status.writeHeaders(w.Header())
+	return r, apiErr
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	scopes := []rateLimitScope{
+		{key: "server", name: "the server", limit: RateLimit{RequestsPerMinute: 2}},
+		{key: "key:a", name: "the key a", limit: RateLimit{TokensPerMinute: 1000}},
+	}
+
+	r, status, apiErr := limiter.reserve(scopes, 600, now)
+	require.Nil(t, apiErr)
+	assert.Equal(t, &bucketStatus{limit: 2, remaining: 1, reset: 30 * time.Second}, status.requests)
+	assert.Equal(t, &bucketStatus{limit: 1000, remaining: 400, reset: 36 * time.Second}, status.tokens)
+
+	// the tokens bucket is full enough once the request used fewer tokens than estimated
+	_, _, apiErr = limiter.reserve(scopes, 600, now)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, "tokens", apiErr.Type)
+	assert.Equal(t, 12*time.Second, apiErr.retryAfter)
+	r.reconcile(100)
+	_, status, apiErr = limiter.reserve(scopes, 600, now)
+	require.Nil(t, apiErr)
+	assert.Equal(t, 300, status.tokens.remaining)
+
+	_, status, apiErr = limiter.reserve(scopes, 10, now)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, "requests", apiErr.Type)
+	assert.Equal(t, "rate_limit_exceeded", apiErr.Code)
+	assert.Equal(t, 30*time.Second, apiErr.retryAfter)
+	assert.Equal(t, 0, status.requests.remaining)
+
+	// a rejected request takes nothing and buckets refill over time
+	_, _, apiErr = limiter.reserve(scopes, 10, now.Add(30*time.Second))
+	assert.Nil(t, apiErr)
+
+	// requests larger than the limit pass once the bucket is full
+	_, _, apiErr = limiter.reserve(scopes[1:], 5000, now.Add(2*time.Minute))
+	assert.Nil(t, apiErr)
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	s, server := newTestService(t, Config{
+		Keys:               []KeyConfig{{KeyMetadata: KeyMetadata{Name: "team-a", RateLimit: &RateLimit{RequestsPerMinute: 2, TokensPerMinute: 10000}}, Key: "key-a"}},
+		UpstreamRateLimits: map[string]RateLimit{"fake": {RequestsPerMinute: 3}},
+	})
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	resp := postChat(t, server, "key-a", chatBody)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("x-ratelimit-limit-requests"))
+	assert.Equal(t, "1", resp.Header.Get("x-ratelimit-remaining-requests"))
+	assert.Equal(t, "30s", resp.Header.Get("x-ratelimit-reset-requests"))
+	assert.Equal(t, "10000", resp.Header.Get("x-ratelimit-limit-tokens"))
+	remaining, err := strconv.Atoi(resp.Header.Get("x-ratelimit-remaining-tokens"))
+	require.NoError(t, err)
+	assert.Greater(t, remaining, 9900)
+
+	// the 100 tokens used replace the estimate
+	resp = postChat(t, server, "key-a", chatBody)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	remaining, err = strconv.Atoi(resp.Header.Get("x-ratelimit-remaining-tokens"))
+	require.NoError(t, err)
+	assert.Less(t, remaining, 9900)
+
+	resp = postChat(t, server, "key-a", chatBody)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "30", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "0", resp.Header.Get("x-ratelimit-remaining-requests"))
+	apiErr := decodeAPIError(t, resp)
+	assert.Equal(t, "rate_limit_exceeded", apiErr.Code)
+	assert.Contains(t, apiErr.Message, "the key team-a")
+
+	// the upstream limit applies to all clients
+	t.Setenv("API_KEY", "admin")
+	resp = postChat(t, server, "admin", chatBody)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get("x-ratelimit-remaining-requests"))
+	resp = postChat(t, server, "admin", chatBody)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Contains(t, decodeAPIError(t, resp).Message, "the provider fake")
+}
+
+func TestRateLimitScopes(t *testing.T) {
+	s, _ := newTestService(t, Config{
+		RateLimit:          &RateLimit{RequestsPerMinute: 100},
+		UpstreamRateLimits: map[string]RateLimit{"openai": {RequestsPerMinute: 50}, "openai/gpt-4o": {TokensPerMinute: 1000}},
+	})
+	keys := func(scopes []rateLimitScope) []string {
+		var keys []string
+		for _, scope := range scopes {
+			keys = append(keys, scope.key)
+		}
+		return keys
+	}
+	id := &Identity{ID: "key_1", KeyMetadata: KeyMetadata{Name: "ci", RateLimit: &RateLimit{RequestsPerMinute: 10}}}
+	assert.Equal(t, []string{"server", "key:key_1", "upstream:openai", "upstream:openai/gpt-4o"}, keys(s.rateLimitScopes(id, "openai/gpt-4o?mcp=all")))
+	assert.Equal(t, []string{"server", "upstream:openai"}, keys(s.rateLimitScopes(nil, "openai/gpt-4o-mini")))
+	// models without a prefix and aliases get the limits of the model they resolve to
+	assert.Equal(t, []string{"server", "upstream:openai", "upstream:openai/gpt-4o"}, keys(s.rateLimitScopes(nil, "gpt-4o")))
+	assert.Equal(t, []string{"server", "upstream:openai", "upstream:openai/gpt-4o"}, keys(s.rateLimitScopes(nil, "fast")))
+	assert.Equal(t, []string{"server"}, keys(s.rateLimitScopes(nil, "unknown/gpt-4o")))
+}
+
+func TestUpstreamRateLimitWithoutPrefix(t *testing.T) {
+	_, server := newTestService(t, Config{UpstreamRateLimits: map[string]RateLimit{"openai": {RequestsPerMinute: 1}}})
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+
+	assert.Equal(t, http.StatusOK, postChat(t, server, "", body).StatusCode)
+	resp := postChat(t, server, "", body)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Contains(t, decodeAPIError(t, resp).Message, "the provider openai")
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/recally-io/polyllm"
+	"github.com/recally-io/polyllm/llms"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+var configPollInterval = 2 * time.Second
+
+// ReloadStatus is the state of the configuration of a reloadable provider.
+type ReloadStatus struct {
+	Path     string    `json:"path"`
+	LoadedAt time.Time `json:"loaded_at"`
+	// LastError is the error of the last reload, the previous configuration is kept when a reload fails
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// providerGeneration is a PolyLLM built from a version of the configuration and its in-flight requests.
+type providerGeneration struct {
+	*polyllm.PolyLLM
+	inflight sync.WaitGroup
+}
+
+// reloadableProvider serves requests with the PolyLLM of the current configuration.
+// Reloading the configuration file builds a new PolyLLM, the previous one is closed once its in-flight requests finish.
+type reloadableProvider struct {
+	path         string
+	toolCallHook func(ctx context.Context, info polyllm.ToolCallInfo)
+
+	// reloadMu serializes reloads
+	reloadMu sync.Mutex
+	// mu guards the current generation and the reload status
+	mu      sync.RWMutex
+	current *providerGeneration
+	status  ReloadStatus
+}
+
+func newReloadableProvider(path string, cfg polyllm.Config) *reloadableProvider {
+	return &reloadableProvider{
+		path:    path,
+		current: &providerGeneration{PolyLLM: polyllm.NewFromConfig(cfg)},
+		status:  ReloadStatus{Path: path, LoadedAt: time.Now()},
+	}
+}
+
+// acquire returns the current generation, release must be called once the request finishes.
+func (r *reloadableProvider) acquire() (*providerGeneration, func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	g := r.current
+	g.inflight.Add(1)
+	return g, g.inflight.Done
+}
+
+func (r *reloadableProvider) ListModels(ctx context.Context) ([]llms.Model, error) {
+	g, release := r.acquire()
+	defer release()
+	return g.ListModels(ctx)
+}
+
+func (r *reloadableProvider) ChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
+	g, release := r.acquire()
+	defer release()
+	g.ChatCompletion(ctx, req, streamingFunc, options...)
+}
+
+func (r *reloadableProvider) ResolveModel(model string) (string, string, bool) {
+	g, release := r.acquire()
+	defer release()
+	return g.ResolveModel(model)
+}
+
+func (r *reloadableProvider) ProviderStatuses() []polyllm.ProviderStatus {
+	g, release := r.acquire()
+	defer release()
+	return g.ProviderStatuses()
+}
+
+func (r *reloadableProvider) MCPStatuses() []polyllm.MCPStatus {
+	g, release := r.acquire()
+	defer release()
+	return g.MCPStatuses()
+}
+
+// SetToolCallHook sets the tool call hook of the current and the next generations.
+func (r *reloadableProvider) SetToolCallHook(hook func(ctx context.Context, info polyllm.ToolCallInfo)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.toolCallHook = hook
+	r.current.ToolCallHook = hook
+}
+
+func (r *reloadableProvider) ReloadStatus() ReloadStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
+
+// Reload builds a new PolyLLM from the config file and switches to it. Configs that cannot be loaded,
+// without usable provider or whose MCP servers fail to start are rejected and the current configuration is kept.
+func (r *reloadableProvider) Reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	if r.path == "" {
+		return errors.New("the server was started without a config file")
+	}
+
+	err := r.reload()
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		slog.Error("Rejected configuration, keeping the previous one", "path", r.path, "err", err)
+		r.status.LastError = err.Error()
+		r.status.LastErrorAt = &now
+		return err
+	}
+	slog.Info("Reloaded configuration", "path", r.path)
+	r.status = ReloadStatus{Path: r.path, LoadedAt: now}
+	return nil
+}
+
+func (r *reloadableProvider) reload() error {
+	cfg, err := polyllm.LoadConfig(r.path)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	cfg.ToolCallHook = r.toolCallHook
+	r.mu.RUnlock()
+	next := polyllm.NewFromConfig(cfg)
+	if err := checkProvider(next); err != nil {
+		if closeErr := next.Close(); closeErr != nil {
+			slog.Error("Error closing MCP clients", "err", closeErr)
+		}
+		return err
+	}
+
+	r.mu.Lock()
+	previous := r.current
+	r.current = &providerGeneration{PolyLLM: next}
+	r.mu.Unlock()
+	go func() {
+		previous.inflight.Wait()
+		if err := previous.Close(); err != nil {
+			slog.Error("Error closing MCP clients", "err", err)
+		}
+	}()
+	return nil
+}
+
+// checkProvider returns an error when no provider is usable or an MCP server is not initialized.
+func checkProvider(p *polyllm.PolyLLM) error {
+	usable := false
+	for _, status := range p.ProviderStatuses() {
+		usable = usable || status.Usable
+	}
+	if !usable {
+		return errors.New("no usable provider")
+	}
+	var failed []string
+	for _, status := range p.MCPStatuses() {
+		if !status.Initialized {
+			failed = append(failed, status.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("MCP servers not initialized: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Close closes the current generation, once its in-flight requests finish.
+func (r *reloadableProvider) Close() error {
+	r.mu.RLock()
+	g := r.current
+	r.mu.RUnlock()
+	g.inflight.Wait()
+	return g.Close()
+}
+
+// watch reloads the configuration when the config file changes, until ctx is done.
+func (r *reloadableProvider) watch(ctx context.Context) {
+	if r.path == "" {
+		return
+	}
+	modTime := func() time.Time {
+		info, err := os.Stat(r.path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	last := modTime()
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if current := modTime(); !current.IsZero() && !current.Equal(last) {
+				last = current
+				r.Reload()
+			}
+		}
+	}
+}
+
+// reloader is implemented by providers whose configuration can be reloaded.
+type reloader interface {
+	Reload() error
+	ReloadStatus() ReloadStatus
+}
+
+// reloadConfig reloads the configuration of the provider.
+func (s *LLMService) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	reloader, ok := s.provider.(reloader)
+	if !ok {
+		(&apiError{status: http.StatusNotImplemented, Message: "the provider does not support reloading", Type: "server_error"}).write(w)
+		return
+	}
+	if err := reloader.Reload(); err != nil {
+		(&apiError{status: http.StatusUnprocessableEntity, Message: err.Error(), Type: "invalid_config"}).write(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, reloader.ReloadStatus())
+}
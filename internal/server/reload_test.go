@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/recally-io/polyllm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeMockConfig(t *testing.T, path, model string) {
+	t.Helper()
+	config := `{"llms": [{"type": "mock", "name": "reload-mock", "models": [{"id": "` + model + `"}]}]}`
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+}
+
+func newReloadableTestProvider(t *testing.T, model string) (*reloadableProvider, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeMockConfig(t, path, model)
+	cfg, err := polyllm.LoadConfig(path)
+	require.NoError(t, err)
+	r := newReloadableProvider(path, cfg)
+	t.Cleanup(func() { r.Close() })
+	return r, path
+}
+
+func modelIDs(t *testing.T, r *reloadableProvider) []string {
+	t.Helper()
+	models, err := r.ListModels(context.Background())
+	require.NoError(t, err)
+	var ids []string
+	for _, model := range models {
+		ids = append(ids, model.ID)
+	}
+	return ids
+}
+
+func TestReload(t *testing.T) {
+	r, path := newReloadableTestProvider(t, "echo-a")
+	t.Setenv("API_KEY", "")
+	t.Setenv("ADMIN_API_KEY", "admin-secret")
+	s, err := NewLLMService(r, Config{})
+	require.NoError(t, err)
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	assert.Contains(t, modelIDs(t, r), "echo-a")
+
+	// requests in flight keep the generation they started with
+	previous, release := r.acquire()
+	writeMockConfig(t, path, "echo-b")
+	var status ReloadStatus
+	require.Equal(t, http.StatusOK, adminRequest(t, server, http.MethodPost, "/admin/reload", "", &status))
+	assert.Equal(t, path, status.Path)
+	assert.Empty(t, status.LastError)
+	assert.Contains(t, modelIDs(t, r), "echo-b")
+	assert.NotContains(t, modelIDs(t, r), "echo-a")
+	assert.NotSame(t, previous, r.current)
+	release()
+
+	// invalid configs are rejected and the previous configuration is kept
+	require.NoError(t, os.WriteFile(path, []byte(`{"llms": [`), 0o600))
+	assert.Equal(t, http.StatusUnprocessableEntity, adminRequest(t, server, http.MethodPost, "/admin/reload", "", nil))
+	require.NoError(t, os.WriteFile(path, []byte(`{"llms": [{"type": "unknown", "name": "reload-unknown", "api_key": "key"}]}`), 0o600))
+	assert.ErrorContains(t, r.Reload(), "no usable provider")
+	assert.Contains(t, modelIDs(t, r), "echo-b")
+
+	var providers providersResponse
+	require.Equal(t, http.StatusOK, adminRequest(t, server, http.MethodGet, "/admin/providers", "", &providers))
+	require.NotNil(t, providers.Config)
+	assert.Equal(t, "no usable provider", providers.Config.LastError)
+	assert.NotNil(t, providers.Config.LastErrorAt)
+}
+
+func TestReloadWatch(t *testing.T) {
+	configPollInterval = 5 * time.Millisecond
+	t.Cleanup(func() { configPollInterval = 2 * time.Second })
+	r, path := newReloadableTestProvider(t, "echo-a")
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go r.watch(ctx)
+	// let the watcher read the modification time of the initial config
+	time.Sleep(20 * time.Millisecond)
+
+	writeMockConfig(t, path, "echo-b")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	assert.Eventually(t, func() bool {
+		return slices.Contains(modelIDs(t, r), "echo-b")
+	}, time.Second, 5*time.Millisecond)
+}
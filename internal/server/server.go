@@ -1,39 +1,115 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/recally-io/polyllm"
 )
 
-func StartServer(cfg polyllm.Config) {
-	mux := http.NewServeMux()
-	provider := polyllm.NewFromConfig(cfg)
-	llmService := NewLLMService(provider)
-	mux.HandleFunc("POST /chat/completions", loggingMiddleware(authMiddleware(llmService.chatCompletion)))
-	mux.HandleFunc("POST /v1/chat/completions", loggingMiddleware(authMiddleware(llmService.chatCompletion)))
+// StartServer serves the providers of cfg until SIGINT or SIGTERM. The provider configuration is reloaded
+// from configPath, if any, when the file changes, on SIGHUP and with the admin API.
+func StartServer(configPath string, cfg polyllm.Config, serverCfg Config) {
+	shutdownTracing, err := SetupTracing(context.Background())
+	if err != nil {
+		slog.Error("Error setting up tracing", "err", err)
+		return
+	}
+	defer shutdownTracing(context.Background())
 
-	mux.HandleFunc("GET /models", loggingMiddleware(authMiddleware(llmService.listModels)))
-	mux.HandleFunc("GET /v1/models", loggingMiddleware(authMiddleware(llmService.listModels)))
+	provider := newReloadableProvider(configPath, cfg)
+	defer func() {
+		if err := provider.Close(); err != nil {
+			slog.Error("Error closing MCP clients", "err", err)
+		}
+	}()
+	llmService, err := NewLLMService(provider, serverCfg)
+	if err != nil {
+		slog.Error("Error creating server", "err", err)
+		return
+	}
+	provider.SetToolCallHook(llmService.metrics.observeToolCall)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8088"
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go provider.watch(ctx)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				provider.Reload()
+			}
+		}
+	}()
+	if err := serve(ctx, llmService.Handler(), serverCfg.Listen); err != nil {
+		slog.Error("Error running server", "err", err)
+	}
+}
+
+// serve serves HTTP requests until ctx is done, then stops accepting connections
+// and waits for the in-flight requests to finish, until the shutdown timeout.
+func serve(ctx context.Context, handler http.Handler, cfg ListenConfig) error {
+	network, address := cfg.address()
+	if network == "unix" {
+		// remove the socket left by a previous run
+		if err := os.Remove(address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove socket: %w", err)
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
 	}
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: mux,
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting polyllm server", "network", network, "address", address, "tls", cfg.TLSCertFile != "")
+		if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+			serveErr <- server.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			serveErr <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := cfg.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
 	}
-	slog.Info("Starting polyllm server", "port", port)
-	if err := server.ListenAndServe(); err != nil {
-		slog.Error("Error starting server", "err", err)
+	slog.Info("Shutting down polyllm server", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return fmt.Errorf("failed to drain in-flight requests: %w", err)
 	}
+	return nil
 }
 
 // loggingMiddleware logs information about each incoming request
@@ -49,14 +125,18 @@ func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		// Log request details after processing
 		duration := time.Since(start)
-		slog.Info("Request processed",
+		attrs := []any{
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", rw.statusCode,
 			"duration", duration,
 			"remote_addr", r.RemoteAddr,
 			"user_agent", r.UserAgent(),
-		)
+		}
+		if rw.identity != nil {
+			attrs = append(attrs, "key_id", rw.identity.ID, "key_name", rw.identity.Name)
+		}
+		slog.Info("Request processed", attrs...)
 	}
 }
 
@@ -64,6 +144,8 @@ func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	// identity is the authenticated client, set by authMiddleware
+	identity *Identity
 }
 
 func newResponseWriter(w http.ResponseWriter) *responseWriter {
@@ -85,21 +167,66 @@ func (rw *responseWriter) Flush() {
 	}
 }
 
-func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// authMiddleware checks the bearer token of requests against the config keys, the virtual keys and the API_KEY env var,
+// requests with a config or virtual key carry its identity in their context.
+// Authentication is disabled when there are no config keys and neither API_KEY nor ADMIN_API_KEY are set.
+func (s *LLMService) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiKey := os.Getenv("API_KEY")
-		if apiKey != "" {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-			headerKey := strings.TrimPrefix(authHeader, "Bearer ")
-			if headerKey != apiKey {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
+		if apiKey == "" && len(s.keys) == 0 && os.Getenv("ADMIN_API_KEY") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		headerKey := strings.TrimPrefix(authHeader, "Bearer ")
+		identity, err := s.identify(r.Context(), headerKey)
+		if err != nil {
+			slog.Info("Rejected key", "err", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if identity != nil {
+			if rw, ok := w.(*responseWriter); ok {
+				rw.identity = identity
 			}
+			setSpanIdentity(r.Context(), identity)
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+			return
+		}
+		if apiKey == "" || subtle.ConstantTimeCompare([]byte(headerKey), []byte(apiKey)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
 		}
 		next.ServeHTTP(w, r)
 	}
 }
+
+// identify returns the identity of a config or virtual key, nil for other keys.
+func (s *LLMService) identify(ctx context.Context, key string) (*Identity, error) {
+	now := s.now()
+	if identity, ok := s.keys[key]; ok {
+		if identity.expired(now) {
+			return nil, fmt.Errorf("the key %s expired", identity.Name)
+		}
+		return identity, nil
+	}
+	if !strings.HasPrefix(key, virtualKeyPrefix) {
+		return nil, nil
+	}
+	virtualKey, err := s.keyStore.GetByHash(ctx, hashKey(key))
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key: %w", err)
+	}
+	if !virtualKey.active(now) {
+		return nil, fmt.Errorf("the key %s is revoked or expired", virtualKey.ID)
+	}
+	return virtualKey.Identity(), nil
+}
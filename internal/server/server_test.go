@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServe serves handler on a unix socket until the returned context is canceled.
+func startServe(t *testing.T, handler http.Handler, cfg ListenConfig) (*http.Client, context.CancelFunc, <-chan error) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "polyllm.sock")
+	cfg.Address = "unix:" + socket
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, handler, cfg) }()
+
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+	}
+	require.Eventually(t, func() bool {
+		conn, err := dial(context.Background(), "", "")
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+	return &http.Client{Transport: &http.Transport{DialContext: dial, DisableKeepAlives: true}}, cancel, done
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	client, cancel, done := startServe(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		close(started)
+		<-release
+		w.Write([]byte("data: last\n\n"))
+	}), ListenConfig{ShutdownTimeout: 5 * time.Second})
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := client.Get("http://polyllm/v1/chat/completions")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	<-started
+	cancel()
+
+	// new connections are refused while the stream finishes
+	require.Eventually(t, func() bool {
+		_, err := client.Get("http://polyllm/healthz")
+		return err != nil
+	}, time.Second, 5*time.Millisecond)
+	close(release)
+	assert.Equal(t, "data: first\n\ndata: last\n\n", <-body)
+	assert.NoError(t, <-done)
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	client, cancel, done := startServe(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}), ListenConfig{ShutdownTimeout: 20 * time.Millisecond})
+
+	go client.Get("http://polyllm/v1/chat/completions")
+	<-started
+	cancel()
+	assert.ErrorContains(t, <-done, "failed to drain in-flight requests")
+}
+
+func TestListenAddress(t *testing.T) {
+	t.Setenv("PORT", "")
+	network, address := ListenConfig{}.address()
+	assert.Equal(t, []string{"tcp", ":8088"}, []string{network, address})
+	t.Setenv("PORT", "3000")
+	network, address = ListenConfig{}.address()
+	assert.Equal(t, []string{"tcp", ":3000"}, []string{network, address})
+	network, address = ListenConfig{Address: "127.0.0.1:9000"}.address()
+	assert.Equal(t, []string{"tcp", "127.0.0.1:9000"}, []string{network, address})
+	network, address = ListenConfig{Address: "unix:/run/polyllm.sock"}.address()
+	assert.Equal(t, []string{"unix", "/run/polyllm.sock"}, []string{network, address})
+}
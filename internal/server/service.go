@@ -3,14 +3,28 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/recally-io/polyllm/llms"
 )
 
 type LLMService struct {
 	provider LLMProvider
+	// identities of the config keys by key
+	keys     map[string]*Identity
+	keyStore KeyStore
+	usage    UsageStore
+	// rate limits of the server and of upstream providers and models
+	rateLimit          *RateLimit
+	upstreamRateLimits map[string]RateLimit
+	limiter            *rateLimiter
+	metrics            *metrics
+	metricsPublic      bool
+	now                func() time.Time
 }
 
 type LLMProvider interface {
@@ -18,10 +32,78 @@ type LLMProvider interface {
 	ChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption)
 }
 
-func NewLLMService(provider LLMProvider) *LLMService {
-	return &LLMService{
+// ModelResolver is implemented by providers resolving the provider serving a model and its upstream ID,
+// which label the metrics and select the upstream rate limits.
+type ModelResolver interface {
+	ResolveModel(model string) (provider, id string, ok bool)
+}
+
+// ModelDescriber is implemented by providers describing their models, the pricing of a model is required
+// to charge its requests to USD budgets.
+type ModelDescriber interface {
+	GetModel(model string) (llms.Model, bool)
+}
+
+func NewLLMService(provider LLMProvider, cfg Config) (*LLMService, error) {
+	usage, err := cfg.newUsageStore()
+	if err != nil {
+		return nil, err
+	}
+	keyStore, err := cfg.newKeyStore()
+	if err != nil {
+		return nil, err
+	}
+	s := &LLMService{
 		provider: provider,
+		keys:     make(map[string]*Identity, len(cfg.Keys)),
+		keyStore: keyStore,
+		usage:    usage,
+
+		rateLimit:          cfg.RateLimit,
+		upstreamRateLimits: cfg.UpstreamRateLimits,
+		metricsPublic:      cfg.MetricsPublic,
+		limiter:            newRateLimiter(),
+		metrics:            newMetrics(),
+		now:                time.Now,
+	}
+	s.metrics.resolveModel = s.resolveModel
+	for _, key := range cfg.Keys {
+		if key.Key == "" || key.Name == "" {
+			return nil, fmt.Errorf("invalid key %q: keys need a name and a key", key.Name)
+		}
+		if _, ok := s.keys[key.Key]; ok {
+			return nil, fmt.Errorf("duplicate key of %s", key.Name)
+		}
+		s.keys[key.Key] = &Identity{ID: key.Name, KeyMetadata: key.KeyMetadata}
 	}
+	return s, nil
+}
+
+// Handler returns the HTTP handler of the OpenAI compatible API.
+func (s *LLMService) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", loggingMiddleware(s.authMiddleware(s.chatCompletion)))
+	mux.HandleFunc("POST /v1/chat/completions", loggingMiddleware(s.authMiddleware(s.chatCompletion)))
+
+	mux.HandleFunc("GET /models", loggingMiddleware(s.authMiddleware(s.listModels)))
+	mux.HandleFunc("GET /v1/models", loggingMiddleware(s.authMiddleware(s.listModels)))
+
+	if s.metricsPublic {
+		mux.HandleFunc("GET /metrics", s.serveMetrics)
+	} else {
+		mux.HandleFunc("GET /metrics", adminMiddleware(s.serveMetrics))
+	}
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /readyz", s.readyz)
+
+	mux.HandleFunc("POST /admin/keys", loggingMiddleware(adminMiddleware(s.createKey)))
+	mux.HandleFunc("GET /admin/keys", loggingMiddleware(adminMiddleware(s.listKeys)))
+	mux.HandleFunc("GET /admin/keys/{id}", loggingMiddleware(adminMiddleware(s.getKey)))
+	mux.HandleFunc("DELETE /admin/keys/{id}", loggingMiddleware(adminMiddleware(s.revokeKey)))
+	mux.HandleFunc("POST /admin/keys/{id}/rotate", loggingMiddleware(adminMiddleware(s.rotateKey)))
+	mux.HandleFunc("GET /admin/providers", loggingMiddleware(adminMiddleware(s.listProviders)))
+	mux.HandleFunc("POST /admin/reload", loggingMiddleware(adminMiddleware(s.reloadConfig)))
+	return tracingMiddleware(mux)
 }
 
 type listModelsResponse struct {
@@ -46,8 +128,18 @@ func (s *LLMService) listModels(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// resolveModel resolves the provider serving a model when the provider is a ModelResolver.
+func (s *LLMService) resolveModel(model string) (string, string, bool) {
+	resolver, ok := s.provider.(ModelResolver)
+	if !ok {
+		return "", "", false
+	}
+	return resolver.ResolveModel(model)
+}
+
 func (s *LLMService) chatCompletion(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	start := time.Now()
 
 	defer r.Body.Close()
 	body, err := io.ReadAll(r.Body)
@@ -62,9 +154,43 @@ func (s *LLMService) chatCompletion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	identity := IdentityFromContext(ctx)
+	labels := s.metrics.requestLabels(identity, req.Model)
+	if identity != nil {
+		apiErr := identity.checkModel(req.Model)
+		if apiErr != nil {
+			labels = unknownLabels(identity)
+		} else {
+			apiErr = s.checkBudget(ctx, identity, req.Model)
+		}
+		if apiErr != nil {
+			slog.Info("Rejected request", "client", identity.Name, "model", req.Model, "reason", apiErr.Code)
+			apiErr.write(w)
+			s.metrics.observeRequest(labels, apiErr.Code, time.Since(start), completionResult{})
+			return
+		}
+	}
+	reservation, apiErr := s.checkRateLimit(w, identity, req)
+	if apiErr != nil {
+		slog.Info("Rate limited request", "model", req.Model, "err", apiErr.Message)
+		apiErr.write(w)
+		s.metrics.observeRequest(labels, apiErr.Code, time.Since(start), completionResult{})
+		return
+	}
+
+	var result completionResult
 	if req.Stream {
-		handleStreamingResponse(w, ctx, s.provider, req)
+		s.metrics.streams.add(1, labels...)
+		result = handleStreamingResponse(w, ctx, s.provider, req)
+		s.metrics.streams.add(-1, labels...)
 	} else {
-		handleNonStreamingResponse(w, ctx, s.provider, req) // updated to use s.llmService
+		result = handleNonStreamingResponse(w, ctx, s.provider, req)
+	}
+	class := ""
+	if result.err != nil {
+		class = errorClass(result.err)
 	}
+	s.metrics.observeRequest(labels, class, time.Since(start), result)
+	reservation.reconcile(usageTokens(result.usage))
+	s.recordUsage(ctx, identity, result.usage)
 }
@@ -3,27 +3,39 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/recally-io/polyllm"
 	"github.com/recally-io/polyllm/llms"
 )
 
-func handleStreamingResponse(w http.ResponseWriter, ctx context.Context, llm LLMProvider, req llms.ChatCompletionRequest) {
+// handleStreamingResponse streams the chat completion as server-sent events and returns its usage and latency.
+func handleStreamingResponse(w http.ResponseWriter, ctx context.Context, llm LLMProvider, req llms.ChatCompletionRequest) completionResult {
 	slog.Info("Starting streaming response handler", "model", req.Model)
 	// Set headers for SSE
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Transfer-Encoding", "chunked")
+	// the cost is known once the usage chunk is sent, at the end of the stream
+	w.Header().Set("Trailer", costHeader)
+	var result completionResult
+	start := time.Now()
+	// the usage is always requested upstream to charge and rate limit the request, the chunk carrying it
+	// is only sent to clients asking for it
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		slog.Error("Streaming not supported by the response writer")
 		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
-		return
+		return completionResult{err: errors.New("streaming not supported")}
 	}
 
 	streamingFunc := func(content llms.StreamingChatCompletionResponse) {
@@ -37,6 +49,7 @@ func handleStreamingResponse(w http.ResponseWriter, ctx context.Context, llm LLM
 			}
 			// Handle error
 			slog.Error("Error streaming response", "err", content.Err)
+			result.err = content.Err
 			errMsg := fmt.Sprintf("data: {\"error\":{\"message\":\"%s\"}}\n\n", content.Err.Error())
 			fmt.Fprint(w, errMsg)
 			flusher.Flush()
@@ -44,6 +57,14 @@ func handleStreamingResponse(w http.ResponseWriter, ctx context.Context, llm LLM
 		}
 
 		if content.Response != nil {
+			if result.timeToFirstToken == 0 {
+				result.timeToFirstToken = time.Since(start)
+			}
+			// chunks of several tool rounds report their own usage
+			result.usage.Add(content.Response.Usage)
+			if !includeUsage && len(content.Response.Choices) == 0 {
+				return
+			}
 			// Format the response as SSE
 			jsonData, err := json.Marshal(content.Response)
 			if err != nil {
@@ -52,9 +73,7 @@ func handleStreamingResponse(w http.ResponseWriter, ctx context.Context, llm LLM
 				flusher.Flush()
 				return
 			}
-			slog.Debug("Sending chunk of streaming response",
-				"chunk_size", len(jsonData),
-				"finish_reason", content.Response.Choices[0].FinishReason)
+			slog.Debug("Sending chunk of streaming response", "chunk_size", len(jsonData))
 			fmt.Fprintf(w, "data: %s\n\n", jsonData)
 			flusher.Flush()
 		}
@@ -62,26 +81,29 @@ func handleStreamingResponse(w http.ResponseWriter, ctx context.Context, llm LLM
 
 	slog.Debug("Initiating chat completion with streaming")
 	llm.ChatCompletion(ctx, req, streamingFunc)
+	if cost := result.usage.Cost; cost != nil {
+		w.Header().Set(costHeader, formatCost(*cost))
+	}
 	slog.Debug("Completed streaming response handling")
+	return result
 }
 
-func handleNonStreamingResponse(w http.ResponseWriter, ctx context.Context, llm LLMProvider, req llms.ChatCompletionRequest) {
+// handleNonStreamingResponse writes the chat completion response and returns its usage.
+func handleNonStreamingResponse(w http.ResponseWriter, ctx context.Context, llm LLMProvider, req llms.ChatCompletionRequest) completionResult {
 	slog.Info("Starting non-streaming response handler", "model", req.Model)
 	w.Header().Set("Content-Type", "application/json")
 
 	var fullResponse *llms.ChatCompletionResponse
+	var responseErr error
 
 	streamingFunc := func(content llms.StreamingChatCompletionResponse) {
-		if content.Err != nil {
-			if content.Err != io.EOF {
-				// Only handle non-EOF errors here
-				slog.Error("Error during non-streaming response generation", "err", content.Err)
-				http.Error(w, fmt.Sprintf("Error: %v", content.Err), http.StatusInternalServerError)
-			}
+		if content.Err != nil && content.Err != io.EOF {
+			slog.Error("Error during non-streaming response generation", "err", content.Err)
+			responseErr = content.Err
 			return
 		}
 
-		// For non-streaming, we collect the full response
+		// For non-streaming, we collect the full response, it is sent together with io.EOF
 		if content.Response != nil {
 			slog.Debug("Collected part of non-streaming response")
 			fullResponse = content.Response
@@ -93,8 +115,13 @@ func handleNonStreamingResponse(w http.ResponseWriter, ctx context.Context, llm
 	llm.ChatCompletion(ctx, req, streamingFunc)
 
 	// After completion, return the full response
-	if fullResponse != nil {
+	if responseErr != nil {
+		http.Error(w, fmt.Sprintf("Error: %v", responseErr), errorStatus(responseErr))
+	} else if fullResponse != nil {
 		slog.Debug("Encoding and sending complete non-streaming response")
+		if cost := fullResponse.Usage.Cost; cost != nil {
+			w.Header().Set(costHeader, formatCost(*cost))
+		}
 		if err := json.NewEncoder(w).Encode(fullResponse); err != nil {
 			slog.Error("Failed to encode non-streaming response", "err", err)
 			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -102,6 +129,32 @@ func handleNonStreamingResponse(w http.ResponseWriter, ctx context.Context, llm
 	} else {
 		slog.Error("No response generated in non-streaming mode")
 		http.Error(w, "No response generated", http.StatusInternalServerError)
+		responseErr = errors.New("no response generated")
 	}
 	slog.Info("Completed non-streaming response handling")
+	if fullResponse == nil {
+		return completionResult{err: responseErr}
+	}
+	return completionResult{usage: fullResponse.Usage, err: responseErr}
+}
+
+// costHeader is the header with the estimated cost of a request in USD,
+// a trailer for streaming responses
+const costHeader = "X-Polyllm-Cost"
+
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', -1, 64)
+}
+
+// errorStatus returns the HTTP status of a chat completion error, invalid requests are client errors.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, polyllm.ErrProviderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, polyllm.ErrUnsupportedCapability), errors.Is(err, polyllm.ErrContextWindowExceeded):
+		return http.StatusBadRequest
+	case errors.Is(err, polyllm.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
 }
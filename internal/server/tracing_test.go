@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	otel.SetTracerProvider(provider)
+	_, err := SetupTracing(context.Background())
+	require.NoError(t, err)
+
+	s, server := newTestService(t, Config{Keys: []KeyConfig{{KeyMetadata: KeyMetadata{Name: "team-a"}, Key: "key-a"}}})
+	var providerSpan trace.SpanContext
+	s.provider = fakeProviderFunc(func(ctx context.Context) { providerSpan = trace.SpanContextFromContext(ctx) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader(chatBody))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer key-a")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "POST /v1/chat/completions", span.Name)
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+	assert.Equal(t, traceID, span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	assert.True(t, span.Parent.IsRemote())
+	assert.Equal(t, span.SpanContext.SpanID(), providerSpan.SpanID(), "the provider is called in the request span")
+	assert.Contains(t, span.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Contains(t, span.Attributes, attribute.String("http.route", "POST /v1/chat/completions"))
+	assert.Contains(t, span.Attributes, attribute.String("polyllm.key.id", "team-a"))
+}
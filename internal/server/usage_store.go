@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Usage is the spend of a client in a period.
+type Usage struct {
+	Requests int     `json:"requests"`
+	Tokens   int     `json:"tokens"`
+	Cost     float64 `json:"cost"`
+}
+
+func (u *Usage) add(usage Usage) {
+	u.Requests += usage.Requests
+	u.Tokens += usage.Tokens
+	u.Cost += usage.Cost
+}
+
+// UsageStore tracks the usage of clients by period, e.g. "2026-10-18" for a day or "2026-10" for a month.
+type UsageStore interface {
+	// Usage returns the usage of the client in the period.
+	Usage(ctx context.Context, client, period string) (Usage, error)
+	// Record adds usage to the client in each of the periods.
+	Record(ctx context.Context, client string, periods []string, usage Usage) error
+}
+
+// MemoryUsageStore keeps usage in memory, it is lost when the server restarts.
+// Periods of months before the latest recorded month are dropped as budgets only apply to the current ones.
+type MemoryUsageStore struct {
+	mu    sync.Mutex
+	usage map[string]map[string]Usage
+	// month is the latest month recorded, e.g. "2026-10"
+	month string
+}
+
+// NewMemoryUsageStore creates an empty in-memory usage store.
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{usage: make(map[string]map[string]Usage)}
+}
+
+func (s *MemoryUsageStore) Usage(ctx context.Context, client, period string) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[client][period], nil
+}
+
+func (s *MemoryUsageStore) Record(ctx context.Context, client string, periods []string, usage Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(client, periods, usage)
+	return nil
+}
+
+func (s *MemoryUsageStore) record(client string, periods []string, usage Usage) {
+	for _, period := range periods {
+		if month, ok := periodMonth(period); ok && month > s.month {
+			s.month = month
+			s.prune()
+		}
+	}
+	if s.usage[client] == nil {
+		s.usage[client] = make(map[string]Usage)
+	}
+	for _, period := range periods {
+		total := s.usage[client][period]
+		total.add(usage)
+		s.usage[client][period] = total
+	}
+}
+
+// prune drops the periods of the months before the latest recorded month.
+func (s *MemoryUsageStore) prune() {
+	for client, periods := range s.usage {
+		for period := range periods {
+			if month, ok := periodMonth(period); ok && month < s.month {
+				delete(periods, period)
+			}
+		}
+		if len(periods) == 0 {
+			delete(s.usage, client)
+		}
+	}
+}
+
+// periodMonth returns the month of a day or month period, e.g. "2026-10" for "2026-10-18".
+func periodMonth(period string) (string, bool) {
+	if len(period) < len("2006-01") {
+		return "", false
+	}
+	month := period[:len("2006-01")]
+	if _, err := time.Parse("2006-01", month); err != nil {
+		return "", false
+	}
+	return month, true
+}
+
+// FileUsageStore keeps usage in memory and persists it to a JSON file after every record.
+// The file only holds the periods of the current month, so it stays small enough to be rewritten.
+type FileUsageStore struct {
+	MemoryUsageStore
+	path string
+}
+
+// NewFileUsageStore opens the usage store of a JSON file, the file is created on the first record.
+func NewFileUsageStore(path string) (*FileUsageStore, error) {
+	s := &FileUsageStore{MemoryUsageStore: *NewMemoryUsageStore(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage store: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.usage); err != nil {
+		return nil, fmt.Errorf("failed to load usage store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *FileUsageStore) Record(ctx context.Context, client string, periods []string, usage Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(client, periods, usage)
+	return writeFileAtomic(s.path, s.usage)
+}
+
+// writeFileAtomic writes v as JSON to a temporary file renamed to path, so that readers never see partial files.
+func writeFileAtomic(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,281 @@
+// Package jsonschema provides a small subset of JSON Schema used to describe
+// structured outputs and tool parameters, and to validate model replies against them.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DataType is the type of a JSON value.
+type DataType string
+
+const (
+	Object  DataType = "object"
+	Number  DataType = "number"
+	Integer DataType = "integer"
+	String  DataType = "string"
+	Array   DataType = "array"
+	Null    DataType = "null"
+	Boolean DataType = "boolean"
+)
+
+// Definition is a JSON Schema definition.
+type Definition struct {
+	// Type specifies the data type of the schema.
+	Type DataType `json:"type,omitempty"`
+	// Description is the description of the schema.
+	Description string `json:"description,omitempty"`
+	// Enum is used to restrict a value to a fixed set of values.
+	Enum []any `json:"enum,omitempty"`
+	// Properties describes the properties of an object, if the schema type is Object.
+	Properties map[string]Definition `json:"properties,omitempty"`
+	// Required specifies which properties are required, if the schema type is Object.
+	Required []string `json:"required,omitempty"`
+	// Items specifies which data type an array contains, if the schema type is Array.
+	Items *Definition `json:"items,omitempty"`
+	// AdditionalProperties is used to control the handling of properties in an object
+	// that are not explicitly defined in the properties section of the schema. example:
+	// additionalProperties: true
+	// additionalProperties: false
+	// additionalProperties: jsonschema.Definition{Type: jsonschema.String}
+	AdditionalProperties any `json:"additionalProperties,omitempty"`
+	// Nullable allows null in addition to the schema type.
+	Nullable bool `json:"-"`
+}
+
+// MarshalJSON implements json.Marshaler, nullable types are written as a type list.
+func (d Definition) MarshalJSON() ([]byte, error) {
+	type alias Definition
+	if !d.Nullable || d.Type == "" {
+		return json.Marshal(alias(d))
+	}
+	return json.Marshal(struct {
+		alias
+		Type []DataType `json:"type"`
+	}{alias: alias(d), Type: []DataType{d.Type, Null}})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting both a type and a [type, "null"] list.
+func (d *Definition) UnmarshalJSON(data []byte) error {
+	type alias Definition
+	var raw struct {
+		alias
+		Type json.RawMessage `json:"type,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*d = Definition(raw.alias)
+	// schemas decoded from JSON or YAML give object schemas as maps
+	if additional, ok := d.AdditionalProperties.(map[string]any); ok {
+		schema, err := definitionFromMap(additional)
+		if err != nil {
+			return fmt.Errorf("invalid additionalProperties: %w", err)
+		}
+		d.AdditionalProperties = schema
+	}
+	if len(raw.Type) == 0 {
+		return nil
+	}
+
+	var single DataType
+	if err := json.Unmarshal(raw.Type, &single); err == nil {
+		d.Type = single
+		return nil
+	}
+	var types []DataType
+	if err := json.Unmarshal(raw.Type, &types); err != nil {
+		return fmt.Errorf("invalid schema type: %s", raw.Type)
+	}
+	for _, t := range types {
+		if t == Null {
+			d.Nullable = true
+			continue
+		}
+		d.Type = t
+	}
+	return nil
+}
+
+// ValidationError lists the problems found when validating a value.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "schema validation failed: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that a decoded JSON value, as produced by json.Unmarshal into any, matches the schema.
+func Validate(schema Definition, value any) error {
+	var problems []string
+	validate(schema, value, "$", &problems)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateJSON decodes data and validates it against the schema.
+func ValidateJSON(schema Definition, data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return Validate(schema, value)
+}
+
+func validate(schema Definition, value any, path string, problems *[]string) {
+	addProblem := func(format string, args ...any) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if value == nil {
+		if schema.Type != "" && schema.Type != Null && !schema.Nullable {
+			addProblem("expected %s, got null", schema.Type)
+		}
+		return
+	}
+
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(v any) bool { return equalJSON(v, value) }) {
+		addProblem("value %v is not one of %v", value, schema.Enum)
+	}
+
+	switch schema.Type {
+	case "":
+		return
+	case Object:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			addProblem("expected object, got %s", typeName(value))
+			return
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				addProblem("missing required property %q", name)
+			}
+		}
+		additional := schema.AdditionalProperties
+		switch v := additional.(type) {
+		case bool, Definition, nil:
+		case *Definition:
+			additional = nil
+			if v != nil {
+				additional = *v
+			}
+		case map[string]any:
+			additionalSchema, err := definitionFromMap(v)
+			if err != nil {
+				addProblem("invalid additionalProperties schema: %v", err)
+				return
+			}
+			additional = additionalSchema
+		default:
+			addProblem("unsupported additionalProperties %T", v)
+			return
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := schema.Properties[key]; ok {
+				validate(prop, obj[key], path+"."+key, problems)
+				continue
+			}
+			switch additional := additional.(type) {
+			case bool:
+				if !additional {
+					addProblem("unexpected property %q", key)
+				}
+			case Definition:
+				validate(additional, obj[key], path+"."+key, problems)
+			}
+		}
+	case Array:
+		arr, ok := value.([]any)
+		if !ok {
+			addProblem("expected array, got %s", typeName(value))
+			return
+		}
+		if schema.Items != nil {
+			for i, item := range arr {
+				validate(*schema.Items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case String:
+		if _, ok := value.(string); !ok {
+			addProblem("expected string, got %s", typeName(value))
+		}
+	case Number:
+		if _, ok := value.(float64); !ok {
+			addProblem("expected number, got %s", typeName(value))
+		}
+	case Integer:
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			addProblem("expected integer, got %s", typeName(value))
+		}
+	case Boolean:
+		if _, ok := value.(bool); !ok {
+			addProblem("expected boolean, got %s", typeName(value))
+		}
+	case Null:
+		addProblem("expected null, got %s", typeName(value))
+	default:
+		addProblem("unsupported schema type %q", schema.Type)
+	}
+}
+
+// definitionFromMap decodes a schema given as a map, as found in schemas decoded from JSON or YAML.
+func definitionFromMap(m map[string]any) (Definition, error) {
+	var schema Definition
+	data, err := json.Marshal(m)
+	if err != nil {
+		return schema, err
+	}
+	err = json.Unmarshal(data, &schema)
+	return schema, err
+}
+
+func typeName(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// equalJSON compares two values by their JSON encoding, so that enum values
+// declared as Go ints match decoded float64 numbers.
+func equalJSON(a, b any) bool {
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(aj) == string(bj)
+}
@@ -0,0 +1,95 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateJSON(t *testing.T) {
+	schema := Definition{
+		Type: Object,
+		Properties: map[string]Definition{
+			"name":  {Type: String},
+			"age":   {Type: Integer},
+			"role":  {Type: String, Enum: []any{"admin", "user"}},
+			"tags":  {Type: Array, Items: &Definition{Type: String}},
+			"email": {Type: String, Nullable: true},
+		},
+		Required:             []string{"name", "age"},
+		AdditionalProperties: false,
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		problems []string
+	}{
+		{"valid", `{"name": "Ann", "age": 30, "role": "admin", "tags": ["a"], "email": null}`, nil},
+		{"missing required", `{"name": "Ann"}`, []string{`$: missing required property "age"`}},
+		{"wrong types", `{"name": 1, "age": 1.5, "tags": [1]}`, []string{
+			"$.age: expected integer, got number",
+			"$.name: expected string, got integer",
+			"$.tags[0]: expected string, got integer",
+		}},
+		{"enum and extra property", `{"name": "Ann", "age": 3, "role": "root", "x": 1}`, []string{
+			"$.role: value root is not one of [admin user]",
+			`$: unexpected property "x"`,
+		}},
+		{"not an object", `[]`, []string{"$: expected object, got array"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJSON(schema, []byte(tt.data))
+			if tt.problems == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.problems, validationErr.Problems)
+		})
+	}
+
+	assert.ErrorContains(t, ValidateJSON(schema, []byte(`{`)), "invalid JSON")
+}
+
+func TestValidateAdditionalProperties(t *testing.T) {
+	data := `{"a": 1, "b": "x"}`
+	problems := []string{"$.b: expected integer, got string"}
+	for name, additional := range map[string]any{
+		"definition": Definition{Type: Integer},
+		"pointer":    &Definition{Type: Integer},
+		"map":        map[string]any{"type": "integer"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var validationErr *ValidationError
+			require.ErrorAs(t, ValidateJSON(Definition{Type: Object, AdditionalProperties: additional}, []byte(data)), &validationErr)
+			assert.Equal(t, problems, validationErr.Problems)
+		})
+	}
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, ValidateJSON(Definition{Type: Object, AdditionalProperties: "integer"}, []byte(data)), &validationErr)
+	assert.Equal(t, []string{"$: unsupported additionalProperties string"}, validationErr.Problems)
+
+	// schemas decoded from JSON get a definition
+	var schema Definition
+	require.NoError(t, json.Unmarshal([]byte(`{"type": "object", "additionalProperties": {"type": ["integer", "null"]}}`), &schema))
+	assert.Equal(t, Definition{Type: Integer, Nullable: true}, schema.AdditionalProperties)
+	require.NoError(t, json.Unmarshal([]byte(`{"type": "object", "additionalProperties": false}`), &schema))
+	assert.Equal(t, false, schema.AdditionalProperties)
+	assert.Error(t, json.Unmarshal([]byte(`{"additionalProperties": {"type": 1}}`), &schema))
+}
+
+func TestDefinitionJSON(t *testing.T) {
+	data, err := json.Marshal(Definition{Type: String, Nullable: true})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type": ["string", "null"]}`, string(data))
+
+	var d Definition
+	require.NoError(t, json.Unmarshal(data, &d))
+	assert.Equal(t, Definition{Type: String, Nullable: true}, d)
+}
@@ -0,0 +1,228 @@
+package jsonschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reflect generates the schema of T.
+//
+// Struct fields are named after their json tag and fields tagged "-" are skipped.
+// Fields are required unless they are pointers or tagged omitempty, the jsonschema
+// tag overrides this and adds descriptions and enums:
+//
+//	type Weather struct {
+//		City  string `json:"city" jsonschema:"description=Name of the city"`
+//		Unit  string `json:"unit,omitempty" jsonschema:"enum=celsius,enum=fahrenheit,required"`
+//		Notes string `json:"notes" jsonschema:"description=Free text\\, optional,optional"`
+//	}
+//
+// Commas inside a value are escaped with a backslash, written as \\, inside the tag.
+func Reflect[T any]() (Definition, error) {
+	return ReflectType(reflect.TypeFor[T]())
+}
+
+// ReflectType generates the schema of a Go type, see Reflect.
+func ReflectType(t reflect.Type) (Definition, error) {
+	return reflectType(t, make(map[reflect.Type]bool))
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+func reflectType(t reflect.Type, visiting map[reflect.Type]bool) (Definition, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return Definition{Type: String, Description: "RFC 3339 date-time"}, nil
+	case t == rawMessageType:
+		return Definition{}, nil
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// the JSON shape of custom marshalers is unknown
+		return Definition{}, nil
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return Definition{Type: String}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Definition{Type: String}, nil
+	case reflect.Bool:
+		return Definition{Type: Boolean}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Definition{Type: Integer}, nil
+	case reflect.Float32, reflect.Float64:
+		return Definition{Type: Number}, nil
+	case reflect.Interface:
+		return Definition{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// byte slices are encoded as base64 strings
+			return Definition{Type: String}, nil
+		}
+		items, err := reflectType(t.Elem(), visiting)
+		if err != nil {
+			return Definition{}, err
+		}
+		return Definition{Type: Array, Items: &items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return Definition{}, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := reflectType(t.Elem(), visiting)
+		if err != nil {
+			return Definition{}, err
+		}
+		return Definition{Type: Object, AdditionalProperties: values}, nil
+	case reflect.Struct:
+		if visiting[t] {
+			return Definition{}, fmt.Errorf("recursive type %s is not supported", t)
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		def := Definition{
+			Type:                 Object,
+			Properties:           make(map[string]Definition),
+			Required:             make([]string, 0),
+			AdditionalProperties: false,
+		}
+		if err := reflectFields(t, &def, visiting); err != nil {
+			return Definition{}, err
+		}
+		return def, nil
+	default:
+		return Definition{}, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// reflectFields adds the fields of a struct to def, embedded structs are flattened as encoding/json does.
+func reflectFields(t reflect.Type, def *Definition, visiting map[reflect.Type]bool) error {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		name, jsonOpts, _ := strings.Cut(jsonTag, ",")
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				if err := reflectFields(fieldType, def, visiting); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop, err := reflectType(field.Type, visiting)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if jsonOpts == "string" || strings.Contains(jsonOpts, ",string") {
+			prop = Definition{Type: String}
+		}
+
+		required := field.Type.Kind() != reflect.Pointer && !strings.Contains(jsonOpts, "omitempty")
+		if field.Type.Kind() == reflect.Pointer {
+			prop.Nullable = true
+		}
+		if err := applyTag(&prop, &required, field.Tag.Get("jsonschema")); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+
+		def.Properties[name] = prop
+		if required {
+			def.Required = append(def.Required, name)
+		}
+	}
+	return nil
+}
+
+// applyTag applies the options of a jsonschema struct tag.
+func applyTag(def *Definition, required *bool, tag string) error {
+	for _, opt := range splitTag(tag) {
+		key, value, _ := strings.Cut(opt, "=")
+		switch strings.TrimSpace(key) {
+		case "":
+		case "description":
+			def.Description = value
+		case "enum":
+			enum, err := enumValue(def.Type, value)
+			if err != nil {
+				return err
+			}
+			def.Enum = append(def.Enum, enum)
+		case "required":
+			*required = true
+		case "optional":
+			*required = false
+		case "nullable":
+			def.Nullable = true
+		default:
+			return fmt.Errorf("unknown jsonschema tag option %q", key)
+		}
+	}
+	return nil
+}
+
+// splitTag splits a tag on commas that are not escaped with a backslash.
+func splitTag(tag string) []string {
+	var (
+		opts    []string
+		current strings.Builder
+	)
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			opts = append(opts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(tag[i])
+		}
+	}
+	if current.Len() > 0 {
+		opts = append(opts, current.String())
+	}
+	return opts
+}
+
+// enumValue converts an enum tag value to the type of the schema.
+func enumValue(t DataType, value string) (any, error) {
+	switch t {
+	case Integer:
+		return strconv.ParseInt(value, 10, 64)
+	case Number:
+		return strconv.ParseFloat(value, 64)
+	case Boolean:
+		return strconv.ParseBool(value)
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,79 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAddress struct {
+	City string `json:"city" jsonschema:"description=Name of the city\\, in English"`
+}
+
+type testBase struct {
+	ID int `json:"id"`
+}
+
+type testUser struct {
+	testBase
+	Name      string            `json:"name" jsonschema:"description=Full name"`
+	Role      string            `json:"role,omitempty" jsonschema:"enum=admin,enum=user,required"`
+	Level     int               `json:"level" jsonschema:"enum=1,enum=2"`
+	Nickname  *string           `json:"nickname"`
+	Tags      []string          `json:"tags,omitempty"`
+	Addresses []testAddress     `json:"addresses"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Birthday  time.Time         `json:"birthday" jsonschema:"optional"`
+	Secret    string            `json:"-"`
+	internal  string
+}
+
+func TestReflect(t *testing.T) {
+	schema, err := Reflect[testUser]()
+	require.NoError(t, err)
+
+	data, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"id": {"type": "integer"},
+			"name": {"type": "string", "description": "Full name"},
+			"role": {"type": "string", "enum": ["admin", "user"]},
+			"level": {"type": "integer", "enum": [1, 2]},
+			"nickname": {"type": ["string", "null"]},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"addresses": {"type": "array", "items": {
+				"type": "object",
+				"properties": {"city": {"type": "string", "description": "Name of the city, in English"}},
+				"required": ["city"],
+				"additionalProperties": false
+			}},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"birthday": {"type": "string", "description": "RFC 3339 date-time"}
+		},
+		"required": ["id", "name", "role", "level", "addresses"],
+		"additionalProperties": false
+	}`, string(data))
+
+	// values encoded from the type are valid
+	nickname := "annie"
+	value, err := json.Marshal(testUser{Name: "Ann", Role: "admin", Level: 1, Nickname: &nickname, Addresses: []testAddress{{City: "Paris"}}})
+	require.NoError(t, err)
+	assert.NoError(t, ValidateJSON(schema, value))
+
+	type recursive struct {
+		Children []recursive `json:"children"`
+	}
+	_, err = Reflect[recursive]()
+	assert.ErrorContains(t, err, "recursive type")
+
+	type badTag struct {
+		Name string `jsonschema:"title=name"`
+	}
+	_, err = Reflect[badTag]()
+	assert.ErrorContains(t, err, "unknown jsonschema tag option")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/llms/mock"
 	"github.com/recally-io/polyllm/llms/openai"
 	"github.com/recally-io/polyllm/llms/openaicompatible"
 )
@@ -28,6 +29,8 @@ func NewLLM(provider *llms.Provider) (LLM, error) {
 		return openaicompatible.New(provider.BaseURL, provider.APIKey, opts...)
 	case llms.ProviderTypeDeepSeek, llms.ProviderTypeGemini, llms.ProviderTypeQwen, llms.ProviderTypeOpenRouter, llms.ProviderTypeVolcengine, llms.ProviderTypeGroq, llms.ProviderTypeXai, llms.ProviderTypeSiliconflow, llms.ProviderTypeFireworks, llms.ProviderTypeTogether:
 		return openaicompatible.New(provider.BaseURL, provider.APIKey, opts...)
+	case llms.ProviderTypeMock:
+		return mock.New(opts...)
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", provider.Type)
 	}
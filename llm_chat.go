@@ -5,22 +5,43 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
 	"strings"
 
 	"github.com/recally-io/polyllm/llms"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// MaxToolRounds limits how many times a chat completion sends tool results back to the model,
+// tool calls after the limit are returned to the caller.
+var MaxToolRounds = 10
+
+// ChatCompletion runs a chat completion and executes the calls to MCP tools and registered Go tools,
+// sending their results back to the model until it replies without tool calls.
+// Calls to other tools, e.g. tools defined by the caller in req.Tools, are returned to the caller.
 func (p *PolyLLM) ChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
-	finalToolCalls := make([]llms.ToolCall, 0)
-	localStreamingFunc := func(resp llms.StreamingChatCompletionResponse) {
-		p.streamingFunc(ctx, req, resp, streamingFunc, &finalToolCalls)
+	req, err := p.truncateRequest(ctx, req, true)
+	if err != nil {
+		slog.Error("failed to truncate request", "err", err, "model", req.Model)
+		streamingFunc(llms.StreamingChatCompletionResponse{Err: err})
+		return
 	}
-
-	p.chatCompletion(ctx, req, localStreamingFunc, options...)
+	p.runToolLoop(ctx, &toolLoop{
+		p:         p,
+		req:       req,
+		userFunc:  streamingFunc,
+		options:   options,
+		toolCalls: make([]llms.ToolCall, 0),
+	})
 }
 
-// preProcess preprocess the model and return the llm client, provider model name and llm tools from mcp servers
-func (p *PolyLLM) preProcess(ctx context.Context, model string) (LLM, string, []llms.Tool, error) {
+// preProcess preprocess the model and return the llm client, provider model name and llm tools from mcp servers and registered tools
+func (p *PolyLLM) preProcess(ctx context.Context, model string) (_ LLM, _ string, _ []llms.Tool, err error) {
+	ctx, span := tracer().Start(ctx, "polyllm.resolve_model", trace.WithAttributes(semconv.GenAIRequestModel(model)))
+	defer func() { endSpan(span, err) }()
+
 	info := strings.Split(model, "?")
 	model = info[0]
 
@@ -32,13 +53,45 @@ func (p *PolyLLM) preProcess(ctx context.Context, model string) (LLM, string, []
 
 	tools := []llms.Tool{}
 	if len(info) > 1 {
-		tools = p.getMCPToolsByModel(ctx, info[1])
+		tools = p.getToolsByModel(ctx, info[1])
 	}
+	span.SetAttributes(
+		attribute.String("polyllm.provider", llm.GetProvider().Name),
+		attribute.String("polyllm.provider_model", providerModel),
+		attribute.Int("polyllm.tools", len(tools)),
+	)
 
 	return llm, providerModel, tools, nil
 }
 
+// chatCompletion sends the request to its model, then to the fallbacks of the model, in order,
+// while they fail before replying for another reason than a 4xx response to the request.
 func (p *PolyLLM) chatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
+	model, query, _ := strings.Cut(req.Model, "?")
+	for _, fallback := range p.Fallbacks[model] {
+		var failure error
+		replied := false
+		p.sendChatCompletion(ctx, req, func(resp llms.StreamingChatCompletionResponse) {
+			if !replied && resp.Err != nil && resp.Err != io.EOF && !isRequestError(resp.Err) && ctx.Err() == nil {
+				failure = resp.Err
+				return
+			}
+			replied = true
+			streamingFunc(resp)
+		}, options...)
+		if failure == nil {
+			return
+		}
+		slog.Warn("falling back to another model", "model", req.Model, "fallback", fallback, "err", failure)
+		req.Model = fallback
+		if query != "" {
+			req.Model += "?" + query
+		}
+	}
+	p.sendChatCompletion(ctx, req, streamingFunc, options...)
+}
+
+func (p *PolyLLM) sendChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
 	client, model, tools, err := p.preProcess(ctx, req.Model)
 	if err != nil {
 		slog.Error("failed to get provider", "err", err, "model", req.Model)
@@ -46,110 +99,243 @@ func (p *PolyLLM) chatCompletion(ctx context.Context, req llms.ChatCompletionReq
 		return
 	}
 	if len(tools) > 0 {
-		req.Tools = append(req.Tools, tools...)
+		req.Tools = appendMissingTools(req.Tools, tools...)
+	}
+	if req.Stream && (req.StreamOptions == nil || !req.StreamOptions.IncludeUsage) {
+		// request the usage to know the cost, even when the caller turned it off, unless the model is known not to report it
+		if m, ok := p.GetModel(req.Model); !ok || m.Capabilities == nil || m.Capabilities.StreamUsage {
+			req.StreamOptions = &llms.StreamOptions{IncludeUsage: true}
+		}
+	}
+	req, err = p.AdaptRequest(req)
+	if err != nil {
+		slog.Error("failed to adapt request", "err", err, "model", req.Model)
+		streamingFunc(llms.StreamingChatCompletionResponse{Err: err})
+		return
+	}
+	req, err = p.truncateRequest(ctx, req, false)
+	if err != nil {
+		slog.Error("failed to truncate request", "err", err, "model", req.Model)
+		streamingFunc(llms.StreamingChatCompletionResponse{Err: err})
+		return
+	}
+	if m, ok := p.GetModel(req.Model); ok && m.Pricing != nil {
+		streamingFunc = withCost(*m.Pricing, streamingFunc)
+	}
+	if state, ok := p.providerStates[client.GetProvider().Name]; ok {
+		if !state.allow() {
+			err := fmt.Errorf("%w: provider %s", ErrCircuitOpen, client.GetProvider().Name)
+			slog.Warn("skipped request to failing provider", "err", err, "model", req.Model)
+			streamingFunc(llms.StreamingChatCompletionResponse{Err: err})
+			return
+		}
+		var done func()
+		streamingFunc, done = state.wrap(streamingFunc)
+		defer done()
 	}
 	req.Model = model
-	client.ChatCompletion(ctx, req, streamingFunc, options...)
+	ctx, span := startChatSpan(ctx, client.GetProvider(), req)
+	defer span.end(nil)
+	client.ChatCompletion(ctx, req, span.wrap(streamingFunc), options...)
 }
 
-func (p *PolyLLM) streamingFunc(ctx context.Context, req llms.ChatCompletionRequest, resp llms.StreamingChatCompletionResponse, userStreamingFunc func(resp llms.StreamingChatCompletionResponse), finalToolCalls *[]llms.ToolCall) {
-	// nonstreaming
-	if !req.Stream {
-		if resp.Err != nil && resp.Err != io.EOF {
-			userStreamingFunc(resp)
-			return
+// withCost sets the cost of the usage of responses and usage chunks.
+func withCost(pricing llms.ModelPricing, streamingFunc func(resp llms.StreamingChatCompletionResponse)) func(resp llms.StreamingChatCompletionResponse) {
+	return func(resp llms.StreamingChatCompletionResponse) {
+		if resp.Response != nil && resp.Response.Usage.PromptTokens+resp.Response.Usage.CompletionTokens > 0 && resp.Response.Usage.Cost == nil {
+			cost := pricing.Cost(resp.Response.Usage)
+			resp.Response.Usage.Cost = &cost
 		}
-		toolCalls := resp.Response.Choices[0].Message.ToolCalls
-		if len(toolCalls) == 0 {
-			userStreamingFunc(resp)
-			return
+		streamingFunc(resp)
+	}
+}
+
+// appendMissingTools appends the tools whose names are not defined yet.
+func appendMissingTools(defined []llms.Tool, tools ...llms.Tool) []llms.Tool {
+	names := make(map[string]bool, len(defined))
+	for _, tool := range defined {
+		if tool.Function != nil {
+			names[tool.Function.Name] = true
+		}
+	}
+	result := append(make([]llms.Tool, 0, len(defined)+len(tools)), defined...)
+	for _, tool := range tools {
+		if tool.Function != nil && names[tool.Function.Name] {
+			continue
 		}
+		result = append(result, tool)
+	}
+	return result
+}
 
-		// invoke mcp tools
-		req.Messages = append(req.Messages, llms.ChatCompletionMessage{
-			Role:      llms.ChatMessageRoleAssistant,
-			ToolCalls: toolCalls,
-		})
-		messages := p.invokeMCPTools(ctx, toolCalls)
-		req.Messages = append(req.Messages, messages...)
-		// send tool result to user
-		p.ChatCompletion(ctx, req, userStreamingFunc)
+// toolLoop is a round of the agent loop, it forwards the model reply to the caller
+// and runs the next round with the tool results when the reply only calls tools PolyLLM can execute.
+type toolLoop struct {
+	p        *PolyLLM
+	req      llms.ChatCompletionRequest
+	userFunc func(resp llms.StreamingChatCompletionResponse)
+	options  []llms.RequestOption
+	round    int
+	// usage of the previous rounds, added to the final non-streaming response
+	usage llms.Usage
+
+	// streaming state: the tool calls assembled from the deltas and the content of the round
+	toolCalls []llms.ToolCall
+	content   strings.Builder
+	// dispatch is set when the round finished with tool calls to execute once the stream ends
+	dispatch bool
+}
+
+func (p *PolyLLM) runToolLoop(ctx context.Context, loop *toolLoop) {
+	p.chatCompletion(ctx, loop.req, func(resp llms.StreamingChatCompletionResponse) {
+		if loop.req.Stream {
+			loop.handleChunk(ctx, resp)
+		} else {
+			loop.handleResponse(ctx, resp)
+		}
+	}, loop.options...)
+}
+
+// canDispatch reports whether all tool calls can be executed by PolyLLM.
+func (l *toolLoop) canDispatch(toolCalls []llms.ToolCall) bool {
+	if len(toolCalls) == 0 || l.round >= MaxToolRounds {
+		return false
+	}
+	for _, toolCall := range toolCalls {
+		if !l.p.canInvokeTool(toolCall.Function.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// next executes the tool calls of the assistant message and runs the next round with their results.
+func (l *toolLoop) next(ctx context.Context, message llms.ChatCompletionMessage) {
+	req := l.req
+	req.Messages = append(append([]llms.ChatCompletionMessage{}, req.Messages...), llms.ChatCompletionMessage{
+		Role:      llms.ChatMessageRoleAssistant,
+		Content:   message.Content,
+		ToolCalls: message.ToolCalls,
+	})
+	req.Messages = append(req.Messages, l.p.invokeTools(ctx, l.req.Model, message.ToolCalls)...)
+
+	l.p.runToolLoop(ctx, &toolLoop{
+		p:         l.p,
+		req:       req,
+		userFunc:  l.userFunc,
+		options:   l.options,
+		round:     l.round + 1,
+		usage:     l.usage,
+		toolCalls: make([]llms.ToolCall, 0),
+	})
+}
+
+func (l *toolLoop) handleResponse(ctx context.Context, resp llms.StreamingChatCompletionResponse) {
+	if (resp.Err != nil && resp.Err != io.EOF) || resp.Response == nil || len(resp.Response.Choices) == 0 || resp.Response.Choices[0].Message == nil {
+		l.userFunc(resp)
+		return
+	}
+
+	message := *resp.Response.Choices[0].Message
+	if !l.canDispatch(message.ToolCalls) {
+		resp.Response.Usage.Add(l.usage)
+		l.userFunc(resp)
+		return
 	}
+	l.usage.Add(resp.Response.Usage)
+	l.next(ctx, message)
+}
 
+func (l *toolLoop) handleChunk(ctx context.Context, resp llms.StreamingChatCompletionResponse) {
 	if resp.Err != nil {
-		userStreamingFunc(resp)
+		if resp.Err == io.EOF && l.dispatch {
+			l.next(ctx, llms.ChatCompletionMessage{Content: l.content.String(), ToolCalls: l.toolCalls})
+			return
+		}
+		l.userFunc(resp)
+		return
+	}
+	if resp.Response == nil || len(resp.Response.Choices) == 0 {
+		// e.g. the trailing usage chunk
+		l.userFunc(resp)
 		return
 	}
 
 	choice := resp.Response.Choices[0]
+	hasToolCalls := false
+	if choice.Delta != nil {
+		l.content.WriteString(choice.Delta.Content)
+		if len(choice.Delta.ToolCalls) > 0 {
+			hasToolCalls = true
+			l.toolCalls = mergeToolCallDeltas(l.toolCalls, choice.Delta.ToolCalls)
+		}
+	}
+
+	// some providers finish with stop even when the reply calls tools
+	if choice.FinishReason != "" && len(l.toolCalls) > 0 {
+		if l.canDispatch(l.toolCalls) {
+			l.dispatch = true
+			return
+		}
+
+		// replay the assembled tool calls for the caller to handle them
+		replay := *resp.Response
+		replay.Choices = []llms.ChatCompletionChoice{{
+			Index: choice.Index,
+			Delta: &llms.ChatCompletionMessage{Role: llms.ChatMessageRoleAssistant, ToolCalls: l.toolCalls},
+		}}
+		l.userFunc(llms.StreamingChatCompletionResponse{Response: &replay})
 
-	if choice.FinishReason == llms.FinishReasonToolCalls {
-		// invoke mcp tools
-		req.Messages = append(req.Messages, llms.ChatCompletionMessage{
-			Role:      llms.ChatMessageRoleAssistant,
-			ToolCalls: *finalToolCalls,
-		})
-		messages := p.invokeMCPTools(ctx, *finalToolCalls)
-		req.Messages = append(req.Messages, messages...)
-		*finalToolCalls = nil
-		// send tool result to user
-		p.ChatCompletion(ctx, req, userStreamingFunc)
-	}
-
-	toolCalls := choice.Delta.ToolCalls
-	if len(toolCalls) == 0 {
-		userStreamingFunc(resp)
+		finish := *resp.Response
+		finish.Choices = []llms.ChatCompletionChoice{{Index: choice.Index, Delta: &llms.ChatCompletionMessage{}, FinishReason: choice.FinishReason}}
+		l.userFunc(llms.StreamingChatCompletionResponse{Response: &finish})
+		l.toolCalls = make([]llms.ToolCall, 0)
 		return
 	}
 
-	if len(*finalToolCalls) == 0 {
-		*finalToolCalls = append(*finalToolCalls, toolCalls...)
-	} else {
-		for _, tc := range toolCalls {
-			idx := tc.Index
-			(*finalToolCalls)[*idx].Function.Arguments += tc.Function.Arguments
+	if hasToolCalls {
+		if choice.Delta.Content == "" {
+			return
 		}
+		// forward the content of the chunk, the tool calls are sent when the reply finishes
+		chunk := *resp.Response
+		chunk.Choices = []llms.ChatCompletionChoice{{Index: choice.Index, Delta: &llms.ChatCompletionMessage{Role: choice.Delta.Role, Content: choice.Delta.Content}}}
+		resp.Response = &chunk
 	}
+	l.userFunc(resp)
 }
 
-func (p *PolyLLM) invokeMCPTools(ctx context.Context, tools []llms.ToolCall) []llms.ChatCompletionMessage {
-	var messages []llms.ChatCompletionMessage
-
-	for _, tool := range tools {
-		mcpName, req, err := convertLLMToolToMCPToolRequest(tool.Function)
-		if err != nil {
-			slog.Error("failed to convert tool to mcp tool request", "tool", tool.Function.Name, "err", err)
-			continue
+// mergeToolCallDeltas merges streamed tool call deltas by their index.
+// The index identifies a tool call, it is not a position in toolCalls:
+// providers may start at any index or interleave the deltas of several calls.
+func mergeToolCallDeltas(toolCalls []llms.ToolCall, deltas []llms.ToolCall) []llms.ToolCall {
+	for _, delta := range deltas {
+		pos := -1
+		if delta.Index != nil {
+			pos = slices.IndexFunc(toolCalls, func(toolCall llms.ToolCall) bool {
+				return toolCall.Index != nil && *toolCall.Index == *delta.Index
+			})
 		}
-		resp, err := p.mcpClientMappings[mcpName].CallTool(ctx, req)
-		if err != nil {
-			slog.Error("failed to call tool", "tool", tool.Function.Name, "err", err, "args", req.Params.Arguments)
+		if pos < 0 {
+			if delta.Index == nil {
+				idx := len(toolCalls)
+				delta.Index = &idx
+			}
+			toolCalls = append(toolCalls, delta)
 			continue
 		}
 
-		if resp.Content == nil {
-			slog.Error("tool returned nil response", "tool", tool.Function.Name)
-			continue
+		toolCall := &toolCalls[pos]
+		if delta.ID != "" {
+			toolCall.ID = delta.ID
 		}
-
-		slog.Info("start invoking mcp tool", "tool", tool.Function.Name, "args", req.Params.Arguments)
-
-		var resultText string
-
-		for _, chunk := range resp.Content {
-			if contentMap, ok := chunk.(map[string]any); ok {
-				if text, ok := contentMap["text"].(string); ok {
-					resultText += fmt.Sprintf("%v", text)
-				}
-			}
+		if delta.Type != "" {
+			toolCall.Type = delta.Type
 		}
-		messages = append(messages, llms.ChatCompletionMessage{
-			Role:       llms.ChatMessageRoleTool,
-			ToolCallID: tool.ID,
-			Content:    strings.TrimSpace(resultText),
-		})
-		slog.Info("finished invoking mcp tool", "tool", tool.Function.Name, "result", resultText[:min(100, len(resultText))])
+		if delta.Function.Name != "" {
+			toolCall.Function.Name = delta.Function.Name
+		}
+		toolCall.Function.Arguments += delta.Function.Arguments
 	}
-
-	return messages
+	return toolCalls
 }
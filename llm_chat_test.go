@@ -0,0 +1,96 @@
+package polyllm
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatCompletionCost(t *testing.T) {
+	server, requests := newTestServer(t, llms.ChatCompletionMessage{Content: "ok"})
+	p := New(WithLLMProviders(llms.Provider{
+		Type:    llms.ProviderTypeOpenAI,
+		Name:    "test-cost",
+		BaseURL: server.URL,
+		APIKey:  "test",
+		Models:  []llms.Model{{ID: "test-model", Pricing: &llms.ModelPricing{Input: 1, Output: 2}}},
+	}))
+	req := llms.ChatCompletionRequest{
+		Model:    "test-model",
+		Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "hi"}},
+	}
+	// 10 prompt tokens at $1 and 5 completion tokens at $2 per million tokens
+	const cost = 20.0 / 1_000_000
+
+	t.Run("non-streaming", func(t *testing.T) {
+		var resp *llms.ChatCompletionResponse
+		p.ChatCompletion(context.Background(), req, func(r llms.StreamingChatCompletionResponse) {
+			require.True(t, r.Err == nil || r.Err == io.EOF, r.Err)
+			if r.Response != nil {
+				resp = r.Response
+			}
+		})
+		require.NotNil(t, resp)
+		require.NotNil(t, resp.Usage.Cost)
+		assert.InDelta(t, cost, *resp.Usage.Cost, 1e-12)
+	})
+
+	// the usage is requested even when the caller turned it off
+	for name, options := range map[string]*llms.StreamOptions{"streaming": nil, "streaming without usage": {IncludeUsage: false}} {
+		t.Run(name, func(t *testing.T) {
+			req := req
+			req.Stream = true
+			req.StreamOptions = options
+			var usage *llms.Usage
+			p.ChatCompletion(context.Background(), req, func(r llms.StreamingChatCompletionResponse) {
+				require.True(t, r.Err == nil || r.Err == io.EOF, r.Err)
+				if r.Response != nil && r.Response.Usage.TotalTokens > 0 {
+					usage = &r.Response.Usage
+				}
+			})
+			last := (*requests)[len(*requests)-1]
+			require.NotNil(t, last.StreamOptions)
+			assert.True(t, last.StreamOptions.IncludeUsage)
+			require.NotNil(t, usage)
+			require.NotNil(t, usage.Cost)
+			assert.InDelta(t, cost, *usage.Cost, 1e-12)
+			if options != nil {
+				assert.False(t, options.IncludeUsage, "the caller options are not modified")
+			}
+		})
+	}
+
+	estimate, ok := p.EstimateCost("test-model", llms.Usage{PromptTokens: 10, CompletionTokens: 5})
+	assert.True(t, ok)
+	assert.InDelta(t, cost, estimate, 1e-12)
+	estimate, ok = p.EstimateCost("gpt-4o-mini", llms.Usage{PromptTokens: 1_000_000})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.15, estimate, 1e-12)
+	_, ok = p.EstimateCost("unknown", llms.Usage{PromptTokens: 10})
+	assert.False(t, ok)
+}
+
+func TestMergeToolCallDeltas(t *testing.T) {
+	index := func(i int) *int { return &i }
+	// the stream starts at index 1 and interleaves the deltas of two calls
+	deltas := [][]llms.ToolCall{
+		{{Index: index(1), ID: "call_1", Type: "function", Function: llms.FunctionCall{Name: "search", Arguments: `{"q":`}}},
+		{{Index: index(2), ID: "call_2", Type: "function", Function: llms.FunctionCall{Name: "lookup", Arguments: `{}`}}},
+		{{Index: index(1), Function: llms.FunctionCall{Arguments: `"go"}`}}},
+	}
+	var toolCalls []llms.ToolCall
+	for _, delta := range deltas {
+		toolCalls = mergeToolCallDeltas(toolCalls, delta)
+	}
+
+	require.Len(t, toolCalls, 2)
+	assert.Equal(t, "call_1", toolCalls[0].ID)
+	assert.Equal(t, "search", toolCalls[0].Function.Name)
+	assert.Equal(t, `{"q":"go"}`, toolCalls[0].Function.Arguments)
+	assert.Equal(t, "call_2", toolCalls[1].ID)
+	assert.Equal(t, `{}`, toolCalls[1].Function.Arguments)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/recally-io/polyllm/llms"
@@ -16,12 +17,64 @@ func (p *PolyLLM) ListModels(ctx context.Context) ([]llms.Model, error) {
 		if err != nil {
 			continue
 		}
-		models = append(models, clientModels...)
+		models = append(models, p.describeModels(client, clientModels)...)
 	}
 	return models, nil
 }
 
+// GetModel returns a model with its metadata, models served by no provider are looked up in the catalog of well known models.
+func (p *PolyLLM) GetModel(model string) (llms.Model, bool) {
+	model, _, _ = strings.Cut(model, "?")
+	if m, ok := p.models[model]; ok {
+		return m, true
+	}
+	return llms.LookupModel(model)
+}
+
+// ResolveModel returns the name of the provider serving a model and the ID of the model sent to the provider,
+// without the model prefix and with aliases resolved. ok is false when no provider serves the model.
+func (p *PolyLLM) ResolveModel(model string) (provider, id string, ok bool) {
+	name, _, _ := strings.Cut(model, "?")
+	llm, ok := p.modelLLMMappings[name]
+	if !ok {
+		return "", "", false
+	}
+	return llm.GetProvider().Name, llm.GetProvider().GetRealModel(name), true
+}
+
+// describeModels sets the context window, output limit, capabilities and pricing of the models of a provider:
+// the catalog entry of the provider model is overridden by the metadata listed by the provider,
+// which is overridden by the models of the provider config.
+func (p *PolyLLM) describeModels(llm LLM, models []llms.Model) []llms.Model {
+	provider := llm.GetProvider()
+	configured := make(map[string]llms.Model, len(provider.Models))
+	for _, model := range provider.Models {
+		configured[model.ID] = model
+	}
+
+	described := make([]llms.Model, 0, len(models))
+	for _, model := range models {
+		metadata := llms.Model{}
+		if entry, ok := llms.LookupModel(provider.GetRealModel(model.ID)); ok {
+			metadata = metadata.MergeMetadata(entry)
+		}
+		metadata = metadata.MergeMetadata(model)
+		if override, ok := configured[model.ID]; ok {
+			metadata = metadata.MergeMetadata(override)
+		}
+		model.ContextWindow, model.MaxOutputTokens = metadata.ContextWindow, metadata.MaxOutputTokens
+		model.Capabilities, model.Pricing = metadata.Capabilities, metadata.Pricing
+		described = append(described, model)
+	}
+	return described
+}
+
 func (p *PolyLLM) loadProviderModelsWithCache(ctx context.Context, llm LLM) ([]llms.Model, error) {
+	// configured models are not cached, so that configuration changes apply immediately
+	if models := llm.GetProvider().GetModelList(ctx); len(models) > 0 {
+		return models, nil
+	}
+
 	// Try to load models from cache
 	modelCache, err := llms.LoadModelCache(llm.GetProvider().Name)
 	if err == nil && llms.IsModelCacheValid(modelCache) {
@@ -48,3 +101,12 @@ func (p *PolyLLM) loadProviderModelsWithCache(ctx context.Context, llm LLM) ([]l
 	}
 	return modelCache.Models, nil
 }
+
+// EstimateCost returns the cost of a request in USD from the model pricing, see GetModel.
+func (p *PolyLLM) EstimateCost(model string, usage llms.Usage) (float64, bool) {
+	m, ok := p.GetModel(model)
+	if !ok || m.Pricing == nil {
+		return 0, false
+	}
+	return m.Pricing.Cost(usage), true
+}
@@ -0,0 +1,74 @@
+package polyllm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelMetadata(t *testing.T) {
+	p := New(WithLLMProviders(llms.Provider{
+		Type:        llms.ProviderTypeMock,
+		Name:        "test-metadata",
+		ModelPrefix: "meta/",
+		Models: []llms.Model{
+			{ID: "meta/gpt-4o", MaxOutputTokens: 4096},
+			{ID: "meta/custom", ContextWindow: 5000, Capabilities: &llms.ModelCapabilities{Tools: true}},
+			{ID: "meta/unknown"},
+		},
+	}))
+
+	// catalog metadata overridden by the provider config
+	model, ok := p.GetModel("meta/gpt-4o?tools=all")
+	require.True(t, ok)
+	assert.Equal(t, 128000, model.ContextWindow)
+	assert.Equal(t, 4096, model.MaxOutputTokens)
+	require.NotNil(t, model.Capabilities)
+	assert.True(t, model.Capabilities.JSONSchema)
+
+	model, _ = p.GetModel("meta/custom")
+	assert.Equal(t, 5000, model.ContextWindow)
+	assert.Equal(t, &llms.ModelCapabilities{Tools: true}, model.Capabilities)
+
+	model, _ = p.GetModel("meta/unknown")
+	assert.Zero(t, model.ContextWindow)
+	assert.Nil(t, model.Capabilities)
+
+	// models served by no provider come from the catalog
+	model, ok = p.GetModel("gemini-2.5-flash")
+	require.True(t, ok)
+	assert.True(t, model.Capabilities.ReasoningEffort)
+	_, ok = p.GetModel("unknown")
+	assert.False(t, ok)
+
+	models, err := p.ListModels(context.Background())
+	require.NoError(t, err)
+	described := make(map[string]llms.Model)
+	for _, m := range models {
+		described[m.ID] = m
+	}
+	assert.Equal(t, 4096, described["meta/gpt-4o"].MaxOutputTokens)
+	assert.Equal(t, 5000, described["meta/custom"].ContextWindow)
+}
+
+func TestResolveModel(t *testing.T) {
+	p := New(WithLLMProviders(llms.Provider{
+		Type:        llms.ProviderTypeMock,
+		Name:        "test-resolve",
+		ModelPrefix: "res/",
+		Models:      []llms.Model{{ID: "res/gpt-4o"}},
+		ModelAlias:  map[string]string{"fast": "gpt-4o"},
+	}))
+
+	for _, model := range []string{"res/gpt-4o?tools=all", "res/fast"} {
+		provider, id, ok := p.ResolveModel(model)
+		require.True(t, ok, model)
+		assert.Equal(t, "test-resolve", provider)
+		assert.Equal(t, "gpt-4o", id)
+	}
+	_, _, ok := p.ResolveModel("gpt-4o")
+	assert.False(t, ok)
+}
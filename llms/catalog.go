@@ -0,0 +1,80 @@
+package llms
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// builtInModelsBytes is the catalog of well known models with their context window, output limit and capabilities
+//
+//go:embed builtin-models.json
+var builtInModelsBytes []byte
+var builtInModels []Model
+
+func init() {
+	if err := json.Unmarshal(builtInModelsBytes, &builtInModels); err != nil {
+		slog.Error("failed to unmarshal built-in models", "err", err)
+	}
+}
+
+// BuiltInModels returns the catalog of well known models.
+// Catalog ids are model name prefixes, e.g. "gpt-4o" describes "gpt-4o-2024-08-06" too.
+func BuiltInModels() []Model {
+	return append([]Model{}, builtInModels...)
+}
+
+// variantSuffixes name model variants whose capabilities differ from the base model,
+// e.g. "gpt-4o-audio-preview" is not described by "gpt-4o" and needs its own catalog entry.
+var variantSuffixes = []string{"vision", "audio", "realtime", "search", "transcribe", "tts"}
+
+// LookupModel returns the catalog entry of a model, the entry with the longest id prefix of the model name wins.
+// The prefix must end at a "-", "@" or ":" boundary, e.g. "gpt-4" describes "gpt-4-0613" but not "gpt-4.2",
+// and the rest of the name must not name a variant, e.g. "gpt-4" does not describe "gpt-4-vision-preview".
+// The model name may include a provider path and a query, e.g. "openrouter/openai/gpt-4o?mcp=all".
+func LookupModel(model string) (Model, bool) {
+	name := normalizeModelName(model)
+	best := -1
+	for i, m := range builtInModels {
+		if matchModelID(name, m.ID) && (best < 0 || len(m.ID) > len(builtInModels[best].ID)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return Model{}, false
+	}
+	// copy the capabilities so callers cannot modify the catalog
+	entry := builtInModels[best]
+	return Model{ID: entry.ID, Name: entry.Name}.MergeMetadata(entry), true
+}
+
+// matchModelID reports whether the catalog id describes the model name.
+func matchModelID(name, id string) bool {
+	rest, ok := strings.CutPrefix(name, id)
+	if !ok {
+		return false
+	}
+	if rest == "" {
+		return true
+	}
+	if !strings.ContainsRune("-@:", rune(rest[0])) {
+		return false
+	}
+	for _, part := range strings.FieldsFunc(rest, func(r rune) bool { return r == '-' || r == '@' || r == ':' }) {
+		if slices.Contains(variantSuffixes, part) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeModelName strips the provider path and the query of a model name.
+func normalizeModelName(model string) string {
+	model, _, _ = strings.Cut(model, "?")
+	if idx := strings.LastIndex(model, "/"); idx >= 0 {
+		model = model[idx+1:]
+	}
+	return strings.ToLower(model)
+}
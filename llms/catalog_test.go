@@ -0,0 +1,111 @@
+package llms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupModel(t *testing.T) {
+	model, ok := LookupModel("gpt-4o-mini-2024-07-18")
+	require.True(t, ok)
+	assert.Equal(t, "gpt-4o-mini", model.ID)
+	assert.Equal(t, 128000, model.ContextWindow)
+	assert.Equal(t, 16384, model.MaxOutputTokens)
+	require.NotNil(t, model.Capabilities)
+	assert.True(t, model.Capabilities.Vision)
+	assert.True(t, model.Capabilities.JSONSchema)
+	assert.False(t, model.Capabilities.ReasoningEffort)
+
+	model, _ = LookupModel("gpt-4-32k-0613")
+	assert.Equal(t, 32768, model.ContextWindow)
+	model, _ = LookupModel("openrouter/anthropic/claude-3.5-sonnet?mcp=all")
+	assert.Equal(t, 200000, model.ContextWindow)
+	model, _ = LookupModel("o3-mini")
+	assert.True(t, model.Capabilities.ReasoningEffort)
+	assert.False(t, model.Capabilities.Vision)
+
+	// lookups return copies of the catalog entries
+	model.Capabilities.Vision = true
+	model, _ = LookupModel("o3-mini")
+	assert.False(t, model.Capabilities.Vision)
+
+	_, ok = LookupModel("unknown-model")
+	assert.False(t, ok)
+}
+
+func TestLookupModelBoundaries(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{model: "gpt-4", want: "gpt-4"},
+		{model: "gpt-4-0613", want: "gpt-4"},
+		{model: "gpt-4-vision-preview", want: "gpt-4-vision-preview"},
+		{model: "gpt-4-1106-vision-preview", want: "gpt-4-1106-vision-preview"},
+		{model: "gpt-4-1106-preview", want: "gpt-4-1106"},
+		{model: "gpt-4-turbo-preview", want: "gpt-4-turbo-preview"},
+		{model: "gpt-4-turbo-2024-04-09", want: "gpt-4-turbo"},
+		{model: "gpt-4.1-mini-2025-04-14", want: "gpt-4.1-mini"},
+		{model: "gpt-4o-2024-08-06", want: "gpt-4o"},
+		{model: "grok-2-vision-1212", want: "grok-2-vision"},
+		{model: "claude-3-5-sonnet@20240620", want: "claude-3-5-sonnet"},
+		{model: "llama-3.1:8b", want: "llama-3.1"},
+		{model: "openrouter/meta-llama/llama-3.1-70b-instruct", want: "llama-3.1"},
+		// unknown versions and variants are not described by the base model
+		{model: "gpt-4.2"},
+		{model: "gpt-4o-audio-preview"},
+		{model: "gpt-4o-realtime-preview-2024-12-17"},
+		{model: "gpt-4o-mini-search-preview"},
+		{model: "o1x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			model, ok := LookupModel(tt.model)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, model.ID)
+		})
+	}
+
+	model, _ := LookupModel("gpt-4-vision-preview")
+	assert.True(t, model.Capabilities.Vision)
+	assert.Equal(t, 128000, model.ContextWindow)
+}
+
+func TestBuiltInModels(t *testing.T) {
+	ids := make(map[string]bool)
+	for _, model := range BuiltInModels() {
+		assert.False(t, ids[model.ID], "duplicate model %s", model.ID)
+		ids[model.ID] = true
+		assert.Positive(t, model.ContextWindow, model.ID)
+		assert.NotNil(t, model.Capabilities, model.ID)
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	base := Model{ID: "a", ContextWindow: 1000, MaxOutputTokens: 100, Capabilities: &ModelCapabilities{Tools: true}}
+
+	merged := base.MergeMetadata(Model{ID: "b", ContextWindow: 2000})
+	assert.Equal(t, Model{ID: "a", ContextWindow: 2000, MaxOutputTokens: 100, Capabilities: &ModelCapabilities{Tools: true}}, merged)
+
+	merged = base.MergeMetadata(Model{Capabilities: &ModelCapabilities{Vision: true}})
+	assert.Equal(t, &ModelCapabilities{Vision: true}, merged.Capabilities)
+}
+
+func TestModelPricingCost(t *testing.T) {
+	pricing := ModelPricing{Input: 2, CachedInput: 0.5, Output: 8}
+	usage := Usage{
+		PromptTokens:            1_000_000,
+		CompletionTokens:        500_000,
+		PromptTokensDetails:     &PromptTokensDetails{CachedTokens: 400_000},
+		CompletionTokensDetails: &CompletionTokensDetails{ReasoningTokens: 100_000},
+	}
+	assert.InDelta(t, 0.6*2+0.4*0.5+0.5*8, pricing.Cost(usage), 1e-9)
+
+	pricing.Reasoning = 10
+	assert.InDelta(t, 0.6*2+0.4*0.5+0.4*8+0.1*10, pricing.Cost(usage), 1e-9)
+
+	// cached tokens are billed at the input price without a cached input price
+	assert.InDelta(t, 3.0, ModelPricing{Input: 3, Output: 15}.Cost(Usage{PromptTokens: 1_000_000, PromptTokensDetails: &PromptTokensDetails{CachedTokens: 1000}}), 1e-9)
+}
@@ -0,0 +1,138 @@
+// Package mock implements a local LLM provider that echoes the last user message.
+// It needs no network access or API key and is meant for tests and CI runs.
+package mock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+)
+
+// DefaultModel is the model served when the provider config lists none.
+const DefaultModel = "echo"
+
+// Client is a mock LLM client.
+type Client struct {
+	*llms.Provider
+}
+
+// New creates a new mock client, the API key and base URL are ignored.
+func New(opts ...llms.Option) (*Client, error) {
+	provider := &llms.Provider{
+		Type: llms.ProviderTypeMock,
+		Name: "mock",
+	}
+	for _, opt := range opts {
+		opt(provider)
+	}
+	return &Client{Provider: provider}, nil
+}
+
+func (c *Client) GetProvider() *llms.Provider {
+	return c.Provider
+}
+
+// ListModels returns the configured models, or the default echo model.
+func (c *Client) ListModels(ctx context.Context) ([]llms.Model, error) {
+	models := c.Provider.GetModelList(ctx)
+	if len(models) > 0 {
+		return models, nil
+	}
+	id := c.ModelPrefix + DefaultModel
+	return []llms.Model{{ID: id, Name: id, Object: "model"}}, nil
+}
+
+// ChatCompletion replies with the text of the last user message.
+// Streaming requests receive the reply word by word, followed by a usage chunk when requested.
+func (c *Client) ChatCompletion(ctx context.Context, req llms.ChatCompletionRequest, streamingFunc func(resp llms.StreamingChatCompletionResponse), options ...llms.RequestOption) {
+	content := lastUserMessage(req.Messages)
+	usage := llms.Usage{
+		PromptTokens:     countTokens(req.Messages...),
+		CompletionTokens: len(strings.Fields(content)),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	id := fmt.Sprintf("mock-%d", time.Now().UnixNano())
+	model := c.GetRealModel(req.Model)
+	newResponse := func(choices ...llms.ChatCompletionChoice) *llms.ChatCompletionResponse {
+		return &llms.ChatCompletionResponse{
+			ID:      id,
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   model,
+			Choices: choices,
+		}
+	}
+
+	if !req.Stream {
+		resp := newResponse(llms.ChatCompletionChoice{
+			Message:      &llms.ChatCompletionMessage{Role: llms.ChatMessageRoleAssistant, Content: content},
+			FinishReason: llms.FinishReasonStop,
+		})
+		resp.Usage = usage
+		streamingFunc(llms.StreamingChatCompletionResponse{Response: resp, Err: io.EOF})
+		return
+	}
+
+	for _, word := range strings.SplitAfter(content, " ") {
+		if err := ctx.Err(); err != nil {
+			streamingFunc(llms.StreamingChatCompletionResponse{Err: err})
+			return
+		}
+		resp := newResponse(llms.ChatCompletionChoice{
+			Delta: &llms.ChatCompletionMessage{Role: llms.ChatMessageRoleAssistant, Content: word},
+		})
+		resp.Object = "chat.completion.chunk"
+		streamingFunc(llms.StreamingChatCompletionResponse{Response: resp})
+	}
+
+	resp := newResponse(llms.ChatCompletionChoice{
+		Delta:        &llms.ChatCompletionMessage{},
+		FinishReason: llms.FinishReasonStop,
+	})
+	resp.Object = "chat.completion.chunk"
+	streamingFunc(llms.StreamingChatCompletionResponse{Response: resp})
+
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		resp := newResponse()
+		resp.Object = "chat.completion.chunk"
+		resp.Usage = usage
+		streamingFunc(llms.StreamingChatCompletionResponse{Response: resp})
+	}
+	streamingFunc(llms.StreamingChatCompletionResponse{Err: io.EOF})
+}
+
+func lastUserMessage(messages []llms.ChatCompletionMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == llms.ChatMessageRoleUser {
+			return messageText(messages[i])
+		}
+	}
+	return ""
+}
+
+func messageText(msg llms.ChatCompletionMessage) string {
+	if msg.Content != "" {
+		return msg.Content
+	}
+	parts := make([]string, 0, len(msg.MultiContent))
+	for _, part := range msg.MultiContent {
+		if part.Type == llms.ChatMessagePartTypeText {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// countTokens approximates the token count by the number of words.
+func countTokens(messages ...llms.ChatCompletionMessage) int {
+	n := 0
+	for _, msg := range messages {
+		n += len(strings.Fields(messageText(msg)))
+	}
+	return n
+}
@@ -23,9 +23,10 @@ type Client struct {
 // opts: Configuration options for the client
 func New(apiKey string, opts ...llms.Option) (*Client, error) {
 	provider := &llms.Provider{
-		Type:    llms.ProviderTypeOpenAI,
-		APIKey:  apiKey,
-		BaseURL: baseURL,
+		Type:       llms.ProviderTypeOpenAI,
+		APIKey:     apiKey,
+		BaseURL:    baseURL,
+		HttpClient: http.DefaultClient,
 	}
 	for _, opt := range opts {
 		opt(provider)
@@ -70,7 +71,7 @@ func (c *Client) ListModels(ctx context.Context) ([]llms.Model, error) {
 		if err != nil {
 			return nil, err
 		}
-		return nil, fmt.Errorf("unexpected status code: %d: %s", res.StatusCode, message)
+		return nil, &llms.StatusError{StatusCode: res.StatusCode, Body: string(message)}
 	}
 
 	// Define a struct to match the OpenAI API response format
@@ -127,7 +128,7 @@ func (c *Client) ChatCompletion(ctx context.Context, req llms.ChatCompletionRequ
 			streamingFunc(llms.StreamingChatCompletionResponse{Err: fmt.Errorf("failed to read response: %w", err)})
 			return
 		}
-		streamingFunc(llms.StreamingChatCompletionResponse{Err: fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, message)})
+		streamingFunc(llms.StreamingChatCompletionResponse{Err: &llms.StatusError{StatusCode: resp.StatusCode, Body: string(message)}})
 		return
 	}
 
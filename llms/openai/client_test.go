@@ -41,13 +41,13 @@ func TestListModels(t *testing.T) {
 				]
 			}`),
 			expectedModels: []llms.Model{
-				{ID: "gpt-4", Object: "model"},
-				{ID: "gpt-3.5-turbo", Object: "model"},
+				{ID: "gpt-4", Name: "gpt-4", Object: "model"},
+				{ID: "gpt-3.5-turbo", Name: "gpt-3.5-turbo", Object: "model"},
 			},
 		},
 		{
 			name:   "with prefix",
-			prefix: "openai",
+			prefix: "openai/",
 			serverResponse: []byte(`{
 				"object": "list",
 				"data": [
@@ -55,7 +55,7 @@ func TestListModels(t *testing.T) {
 				]
 			}`),
 			expectedModels: []llms.Model{
-				{ID: "openai/gpt-4", Object: "model"},
+				{ID: "openai/gpt-4", Name: "openai/gpt-4", Object: "model"},
 			},
 		},
 	}
@@ -69,7 +69,7 @@ func TestListModels(t *testing.T) {
 			}))
 			defer server.Close()
 
-			client, _ := New("key", llms.WithBaseURL(server.URL))
+			client, _ := New("key", llms.WithBaseURL(server.URL), llms.WithModelPrefix(tt.prefix))
 
 			models, err := client.ListModels(context.Background())
 			if tt.expectError {
@@ -60,6 +60,12 @@ func WithModelAlias(alias map[string]string) Option {
 	}
 }
 
+func WithCapabilityPolicy(policy CapabilityPolicy) Option {
+	return func(p *Provider) {
+		p.CapabilityPolicy = policy
+	}
+}
+
 func WithHttpTimeout(timeout time.Duration) Option {
 	return func(p *Provider) {
 		p.HttpTimeout = timeout
@@ -2,6 +2,8 @@ package llms
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
@@ -26,6 +28,30 @@ const (
 	ProviderTypeSiliconflow      ProviderType = "siliconflow"
 	ProviderTypeTogether         ProviderType = "together"
 	ProviderTypeFireworks        ProviderType = "fireworks"
+	// ProviderTypeMock is a local provider that echoes the last user message, it needs no API key.
+	ProviderTypeMock ProviderType = "mock"
+)
+
+// ProviderTypes are the supported provider types.
+var ProviderTypes = []ProviderType{
+	ProviderTypeOpenAICompatible, ProviderTypeOpenAI, ProviderTypeDeepSeek, ProviderTypeQwen, ProviderTypeGemini,
+	ProviderTypeOpenRouter, ProviderTypeVolcengine, ProviderTypeGroq, ProviderTypeXai, ProviderTypeSiliconflow,
+	ProviderTypeTogether, ProviderTypeFireworks, ProviderTypeMock,
+}
+
+// CapabilityPolicy is how a provider handles requests using features the model does not support,
+// according to the capabilities of the model.
+type CapabilityPolicy string
+
+const (
+	// CapabilityPolicyAdapt rewrites requests for the model: unsupported parameters are dropped,
+	// JSON output is requested by prompting and max_tokens is capped to the output limit.
+	// Requests that cannot be adapted, e.g. with images for a text only model, are rejected.
+	CapabilityPolicyAdapt CapabilityPolicy = "adapt"
+	// CapabilityPolicyReject rejects requests using unsupported features
+	CapabilityPolicyReject CapabilityPolicy = "reject"
+	// CapabilityPolicyPassthrough sends requests unchanged
+	CapabilityPolicyPassthrough CapabilityPolicy = "passthrough"
 )
 
 // Provider represents a provider of LLM services.
@@ -50,6 +76,9 @@ type Provider struct {
 	// In env it should be set as a key value value: "alias1=model1,alias2=model2"
 	ModelAlias map[string]string `json:"model_alias,omitempty"`
 
+	// CapabilityPolicy is how requests using features the model does not support are handled, adapt by default.
+	CapabilityPolicy CapabilityPolicy `json:"capability_policy,omitempty"`
+
 	// HttpTimeout is the timeout for the HTTP client.
 	HttpTimeout time.Duration `json:"timeout,omitempty"`
 	// HttpClient is the HTTP client to use.
@@ -87,11 +116,11 @@ func (p *Provider) Load() {
 
 		modelAlias := getEnvValue("MODEL_ALIAS")
 		if modelAlias != "" {
-			alias := strings.Split(modelAlias, ",")
-			p.ModelAlias = map[string]string{}
-			for _, a := range alias {
-				p.ModelAlias[strings.Split(a, ":")[0]] = strings.Split(a, ":")[1]
+			alias, err := ParseModelAlias(modelAlias)
+			if err != nil {
+				slog.Warn("ignoring invalid model aliases", "provider", p.Name, "err", err)
 			}
+			p.ModelAlias = alias
 		}
 
 		timeout := getEnvValue("TIMEOUT")
@@ -112,6 +141,33 @@ func (p *Provider) Load() {
 	}
 }
 
+// ParseModelAlias parses model aliases formatted as "alias1=model1,alias2=model2", or with ":" separators.
+// Malformed aliases are reported in the error, the valid ones are returned.
+func ParseModelAlias(s string) (map[string]string, error) {
+	alias := map[string]string{}
+	var invalid []string
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, model, ok := strings.Cut(entry, "=")
+		if !ok {
+			name, model, ok = strings.Cut(entry, ":")
+		}
+		name, model = strings.TrimSpace(name), strings.TrimSpace(model)
+		if !ok || name == "" || model == "" {
+			invalid = append(invalid, fmt.Sprintf("%q", entry))
+			continue
+		}
+		alias[name] = model
+	}
+	if len(invalid) > 0 {
+		return alias, fmt.Errorf("invalid model aliases %s, expected alias=model", strings.Join(invalid, ", "))
+	}
+	return alias, nil
+}
+
 // GetRealModel returns the real model name based on the provider's prefix and model alias.
 func (p *Provider) GetRealModel(model string) string {
 	// remove everything after ?
@@ -192,6 +248,9 @@ func (p *Provider) ToOptions() []Option {
 	if len(p.ModelAlias) != 0 {
 		opts = append(opts, WithModelAlias(p.ModelAlias))
 	}
+	if p.CapabilityPolicy != "" {
+		opts = append(opts, WithCapabilityPolicy(p.CapabilityPolicy))
+	}
 	if p.HttpTimeout != 0 {
 		opts = append(opts, WithHttpTimeout(p.HttpTimeout))
 	}
@@ -0,0 +1,25 @@
+package llms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModelAlias(t *testing.T) {
+	alias, err := ParseModelAlias("fast=gpt-4o-mini, smart:gpt-4o,local=qwen2.5:7b")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"fast": "gpt-4o-mini", "smart": "gpt-4o", "local": "qwen2.5:7b"}, alias)
+
+	alias, err = ParseModelAlias("fast=gpt-4o-mini,broken,=nothing")
+	assert.EqualError(t, err, `invalid model aliases "broken", "=nothing", expected alias=model`)
+	assert.Equal(t, map[string]string{"fast": "gpt-4o-mini"}, alias)
+}
+
+func TestProviderLoadInvalidModelAlias(t *testing.T) {
+	t.Setenv("TEST_ALIAS_MODEL_ALIAS", "fast=gpt-4o-mini,broken")
+	p := Provider{Name: "test", EnvPrefix: "TEST_ALIAS_"}
+	p.Load()
+	assert.Equal(t, map[string]string{"fast": "gpt-4o-mini"}, p.ModelAlias)
+}
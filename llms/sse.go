@@ -52,7 +52,9 @@ func StreamingSSEResponse(respBody io.ReadCloser, streamingFunc func(content Str
 			return
 		}
 
-		if len(chunk.Choices) == 0 {
+		// skip chunks that carry nothing for the caller, but keep the trailing
+		// usage chunk which has an empty choices array when include_usage is set
+		if !chunkHasData(&chunk) {
 			continue
 		}
 
@@ -69,3 +71,21 @@ func StreamingSSEResponse(respBody io.ReadCloser, streamingFunc func(content Str
 		})
 	}
 }
+
+// chunkHasData reports whether a streaming chunk carries content, tool calls,
+// a finish reason or usage statistics.
+func chunkHasData(chunk *ChatCompletionResponse) bool {
+	if chunk.Usage.TotalTokens > 0 {
+		return true
+	}
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != "" || choice.Delta == nil {
+			return true
+		}
+		delta := choice.Delta
+		if delta.Role != "" || delta.Content != "" || delta.Refusal != "" || len(delta.MultiContent) > 0 || len(delta.ToolCalls) > 0 || delta.FunctionCall != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,21 @@
 package llms
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrContentFieldsMisused = errors.New("can't use both Content and MultiContent properties simultaneously")
 )
+
+// StatusError is returned when a provider API replies with an unexpected HTTP status code.
+type StatusError struct {
+	StatusCode int
+	// Body is the body of the response, usually an error message
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d: %s", e.StatusCode, e.Body)
+}
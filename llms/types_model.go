@@ -16,4 +16,92 @@ type Model struct {
 	Name string `json:"name,omitempty"`
 	// Description provides additional information about the model
 	Description string `json:"description,omitempty"`
+	// ContextWindow is the maximum number of tokens of the prompt and the completion,
+	// 0 means unknown
+	ContextWindow int `json:"context_window,omitempty"`
+	// MaxOutputTokens is the maximum number of tokens of the completion, 0 means unknown
+	MaxOutputTokens int `json:"max_output_tokens,omitempty"`
+	// Capabilities are the features supported by the model, nil means unknown
+	Capabilities *ModelCapabilities `json:"capabilities,omitempty"`
+	// Pricing is the price of the model tokens, nil means unknown
+	Pricing *ModelPricing `json:"pricing,omitempty"`
+}
+
+// ModelPricing is the price of a model in USD per million tokens.
+type ModelPricing struct {
+	// Input is the price of prompt tokens
+	Input float64 `json:"input"`
+	// CachedInput is the price of prompt tokens read from the prompt cache, the input price when 0
+	CachedInput float64 `json:"cached_input,omitempty"`
+	// Output is the price of completion tokens
+	Output float64 `json:"output"`
+	// Reasoning is the price of reasoning tokens, the output price when 0
+	Reasoning float64 `json:"reasoning,omitempty"`
+}
+
+// Cost returns the cost of the usage in USD. Cached prompt tokens and reasoning tokens are
+// part of the prompt and completion tokens, they are billed at their own price when it is set.
+func (p ModelPricing) Cost(usage Usage) float64 {
+	cached, reasoning := 0, 0
+	if usage.PromptTokensDetails != nil {
+		cached = min(usage.PromptTokensDetails.CachedTokens, usage.PromptTokens)
+	}
+	if usage.CompletionTokensDetails != nil {
+		reasoning = min(usage.CompletionTokensDetails.ReasoningTokens, usage.CompletionTokens)
+	}
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	reasoningPrice := p.Reasoning
+	if reasoningPrice == 0 {
+		reasoningPrice = p.Output
+	}
+	cost := float64(usage.PromptTokens-cached)*p.Input +
+		float64(cached)*cachedPrice +
+		float64(usage.CompletionTokens-reasoning)*p.Output +
+		float64(reasoning)*reasoningPrice
+	return cost / 1_000_000
+}
+
+// ModelCapabilities describes the request features a model supports.
+type ModelCapabilities struct {
+	// Vision is set when the model accepts image parts in messages
+	Vision bool `json:"vision"`
+	// Tools is set when the model supports tool calling
+	Tools bool `json:"tools"`
+	// JSONMode is set when the model supports the json_object response format
+	JSONMode bool `json:"json_mode"`
+	// JSONSchema is set when the model supports the json_schema response format
+	JSONSchema bool `json:"json_schema"`
+	// ReasoningEffort is set when the model accepts the reasoning_effort parameter
+	ReasoningEffort bool `json:"reasoning_effort"`
+	// Reasoning is set for OpenAI reasoning models, which expect developer instead of system messages
+	// and max_completion_tokens instead of max_tokens, and reject sampling parameters such as temperature
+	Reasoning bool `json:"reasoning"`
+	// DeveloperRole is set for reasoning models that accept developer messages, other reasoning models
+	// such as o1-mini reject both system and developer messages
+	DeveloperRole bool `json:"developer_role"`
+	// StreamUsage is set when the model reports usage in streams with stream_options.include_usage
+	StreamUsage bool `json:"stream_usage"`
+}
+
+// MergeMetadata returns the model with the context window, output limit, capabilities and pricing
+// replaced by those set in override. Capabilities and pricing are replaced as a whole.
+func (m Model) MergeMetadata(override Model) Model {
+	if override.ContextWindow > 0 {
+		m.ContextWindow = override.ContextWindow
+	}
+	if override.MaxOutputTokens > 0 {
+		m.MaxOutputTokens = override.MaxOutputTokens
+	}
+	if override.Capabilities != nil {
+		capabilities := *override.Capabilities
+		m.Capabilities = &capabilities
+	}
+	if override.Pricing != nil {
+		pricing := *override.Pricing
+		m.Pricing = &pricing
+	}
+	return m
 }
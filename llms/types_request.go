@@ -75,6 +75,24 @@ type ChatCompletionResponseFormatJSONSchema struct {
 	Strict      bool           `json:"strict"`
 }
 
+// UnmarshalJSON implements json.Unmarshaler, the schema is kept as a json.RawMessage
+// so that decoded requests can be forwarded unchanged.
+func (s *ChatCompletionResponseFormatJSONSchema) UnmarshalJSON(data []byte) error {
+	type alias ChatCompletionResponseFormatJSONSchema
+	var raw struct {
+		alias
+		Schema json.RawMessage `json:"schema"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = ChatCompletionResponseFormatJSONSchema(raw.alias)
+	if raw.Schema != nil {
+		s.Schema = raw.Schema
+	}
+	return nil
+}
+
 // ChatCompletionRequest represents a request structure for chat completion API.
 type ChatCompletionRequest struct {
 	Model    string                  `json:"model"`
@@ -94,6 +94,22 @@ type Usage struct {
 	TotalTokens             int                      `json:"total_tokens"`
 	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details"`
 	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details"`
+	// Cost is the estimated cost in USD, set by PolyLLM for models with known pricing
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+// Add adds the tokens and the cost of usage to u, e.g. to sum the usage of the model calls of a tool loop.
+func (u *Usage) Add(usage Usage) {
+	u.PromptTokens += usage.PromptTokens
+	u.CompletionTokens += usage.CompletionTokens
+	u.TotalTokens += usage.TotalTokens
+	if usage.Cost != nil {
+		cost := *usage.Cost
+		if u.Cost != nil {
+			cost += *u.Cost
+		}
+		u.Cost = &cost
+	}
 }
 
 type Hate struct {
@@ -2,6 +2,7 @@ package polyllm
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"maps"
 	"slices"
@@ -34,9 +35,10 @@ func (p *PolyLLM) listMCPToolsByMCPNames(ctx context.Context, mcpNames []string)
 	return llmTools, nil
 }
 
-func (p *PolyLLM) getMCPToolsByModel(ctx context.Context, modelInfo string) []llms.Tool {
-	// model=gpt-4o?mcp=fetch,everything&tools=fetch,everything
-	// Extract MCP servers from model string
+// getToolsByModel returns the MCP and registered Go tools enabled by the model parameters.
+func (p *PolyLLM) getToolsByModel(ctx context.Context, modelInfo string) []llms.Tool {
+	// model=gpt-4o?mcp=fetch,everything&tools=weather,search
+	// Extract MCP servers and Go tools from model string
 	llmTools := make([]llms.Tool, 0)
 	params := strings.Split(modelInfo, "&")
 	for _, param := range params {
@@ -45,7 +47,8 @@ func (p *PolyLLM) getMCPToolsByModel(ctx context.Context, modelInfo string) []ll
 			slog.Error("invalid param", "param", param)
 			continue
 		}
-		if parts[0] == "mcp" {
+		switch parts[0] {
+		case "mcp":
 			mcpNames := strings.Split(parts[1], ",")
 			if slices.Contains(mcpNames, "all") {
 				mcpNames = slices.Sorted(maps.Keys(p.mcpClientMappings))
@@ -56,7 +59,48 @@ func (p *PolyLLM) getMCPToolsByModel(ctx context.Context, modelInfo string) []ll
 				continue
 			}
 			llmTools = append(llmTools, tools...)
+		case "tools":
+			llmTools = append(llmTools, p.getLocalToolsByNames(strings.Split(parts[1], ","))...)
 		}
 	}
 	return llmTools
 }
+
+// hasMCPTool reports whether the tool name refers to a tool of a running MCP server.
+func (p *PolyLLM) hasMCPTool(name string) bool {
+	params := strings.Split(name, "_")
+	if len(params) < 3 || params[0] != "mcp" {
+		return false
+	}
+	_, ok := p.mcpClientMappings[params[1]]
+	return ok
+}
+
+// invokeMCPTool calls an MCP tool and returns the text of its result.
+func (p *PolyLLM) invokeMCPTool(ctx context.Context, call llms.FunctionCall) (string, error) {
+	mcpName, req, err := convertLLMToolToMCPToolRequest(call)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert tool to mcp tool request: %w", err)
+	}
+	client, ok := p.mcpClientMappings[mcpName]
+	if !ok {
+		return "", fmt.Errorf("mcp server %s not found", mcpName)
+	}
+	resp, err := client.CallTool(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if resp.Content == nil {
+		return "", fmt.Errorf("tool %s returned nil response", call.Name)
+	}
+
+	var resultText string
+	for _, chunk := range resp.Content {
+		if contentMap, ok := chunk.(map[string]any); ok {
+			if text, ok := contentMap["text"].(string); ok {
+				resultText += fmt.Sprintf("%v", text)
+			}
+		}
+	}
+	return strings.TrimSpace(resultText), nil
+}
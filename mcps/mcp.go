@@ -19,8 +19,29 @@ type Provider struct {
 	Env     map[string]string `json:"env,omitempty"`
 }
 
+// initTimeout is how long CreateMCPClients waits for each MCP server to initialize
+const initTimeout = 30 * time.Second
+
+// CreateMCPClients starts and initializes the MCP servers, waiting at most 30 seconds for each one.
 func CreateMCPClients(
 	config map[string]Provider,
+) (map[string]mcpclient.MCPClient, error) {
+	return createMCPClients(context.Background(), config, initTimeout)
+}
+
+// CreateMCPClientsWithContext starts and initializes the MCP servers, giving up when ctx is done.
+func CreateMCPClientsWithContext(
+	ctx context.Context,
+	config map[string]Provider,
+) (map[string]mcpclient.MCPClient, error) {
+	return createMCPClients(ctx, config, 0)
+}
+
+// createMCPClients initializes the MCP servers with ctx, and a timeout for each one when it is positive.
+func createMCPClients(
+	ctx context.Context,
+	config map[string]Provider,
+	timeout time.Duration,
 ) (map[string]mcpclient.MCPClient, error) {
 	clients := make(map[string]mcpclient.MCPClient)
 	var err error
@@ -49,8 +70,10 @@ func CreateMCPClients(
 			)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+		initCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			initCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
 
 		slog.Info("Initializing mcp server...", "name", name)
 		initRequest := mcp.InitializeRequest{}
@@ -61,7 +84,8 @@ func CreateMCPClients(
 		}
 		initRequest.Params.Capabilities = mcp.ClientCapabilities{}
 
-		_, err = client.Initialize(ctx, initRequest)
+		_, err = client.Initialize(initCtx, initRequest)
+		cancel()
 		if err != nil {
 			client.Close()
 			for _, c := range clients {
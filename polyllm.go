@@ -4,9 +4,13 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
 	mcpclient "github.com/mark3labs/mcp-go/client"
 	"github.com/recally-io/polyllm/llms"
@@ -17,16 +21,41 @@ import (
 var builtInLLMProvidersBytes []byte
 var builtInLLMProviders []llms.Provider
 
+// mcpInitTimeout is how long NewFromConfig waits for each MCP server to initialize
+const mcpInitTimeout = 30 * time.Second
+
 type PolyLLM struct {
 	Config
 	llms              []LLM
 	modelLLMMappings  map[string]LLM
+	models            map[string]llms.Model
 	mcpClientMappings map[string]mcpclient.MCPClient
+	// mcpErrs are the initialization errors of the MCP servers by name
+	mcpErrs map[string]error
+	// skipped are the providers and MCP servers that failed to start
+	skipped []SkippedComponent
+	// providerStates are the states of the providers with an API key by name
+	providerStates map[string]*providerState
+
+	toolsMu    sync.RWMutex
+	localTools map[string]localTool
 }
 
 type Config struct {
 	LLMProvides  []llms.Provider          `json:"llms"`
 	MCPProviders map[string]mcps.Provider `json:"mcps"`
+	// Truncation trims requests exceeding the context window of their model, nil disables it
+	Truncation *TruncationConfig `json:"truncation,omitempty"`
+	// CircuitBreaker stops sending requests to providers failing repeatedly, nil disables it
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+	// Fallbacks are the models, in order, to send the requests of a model to when it fails before replying,
+	// e.g. because the circuit of its provider is open
+	Fallbacks map[string][]string `json:"fallbacks,omitempty"`
+	// InitMode decides whether NewWithContext fails or skips the providers and MCP servers failing to start,
+	// it defaults to lenient
+	InitMode InitMode `json:"init_mode,omitempty"`
+	// ToolCallHook is called after each tool call executed by the agent loop, e.g. to record metrics
+	ToolCallHook func(ctx context.Context, info ToolCallInfo) `json:"-"`
 }
 
 func init() {
@@ -35,14 +64,11 @@ func init() {
 	}
 }
 
+// LoadConfig reads a JSON, YAML or TOML config file, see ReadConfigFile for includes and interpolation.
 func LoadConfig(configPath string) (Config, error) {
 	var cfg Config
-	configFile, err := os.ReadFile(configPath)
-	if err != nil {
-		return Config{}, fmt.Errorf("failed to read config file: %w", err)
-	}
-	if err := json.Unmarshal(configFile, &cfg); err != nil {
-		return Config{}, fmt.Errorf("failed to load config file: %w", err)
+	if err := ReadConfigFile(configPath, &cfg); err != nil {
+		return Config{}, err
 	}
 	return cfg, nil
 }
@@ -61,20 +87,82 @@ func WithLLMProviders(providers ...llms.Provider) Option {
 	}
 }
 
+// WithTruncation trims requests exceeding the context window of their model with the given strategy.
+func WithTruncation(truncation TruncationConfig) Option {
+	return func(c *Config) {
+		c.Truncation = &truncation
+	}
+}
+
+// WithCircuitBreaker enables a circuit breaker per provider.
+func WithCircuitBreaker(cfg CircuitBreakerConfig) Option {
+	return func(c *Config) {
+		c.CircuitBreaker = &cfg
+	}
+}
+
+// WithFallbacks sends the requests of model to the fallback models, in order, when it fails before replying.
+func WithFallbacks(model string, fallbacks ...string) Option {
+	return func(c *Config) {
+		if c.Fallbacks == nil {
+			c.Fallbacks = make(map[string][]string)
+		}
+		c.Fallbacks[model] = fallbacks
+	}
+}
+
+// WithToolCallHook calls hook after each tool call executed by the agent loop.
+func WithToolCallHook(hook func(ctx context.Context, info ToolCallInfo)) Option {
+	return func(c *Config) {
+		c.ToolCallHook = hook
+	}
+}
+
+// NewFromConfig creates a PolyLLM, skipping the providers and MCP servers failing to start whatever the init mode,
+// see InitReport. Each MCP server has 30 seconds to initialize.
 func NewFromConfig(cfg Config) *PolyLLM {
-	cfg.LLMProvides = append(builtInLLMProviders, cfg.LLMProvides...)
-	p := &PolyLLM{
+	p := newPolyLLM(cfg)
+	p.start(context.Background(), mcpInitTimeout)
+	return p
+}
+
+// NewWithContext creates a PolyLLM, listing the models of its providers and initializing its MCP servers until ctx
+// is done. In the strict init mode, it returns an *InitError when a provider or an MCP server fails to start,
+// in the lenient mode they are skipped and listed by InitReport.
+func NewWithContext(ctx context.Context, cfg Config) (*PolyLLM, error) {
+	p := newPolyLLM(cfg)
+	p.start(ctx, 0)
+	if err := ctx.Err(); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to start polyllm: %w", err)
+	}
+	if cfg.InitMode == InitModeStrict && len(p.skipped) > 0 {
+		p.Close()
+		return nil, &InitError{Report: p.InitReport()}
+	}
+	return p, nil
+}
+
+func newPolyLLM(cfg Config) *PolyLLM {
+	// copy the built-in providers, so that configs built one after the other do not share an array
+	cfg.LLMProvides = slices.Concat(builtInLLMProviders, cfg.LLMProvides)
+	return &PolyLLM{
 		llms:              make([]LLM, 0),
 		modelLLMMappings:  make(map[string]LLM),
+		models:            make(map[string]llms.Model),
 		mcpClientMappings: make(map[string]mcpclient.MCPClient),
+		mcpErrs:           make(map[string]error),
+		providerStates:    make(map[string]*providerState),
+		localTools:        make(map[string]localTool),
 		Config:            cfg,
 	}
-	// add llm providers
-	p.addLLMProviders(p.Config.LLMProvides...)
-	// add mcp providers
-	p.addMCPProviders(p.Config.MCPProviders)
+}
 
-	return p
+// start adds the llm and mcp providers of the config, mcpTimeout limits the initialization of each MCP server
+// when it is positive.
+func (p *PolyLLM) start(ctx context.Context, mcpTimeout time.Duration) {
+	p.addLLMProviders(ctx, p.Config.LLMProvides...)
+	p.addMCPProviders(ctx, p.Config.MCPProviders, mcpTimeout)
 }
 
 func New(opts ...Option) *PolyLLM {
@@ -85,37 +173,59 @@ func New(opts ...Option) *PolyLLM {
 	return NewFromConfig(cfg)
 }
 
-func (p *PolyLLM) addLLMProviders(providers ...llms.Provider) {
+func (p *PolyLLM) addLLMProviders(ctx context.Context, providers ...llms.Provider) {
 	for _, provider := range providers {
+		if ctx.Err() != nil {
+			return
+		}
 		provider.Load()
-		if provider.APIKey != "" {
+		if provider.APIKey != "" || provider.Type == llms.ProviderTypeMock {
+			state := newProviderState(&provider, p.CircuitBreaker)
+			p.providerStates[provider.Name] = state
 			llm, err := NewLLM(&provider)
 			if err != nil {
 				slog.Error("failed to create llm client", "provider", provider.Name, "err", err)
+				state.recordError(err)
+				p.skip("provider", provider.Name, "client", err)
 				continue
 			}
 			p.llms = append(p.llms, llm)
 
-			models, err := p.loadProviderModelsWithCache(context.Background(), llm)
+			models, err := p.loadProviderModelsWithCache(ctx, llm)
 			if err != nil {
 				slog.Error("failed to load llm models", "provider", provider.Name, "err", err)
+				state.recordError(err)
+				p.skip("provider", provider.Name, "models", err)
 				continue
 			}
-			for _, model := range models {
+			state.usable = true
+			for _, model := range p.describeModels(llm, models) {
 				p.modelLLMMappings[model.ID] = llm
+				p.models[model.ID] = model
 			}
 		}
 	}
 }
 
-func (p *PolyLLM) addMCPProviders(providers map[string]mcps.Provider) {
-	// start MCP clients
-	if len(providers) > 0 {
-		mcpClients, err := mcps.CreateMCPClients(providers)
+// addMCPProviders starts the MCP clients one by one, so that a failing server does not stop the others.
+func (p *PolyLLM) addMCPProviders(ctx context.Context, providers map[string]mcps.Provider, timeout time.Duration) {
+	for _, name := range slices.Sorted(maps.Keys(providers)) {
+		if ctx.Err() != nil {
+			return
+		}
+		initCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			initCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		clients, err := mcps.CreateMCPClientsWithContext(initCtx, map[string]mcps.Provider{name: providers[name]})
+		cancel()
 		if err != nil {
-			slog.Error("failed to create MCP clients", "err", err)
+			slog.Error("failed to create MCP client", "mcp", name, "err", err)
+			p.mcpErrs[name] = err
+			p.skip("mcp", name, "initialize", err)
+			continue
 		}
-		p.mcpClientMappings = mcpClients
+		p.mcpClientMappings[name] = clients[name]
 	}
 }
 
@@ -126,3 +236,14 @@ func (p *PolyLLM) GetLLMByModel(model string) (LLM, error) {
 	}
 	return llm, nil
 }
+
+// Close closes the clients of the MCP servers, stopping the servers started with a command.
+func (p *PolyLLM) Close() error {
+	var errs []error
+	for name, client := range p.mcpClientMappings {
+		if err := client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close MCP client %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+package polyllm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InitMode decides what NewWithContext does when a provider or an MCP server fails to start.
+type InitMode string
+
+const (
+	// InitModeLenient skips the providers and MCP servers failing to start, they are listed by InitReport
+	InitModeLenient InitMode = "lenient"
+	// InitModeStrict makes NewWithContext return an *InitError when a provider or an MCP server fails to start
+	InitModeStrict InitMode = "strict"
+)
+
+// SkippedComponent is a provider or an MCP server that failed to start.
+type SkippedComponent struct {
+	// Kind is provider or mcp
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Stage is the step that failed: client, models or initialize
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+	Err   error  `json:"-"`
+}
+
+func (c SkippedComponent) String() string {
+	return fmt.Sprintf("%s %s: %s", c.Kind, c.Name, c.Error)
+}
+
+// InitReport lists the providers and MCP servers skipped when a PolyLLM was created.
+type InitReport struct {
+	Skipped []SkippedComponent `json:"skipped"`
+}
+
+// InitError is returned by NewWithContext in the strict init mode, with the components that failed to start.
+type InitError struct {
+	Report InitReport
+}
+
+func (e *InitError) Error() string {
+	skipped := make([]string, len(e.Report.Skipped))
+	for i, component := range e.Report.Skipped {
+		skipped[i] = component.String()
+	}
+	return "failed to start polyllm: " + strings.Join(skipped, "; ")
+}
+
+func (e *InitError) Unwrap() []error {
+	errs := make([]error, len(e.Report.Skipped))
+	for i, component := range e.Report.Skipped {
+		errs[i] = component.Err
+	}
+	return errs
+}
+
+// InitReport returns the providers and MCP servers skipped because they failed to start.
+func (p *PolyLLM) InitReport() InitReport {
+	return InitReport{Skipped: append([]SkippedComponent{}, p.skipped...)}
+}
+
+// skip records a component that failed to start.
+func (p *PolyLLM) skip(kind, name, stage string, err error) {
+	p.skipped = append(p.skipped, SkippedComponent{Kind: kind, Name: name, Stage: stage, Error: err.Error(), Err: err})
+}
@@ -0,0 +1,82 @@
+package polyllm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/mcps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStartupConfig(t *testing.T, mode InitMode) Config {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "unavailable"}}`, http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+	return Config{
+		InitMode: mode,
+		LLMProvides: []llms.Provider{
+			{Name: "test-startup-up", Type: llms.ProviderTypeMock, Models: []llms.Model{{ID: "startup-model"}}},
+			{Name: "test-startup-down", Type: llms.ProviderTypeOpenAICompatible, BaseURL: server.URL, APIKey: "test"},
+		},
+		MCPProviders: map[string]mcps.Provider{"missing": {Command: "polyllm-test-missing-command"}},
+	}
+}
+
+func TestNewWithContextLenient(t *testing.T) {
+	p, err := NewWithContext(context.Background(), newStartupConfig(t, InitModeLenient))
+	require.NoError(t, err)
+	defer p.Close()
+
+	_, err = p.GetLLMByModel("startup-model")
+	assert.NoError(t, err)
+	report := p.InitReport()
+	require.Len(t, report.Skipped, 2)
+	assert.Equal(t, "provider", report.Skipped[0].Kind)
+	assert.Equal(t, "test-startup-down", report.Skipped[0].Name)
+	assert.Equal(t, "models", report.Skipped[0].Stage)
+	assert.Equal(t, "mcp", report.Skipped[1].Kind)
+	assert.Equal(t, "missing", report.Skipped[1].Name)
+	assert.Equal(t, "initialize", report.Skipped[1].Stage)
+	assert.NotEmpty(t, p.MCPStatuses()[0].Error)
+}
+
+func TestNewWithContextStrict(t *testing.T) {
+	p, err := NewWithContext(context.Background(), newStartupConfig(t, InitModeStrict))
+	assert.Nil(t, p)
+	var initErr *InitError
+	require.True(t, errors.As(err, &initErr))
+	require.Len(t, initErr.Report.Skipped, 2)
+	assert.ErrorContains(t, err, "provider test-startup-down: ")
+	assert.ErrorContains(t, err, "mcp missing: ")
+}
+
+func TestNewWithContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p, err := NewWithContext(ctx, newStartupConfig(t, InitModeLenient))
+	assert.Nil(t, p)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewFromConfigDoesNotShareProviders(t *testing.T) {
+	newConfig := func(name string) Config {
+		return Config{LLMProvides: []llms.Provider{{Name: name, Type: llms.ProviderTypeMock, Models: []llms.Model{{ID: name + "-model"}}}}}
+	}
+	first := NewFromConfig(newConfig("test-generation-1"))
+	defer first.Close()
+	second := NewFromConfig(newConfig("test-generation-2"))
+	defer second.Close()
+
+	providers := first.Config.LLMProvides
+	assert.Equal(t, "test-generation-1", providers[len(providers)-1].Name)
+	providers = second.Config.LLMProvides
+	assert.Equal(t, "test-generation-2", providers[len(providers)-1].Name)
+	assert.Len(t, builtInLLMProviders, len(providers)-1)
+}
@@ -0,0 +1,191 @@
+package polyllm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/recally-io/polyllm/llms"
+)
+
+// latencyWindow is the number of recent requests the latency of a provider is averaged over.
+const latencyWindow = 20
+
+// ProviderStatus is the state of a provider and of the requests recently sent to it.
+type ProviderStatus struct {
+	Name string            `json:"name"`
+	Type llms.ProviderType `json:"type"`
+	// Models are the IDs of the models served by the provider
+	Models []string `json:"models"`
+	// Usable reports whether the client of the provider was created and its models were loaded
+	Usable      bool       `json:"usable"`
+	Requests    int64      `json:"requests"`
+	Errors      int64      `json:"errors"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	// LatencyMS is the average time to the first response of the recent requests, in milliseconds
+	LatencyMS float64 `json:"latency_ms"`
+	// Circuit is the state of the circuit breaker of the provider, empty when circuit breakers are disabled
+	Circuit CircuitState `json:"circuit,omitempty"`
+}
+
+// MCPStatus is the state of a configured MCP server.
+type MCPStatus struct {
+	Name        string `json:"name"`
+	Initialized bool   `json:"initialized"`
+	Error       string `json:"error,omitempty"`
+}
+
+// providerState records the outcome of the requests sent to a provider.
+type providerState struct {
+	provider *llms.Provider
+	usable   bool
+	// breaker is nil when circuit breakers are disabled
+	breaker *circuitBreaker
+
+	mu          sync.Mutex
+	requests    int64
+	errors      int64
+	lastError   string
+	lastErrorAt time.Time
+	latencies   []time.Duration
+}
+
+func newProviderState(provider *llms.Provider, breaker *CircuitBreakerConfig) *providerState {
+	s := &providerState{provider: provider}
+	if breaker != nil {
+		s.breaker = newCircuitBreaker(*breaker)
+	}
+	return s
+}
+
+// allow reports whether the circuit breaker of the provider lets a request through.
+func (s *providerState) allow() bool {
+	return s.breaker == nil || s.breaker.allow()
+}
+
+func (s *providerState) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors++
+	s.lastError = err.Error()
+	s.lastErrorAt = time.Now()
+}
+
+// observe records a request and its latency, errors canceled by the caller are not errors of the provider.
+func (s *providerState) observe(latency time.Duration, err error) {
+	s.mu.Lock()
+	s.requests++
+	if len(s.latencies) == latencyWindow {
+		s.latencies = s.latencies[1:]
+	}
+	s.latencies = append(s.latencies, latency)
+	s.mu.Unlock()
+	if s.breaker != nil {
+		s.breaker.record(err)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		s.recordError(err)
+	}
+}
+
+// wrap observes the latency of the first response and the outcome of the request: its final response,
+// an error or io.EOF, is recorded once before it is forwarded. The returned done must be called once the
+// request returned, it releases a request whose final response never came without blaming the provider.
+func (s *providerState) wrap(streamingFunc func(resp llms.StreamingChatCompletionResponse)) (func(resp llms.StreamingChatCompletionResponse), func()) {
+	start := time.Now()
+	var latency time.Duration
+	finished := false
+	wrapped := func(resp llms.StreamingChatCompletionResponse) {
+		if latency == 0 && (resp.Response != nil || resp.Err != nil) {
+			latency = time.Since(start)
+		}
+		if !finished && resp.Err != nil {
+			finished = true
+			err := resp.Err
+			if err == io.EOF {
+				err = nil
+			}
+			s.observe(latency, err)
+		}
+		streamingFunc(resp)
+	}
+	done := func() {
+		if !finished {
+			finished = true
+			s.release()
+		}
+	}
+	return wrapped, done
+}
+
+// release frees the circuit breaker slot of a request that ended without an outcome.
+func (s *providerState) release() {
+	if s.breaker != nil {
+		s.breaker.record(context.Canceled)
+	}
+}
+
+func (s *providerState) status(models []string) ProviderStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := ProviderStatus{
+		Name:      s.provider.Name,
+		Type:      s.provider.Type,
+		Models:    models,
+		Usable:    s.usable,
+		Requests:  s.requests,
+		Errors:    s.errors,
+		LastError: s.lastError,
+	}
+	if !s.lastErrorAt.IsZero() {
+		lastErrorAt := s.lastErrorAt
+		status.LastErrorAt = &lastErrorAt
+	}
+	if len(s.latencies) > 0 {
+		var total time.Duration
+		for _, latency := range s.latencies {
+			total += latency
+		}
+		status.LatencyMS = float64(total.Microseconds()) / float64(len(s.latencies)) / 1000
+	}
+	if s.breaker != nil {
+		status.Circuit = s.breaker.State()
+	}
+	return status
+}
+
+// ProviderStatuses returns the status of the providers with an API key, sorted by name.
+func (p *PolyLLM) ProviderStatuses() []ProviderStatus {
+	models := make(map[string][]string)
+	for id, llm := range p.modelLLMMappings {
+		name := llm.GetProvider().Name
+		models[name] = append(models[name], id)
+	}
+	statuses := make([]ProviderStatus, 0, len(p.providerStates))
+	for _, name := range slices.Sorted(maps.Keys(p.providerStates)) {
+		providerModels := models[name]
+		slices.Sort(providerModels)
+		statuses = append(statuses, p.providerStates[name].status(providerModels))
+	}
+	return statuses
+}
+
+// MCPStatuses returns the status of the configured MCP servers, sorted by name.
+func (p *PolyLLM) MCPStatuses() []MCPStatus {
+	statuses := make([]MCPStatus, 0, len(p.MCPProviders))
+	for _, name := range slices.Sorted(maps.Keys(p.MCPProviders)) {
+		status := MCPStatus{Name: name}
+		if _, ok := p.mcpClientMappings[name]; ok {
+			status.Initialized = true
+		} else if err := p.mcpErrs[name]; err != nil {
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,93 @@
+package polyllm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/mcps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderStatuses(t *testing.T) {
+	server, _ := newTestServer(t, llms.ChatCompletionMessage{Content: "ok"})
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(broken.Close)
+	p := New(WithLLMProviders(
+		llms.Provider{Type: llms.ProviderTypeOpenAI, Name: "test-up", BaseURL: server.URL, APIKey: "test", Models: []llms.Model{{ID: "up-model"}}},
+		llms.Provider{Type: llms.ProviderTypeOpenAI, Name: "test-down", BaseURL: broken.URL, APIKey: "test", Models: []llms.Model{{ID: "down-model"}}},
+	))
+
+	for _, model := range []string{"up-model", "up-model", "down-model"} {
+		p.ChatCompletion(context.Background(), llms.ChatCompletionRequest{
+			Model:    model,
+			Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "hi"}},
+		}, func(resp llms.StreamingChatCompletionResponse) {})
+	}
+
+	statuses := make(map[string]ProviderStatus)
+	for _, status := range p.ProviderStatuses() {
+		statuses[status.Name] = status
+	}
+	up := statuses["test-up"]
+	assert.True(t, up.Usable)
+	assert.Equal(t, []string{"up-model"}, up.Models)
+	assert.Equal(t, int64(2), up.Requests)
+	assert.Zero(t, up.Errors)
+	assert.Empty(t, up.LastError)
+	assert.Nil(t, up.LastErrorAt)
+	assert.Positive(t, up.LatencyMS)
+
+	down := statuses["test-down"]
+	assert.True(t, down.Usable)
+	assert.Equal(t, int64(1), down.Requests)
+	assert.Equal(t, int64(1), down.Errors)
+	assert.NotEmpty(t, down.LastError)
+	require.NotNil(t, down.LastErrorAt)
+}
+
+func TestProviderStatusStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"partial\"}}]}\n\n")
+		fmt.Fprint(w, "data: {broken\n\n")
+	}))
+	t.Cleanup(server.Close)
+	p := New(WithLLMProviders(llms.Provider{Type: llms.ProviderTypeOpenAI, Name: "test-stream-error", BaseURL: server.URL, APIKey: "test", Models: []llms.Model{{ID: "stream-model"}}}))
+
+	var err error
+	p.ChatCompletion(context.Background(), llms.ChatCompletionRequest{
+		Model:    "stream-model",
+		Stream:   true,
+		Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "hi"}},
+	}, func(resp llms.StreamingChatCompletionResponse) {
+		if resp.Err != nil && resp.Err != io.EOF {
+			err = resp.Err
+		}
+	})
+	require.Error(t, err)
+
+	// the error after the first chunk is the outcome of the request
+	statuses := p.ProviderStatuses()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, int64(1), statuses[0].Requests)
+	assert.Equal(t, int64(1), statuses[0].Errors)
+	assert.Contains(t, statuses[0].LastError, "unmarshaling")
+}
+
+func TestMCPStatuses(t *testing.T) {
+	p := New(WithMCPProviders(map[string]mcps.Provider{"missing": {Command: "polyllm-test-missing-command"}}))
+
+	statuses := p.MCPStatuses()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "missing", statuses[0].Name)
+	assert.False(t, statuses[0].Initialized)
+	assert.NotEmpty(t, statuses[0].Error)
+}
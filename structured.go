@@ -0,0 +1,192 @@
+package polyllm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/recally-io/polyllm/jsonschema"
+	"github.com/recally-io/polyllm/llms"
+)
+
+// GenerateObjectMaxAttempts is the number of requests GenerateObject sends before giving up on invalid replies.
+var GenerateObjectMaxAttempts = 3
+
+// ErrInvalidObject is returned when the model does not reply with an object matching the schema
+var ErrInvalidObject = errors.New("invalid object")
+
+// jsonSchemaProviders are the provider types whose APIs support the json_schema response format,
+// they are used for models without known capabilities. Other providers are asked to call a tool
+// whose parameters are the schema.
+var jsonSchemaProviders = map[llms.ProviderType]bool{
+	llms.ProviderTypeOpenAI:     true,
+	llms.ProviderTypeGemini:     true,
+	llms.ProviderTypeOpenRouter: true,
+	llms.ProviderTypeXai:        true,
+	llms.ProviderTypeFireworks:  true,
+	llms.ProviderTypeTogether:   true,
+}
+
+var schemaNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// GenerateObject asks the model for a reply matching the JSON Schema reflected from T and decodes it.
+// See jsonschema.Reflect for the supported struct tags.
+//
+// The schema is sent as a json_schema response format, or as a forced tool call for models
+// without json_schema support. Replies that are not valid JSON or do not match the schema are
+// retried with the validation error fed back, up to GenerateObjectMaxAttempts requests.
+func GenerateObject[T any](ctx context.Context, p *PolyLLM, req llms.ChatCompletionRequest, options ...llms.RequestOption) (T, error) {
+	var result T
+	schema, err := jsonschema.Reflect[T]()
+	if err != nil {
+		return result, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	if schema.Type != jsonschema.Object {
+		return result, fmt.Errorf("%w: the schema of %T must be an object", ErrUnsupportedOperation, result)
+	}
+
+	llm, _, _, err := p.preProcess(ctx, req.Model)
+	if err != nil {
+		return result, err
+	}
+
+	name := schemaNameInvalidChars.ReplaceAllString(reflect.TypeFor[T]().Name(), "_")
+	if name == "" {
+		name = "response"
+	}
+	useTool := !jsonSchemaProviders[llm.GetProvider().Type]
+	if model, ok := p.GetModel(req.Model); ok && model.Capabilities != nil {
+		// models without tool support get the response format, which is emulated by prompting, see AdaptRequest
+		useTool = !model.Capabilities.JSONSchema && model.Capabilities.Tools
+	}
+
+	req.Stream = false
+	req.StreamOptions = nil
+	req.Messages = append([]llms.ChatCompletionMessage{}, req.Messages...)
+	if useTool {
+		req.Tools = append(append([]llms.Tool{}, req.Tools...), llms.Tool{
+			Type: llms.ToolTypeFunction,
+			Function: &llms.FunctionDefinition{
+				Name:        name,
+				Description: "Respond with the result by calling this function.",
+				Parameters:  schema,
+			},
+		})
+		req.ToolChoice = llms.ToolChoice{Type: llms.ToolTypeFunction, Function: llms.ToolFunction{Name: name}}
+	} else {
+		req.ResponseFormat = &llms.ChatCompletionResponseFormat{
+			Type: llms.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &llms.ChatCompletionResponseFormatJSONSchema{
+				Name:   name,
+				Schema: schema,
+			},
+		}
+	}
+
+	req, err = p.truncateRequest(ctx, req, true)
+	if err != nil {
+		return result, err
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= GenerateObjectMaxAttempts; attempt++ {
+		message, err := p.completeMessage(ctx, req, options...)
+		if err != nil {
+			return result, err
+		}
+
+		data := message.Content
+		var toolCall *llms.ToolCall
+		if useTool {
+			for i := range message.ToolCalls {
+				if message.ToolCalls[i].Function.Name == name {
+					toolCall = &message.ToolCalls[i]
+					data = toolCall.Function.Arguments
+					break
+				}
+			}
+		}
+
+		lastErr = decodeObject(schema, TrimJSONFence(data), &result)
+		if lastErr == nil {
+			return result, nil
+		}
+		if useTool && toolCall == nil {
+			lastErr = fmt.Errorf("the reply did not call the %s function", name)
+		}
+
+		// feed the error back so the model can correct its reply, every tool call must be answered
+		req.Messages = append(req.Messages, message)
+		feedback := fmt.Sprintf("The reply is invalid: %v. Respond again with JSON matching the schema.", lastErr)
+		for _, call := range message.ToolCalls {
+			content := fmt.Sprintf("The %s function is not available.", call.Function.Name)
+			if toolCall != nil && call.ID == toolCall.ID {
+				content = feedback
+			}
+			req.Messages = append(req.Messages, llms.ChatCompletionMessage{
+				Role:       llms.ChatMessageRoleTool,
+				ToolCallID: call.ID,
+				Content:    content,
+			})
+		}
+		if toolCall == nil {
+			req.Messages = append(req.Messages, llms.ChatCompletionMessage{
+				Role:    llms.ChatMessageRoleUser,
+				Content: feedback,
+			})
+		}
+	}
+	return result, fmt.Errorf("%w after %d attempts: %w", ErrInvalidObject, GenerateObjectMaxAttempts, lastErr)
+}
+
+// completeMessage sends a non-streaming request and returns the reply message.
+// Tool calls are returned to the caller instead of being invoked.
+func (p *PolyLLM) completeMessage(ctx context.Context, req llms.ChatCompletionRequest, options ...llms.RequestOption) (llms.ChatCompletionMessage, error) {
+	var (
+		message llms.ChatCompletionMessage
+		outErr  error
+	)
+	p.chatCompletion(ctx, req, func(resp llms.StreamingChatCompletionResponse) {
+		if resp.Err != nil && resp.Err != io.EOF {
+			outErr = resp.Err
+			return
+		}
+		if resp.Response != nil && len(resp.Response.Choices) > 0 && resp.Response.Choices[0].Message != nil {
+			message = *resp.Response.Choices[0].Message
+		}
+	}, options...)
+	if outErr != nil {
+		return message, outErr
+	}
+	if message.Role == "" {
+		message.Role = llms.ChatMessageRoleAssistant
+	}
+	return message, nil
+}
+
+// decodeObject validates data against the schema and decodes it into v.
+func decodeObject(schema jsonschema.Definition, data string, v any) error {
+	if err := jsonschema.ValidateJSON(schema, []byte(data)); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+// TrimJSONFence strips the markdown code fence models often wrap JSON replies in, e.g. "```json\n{}\n```".
+func TrimJSONFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+	content = strings.TrimPrefix(content, "```")
+	// drop the language tag of the fence
+	if idx := strings.Index(content, "\n"); idx >= 0 {
+		content = content[idx+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(content), "```"))
+}
@@ -0,0 +1,189 @@
+package polyllm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCity struct {
+	Name       string `json:"name"`
+	Population int    `json:"population" jsonschema:"description=Number of inhabitants"`
+}
+
+// newTestServer starts an OpenAI compatible server that replies with the given messages in order
+// and records the requests it receives. Streaming replies send the tool call arguments in two chunks
+// and end with a usage chunk when it is requested.
+func newTestServer(t *testing.T, replies ...llms.ChatCompletionMessage) (*httptest.Server, *[]llms.ChatCompletionRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := make([]llms.ChatCompletionRequest, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req llms.ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		requests = append(requests, req)
+		reply := replies[min(len(requests), len(replies))-1]
+		mu.Unlock()
+		reply.Role = llms.ChatMessageRoleAssistant
+
+		finishReason := llms.FinishReasonStop
+		if len(reply.ToolCalls) > 0 {
+			finishReason = llms.FinishReasonToolCalls
+		}
+		if !req.Stream {
+			json.NewEncoder(w).Encode(llms.ChatCompletionResponse{
+				ID:      "test",
+				Model:   req.Model,
+				Choices: []llms.ChatCompletionChoice{{Message: &reply, FinishReason: finishReason}},
+				Usage:   llms.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			})
+			return
+		}
+
+		writeChunk := func(delta llms.ChatCompletionMessage, finishReason llms.FinishReason) {
+			data, err := json.Marshal(llms.ChatCompletionResponse{
+				ID:      "test",
+				Model:   req.Model,
+				Choices: []llms.ChatCompletionChoice{{Delta: &delta, FinishReason: finishReason}},
+			})
+			require.NoError(t, err)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		if reply.Content != "" {
+			writeChunk(llms.ChatCompletionMessage{Role: reply.Role, Content: reply.Content}, "")
+		}
+		for i, toolCall := range reply.ToolCalls {
+			args := toolCall.Function.Arguments
+			first := toolCall
+			first.Index = &i
+			first.Function.Arguments = args[:len(args)/2]
+			writeChunk(llms.ChatCompletionMessage{ToolCalls: []llms.ToolCall{first}}, "")
+			rest := llms.ToolCall{Index: &i, Function: llms.FunctionCall{Arguments: args[len(args)/2:]}}
+			writeChunk(llms.ChatCompletionMessage{ToolCalls: []llms.ToolCall{rest}}, "")
+		}
+		writeChunk(llms.ChatCompletionMessage{}, finishReason)
+		if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+			data, err := json.Marshal(llms.ChatCompletionResponse{
+				ID:      "test",
+				Model:   req.Model,
+				Choices: []llms.ChatCompletionChoice{},
+				Usage:   llms.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			})
+			require.NoError(t, err)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestPolyLLM(providerType llms.ProviderType, baseURL string) *PolyLLM {
+	return New(WithLLMProviders(llms.Provider{
+		Type:    providerType,
+		Name:    "test-" + string(providerType),
+		BaseURL: baseURL,
+		APIKey:  "test",
+		Models:  []llms.Model{{ID: "test-model"}},
+	}))
+}
+
+func TestGenerateObjectJSONSchema(t *testing.T) {
+	server, requests := newTestServer(t,
+		llms.ChatCompletionMessage{Content: `{"name": "Paris"}`},
+		llms.ChatCompletionMessage{Content: "```json\n{\"name\": \"Paris\", \"population\": 2100000}\n```"},
+	)
+	p := newTestPolyLLM(llms.ProviderTypeOpenAI, server.URL)
+
+	city, err := GenerateObject[testCity](context.Background(), p, llms.ChatCompletionRequest{
+		Model:    "test-model",
+		Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "Largest city of France?"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, testCity{Name: "Paris", Population: 2100000}, city)
+
+	require.Len(t, *requests, 2)
+	first := (*requests)[0]
+	require.NotNil(t, first.ResponseFormat)
+	assert.Equal(t, llms.ChatCompletionResponseFormatTypeJSONSchema, first.ResponseFormat.Type)
+	assert.Equal(t, "testCity", first.ResponseFormat.JSONSchema.Name)
+	assert.Empty(t, first.Tools)
+
+	// the retry contains the invalid reply and the validation error
+	retry := (*requests)[1].Messages
+	require.Len(t, retry, 3)
+	assert.Equal(t, `{"name": "Paris"}`, retry[1].Content)
+	assert.Contains(t, retry[2].Content, `missing required property "population"`)
+}
+
+func TestGenerateObjectToolFallback(t *testing.T) {
+	toolCall := func(arguments string) llms.ChatCompletionMessage {
+		return llms.ChatCompletionMessage{ToolCalls: []llms.ToolCall{{
+			ID:       "call_1",
+			Type:     llms.ToolTypeFunction,
+			Function: llms.FunctionCall{Name: "testCity", Arguments: arguments},
+		}}}
+	}
+	// the first reply also calls a tool of the caller
+	first := toolCall(`{"name": "Paris"`)
+	first.ToolCalls = append([]llms.ToolCall{{ID: "call_0", Type: llms.ToolTypeFunction, Function: llms.FunctionCall{Name: "search", Arguments: "{}"}}}, first.ToolCalls...)
+	server, requests := newTestServer(t, first, toolCall(`{"name": "Paris", "population": 2100000}`))
+	p := newTestPolyLLM(llms.ProviderTypeDeepSeek, server.URL)
+
+	tools := make([]llms.Tool, 1, 2)
+	tools[0] = llms.Tool{Type: llms.ToolTypeFunction, Function: &llms.FunctionDefinition{Name: "search"}}
+	city, err := GenerateObject[testCity](context.Background(), p, llms.ChatCompletionRequest{
+		Model:    "test-model",
+		Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "Largest city of France?"}},
+		Tools:    tools,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", city.Name)
+	assert.Empty(t, tools[:2][1], "the caller tools are not modified")
+
+	request := (*requests)[0]
+	assert.Nil(t, request.ResponseFormat)
+	require.Len(t, request.Tools, 2)
+	assert.Equal(t, "testCity", request.Tools[1].Function.Name)
+
+	// every tool call of the reply is answered
+	retry := (*requests)[1].Messages
+	require.Len(t, retry, 4)
+	assert.Equal(t, llms.ChatMessageRoleTool, retry[2].Role)
+	assert.Equal(t, "call_0", retry[2].ToolCallID)
+	assert.Contains(t, retry[2].Content, "not available")
+	assert.Equal(t, llms.ChatMessageRoleTool, retry[3].Role)
+	assert.Equal(t, "call_1", retry[3].ToolCallID)
+	assert.Contains(t, retry[3].Content, "invalid JSON")
+}
+
+func TestGenerateObjectGivesUp(t *testing.T) {
+	server, requests := newTestServer(t, llms.ChatCompletionMessage{Content: "I don't know"})
+	p := newTestPolyLLM(llms.ProviderTypeOpenAI, server.URL)
+
+	_, err := GenerateObject[testCity](context.Background(), p, llms.ChatCompletionRequest{Model: "test-model"})
+	assert.ErrorIs(t, err, ErrInvalidObject)
+	assert.Len(t, *requests, GenerateObjectMaxAttempts)
+}
+
+func TestTrimJSONFence(t *testing.T) {
+	tests := map[string]string{
+		`{"a": 1}`:                       `{"a": 1}`,
+		"  {\"a\": 1}\n":                 `{"a": 1}`,
+		"```json\n{\"a\": 1}\n```":       `{"a": 1}`,
+		"```\n{\"a\": 1}\n```\n":         `{"a": 1}`,
+		"```json\n{\"a\": \"```\"}\n```": "{\"a\": \"```\"}",
+	}
+	for content, want := range tests {
+		assert.Equal(t, want, TrimJSONFence(content), content)
+	}
+}
@@ -0,0 +1,220 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dlclark/regexp2"
+)
+
+// Encoding names of the embedded OpenAI vocabularies
+const (
+	CL100kBase = "cl100k_base"
+	O200kBase  = "o200k_base"
+)
+
+// The vocabularies are the tiktoken files published by OpenAI, gzipped:
+// https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken
+// https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken
+//
+//go:embed assets/*.tiktoken.gz
+var assets embed.FS
+
+// pre-tokenization patterns of the encodings, see https://github.com/openai/tiktoken/blob/main/tiktoken_ext/openai_public.py
+var patterns = map[string]string{
+	CL100kBase: `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+	O200kBase: strings.Join([]string{
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`\p{N}{1,3}`,
+		` ?[^\s\p{L}\p{N}]+[\r\n/]*`,
+		`\s*[\r\n]+`,
+		`\s+(?!\S)`,
+		`\s+`,
+	}, "|"),
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = make(map[string]*Encoding)
+)
+
+// Encoding is a byte pair encoding.
+type Encoding struct {
+	name    string
+	ranks   map[string]int
+	decoder map[int]string
+	pattern *regexp2.Regexp
+}
+
+// GetEncoding returns an embedded encoding by name, the vocabulary is loaded on first use.
+func GetEncoding(name string) (*Encoding, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	if enc, ok := encodings[name]; ok {
+		return enc, nil
+	}
+
+	pattern, ok := patterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding: %s", name)
+	}
+	ranks, err := loadRanks(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encoding %s: %w", name, err)
+	}
+	decoder := make(map[int]string, len(ranks))
+	for token, rank := range ranks {
+		decoder[rank] = token
+	}
+	enc := &Encoding{
+		name:    name,
+		ranks:   ranks,
+		decoder: decoder,
+		pattern: regexp2.MustCompile(pattern, regexp2.None),
+	}
+	encodings[name] = enc
+	return enc, nil
+}
+
+// loadRanks reads a tiktoken file: one "<base64 token> <rank>" line per token.
+func loadRanks(name string) (map[string]int, error) {
+	data, err := assets.ReadFile("assets/" + name + ".tiktoken.gz")
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		token, rank, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %q: %w", token, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank %q: %w", rank, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	return ranks, scanner.Err()
+}
+
+// Name returns the name of the encoding.
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Encode returns the tokens of the text. Special tokens such as <|endoftext|> are encoded as plain text.
+func (e *Encoding) Encode(text string) []int {
+	tokens := make([]int, 0, len(text)/3)
+	e.split(text, func(piece string) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			return
+		}
+		tokens = append(tokens, e.bytePairEncode([]byte(piece))...)
+	})
+	return tokens
+}
+
+// Decode returns the text of the tokens, unknown tokens are skipped.
+func (e *Encoding) Decode(tokens []int) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString(e.decoder[token])
+	}
+	return sb.String()
+}
+
+// Count returns the number of tokens of the text.
+func (e *Encoding) Count(text string) int {
+	n := 0
+	e.split(text, func(piece string) {
+		if _, ok := e.ranks[piece]; ok {
+			n++
+			return
+		}
+		n += len(e.bytePairEncode([]byte(piece)))
+	})
+	return n
+}
+
+// split calls fn with every piece of the pre-tokenized text.
+func (e *Encoding) split(text string, fn func(piece string)) {
+	match, err := e.pattern.FindStringMatch(text)
+	for err == nil && match != nil {
+		fn(match.String())
+		match, err = e.pattern.FindNextMatch(match)
+	}
+}
+
+// bytePairEncode merges the bytes of a piece by rank, ported from tiktoken's byte_pair_merge.
+func (e *Encoding) bytePairEncode(piece []byte) []int {
+	if len(piece) == 1 {
+		return []int{e.ranks[string(piece)]}
+	}
+
+	type part struct {
+		start int
+		rank  int
+	}
+	rank := func(parts []part, i int) int {
+		if i+3 < len(parts) {
+			if r, ok := e.ranks[string(piece[parts[i].start:parts[i+3].start])]; ok {
+				return r
+			}
+		}
+		return math.MaxInt
+	}
+
+	parts := make([]part, 0, len(piece)+1)
+	for i := 0; i < len(piece)-1; i++ {
+		r, ok := e.ranks[string(piece[i:i+2])]
+		if !ok {
+			r = math.MaxInt
+		}
+		parts = append(parts, part{start: i, rank: r})
+	}
+	parts = append(parts, part{start: len(piece) - 1, rank: math.MaxInt}, part{start: len(piece), rank: math.MaxInt})
+
+	for {
+		minIdx, minRank := -1, math.MaxInt
+		for i := 0; i < len(parts)-1; i++ {
+			if parts[i].rank < minRank {
+				minIdx, minRank = i, parts[i].rank
+			}
+		}
+		if minIdx < 0 {
+			break
+		}
+		parts[minIdx].rank = rank(parts, minIdx)
+		if minIdx > 0 {
+			parts[minIdx-1].rank = rank(parts, minIdx-1)
+		}
+		parts = append(parts[:minIdx+1], parts[minIdx+2:]...)
+	}
+
+	tokens := make([]int, 0, len(parts)-1)
+	for i := 0; i < len(parts)-1; i++ {
+		tokens = append(tokens, e.ranks[string(piece[parts[i].start:parts[i+1].start])])
+	}
+	return tokens
+}
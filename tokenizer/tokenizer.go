@@ -0,0 +1,179 @@
+// Package tokenizer counts the tokens of text and chat completion requests.
+//
+// OpenAI models are counted exactly with their byte pair encodings, cl100k_base and o200k_base,
+// whose vocabularies are embedded. Other model families are approximated from the text length.
+package tokenizer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/recally-io/polyllm/llms"
+)
+
+// Counter counts the tokens of text.
+type Counter interface {
+	Count(text string) int
+}
+
+// Approximate estimates token counts from the number of characters.
+type Approximate struct {
+	// CharsPerToken is the average number of characters of a token in latin text
+	CharsPerToken float64
+	// TokensPerCJK is the average number of tokens of a Chinese, Japanese or Korean character
+	TokensPerCJK float64
+}
+
+// Count returns the estimated number of tokens of the text.
+func (a Approximate) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	var chars, cjk float64
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			chars++
+		}
+	}
+	return int(math.Ceil(chars/a.CharsPerToken + cjk*a.TokensPerCJK))
+}
+
+// approximations of model families without an embedded vocabulary, by model name prefix
+var approximations = []struct {
+	prefix  string
+	counter Approximate
+}{
+	{"claude", Approximate{CharsPerToken: 3.5, TokensPerCJK: 1.2}},
+	{"gemini", Approximate{CharsPerToken: 4, TokensPerCJK: 0.8}},
+	{"gemma", Approximate{CharsPerToken: 4, TokensPerCJK: 0.8}},
+	{"deepseek", Approximate{CharsPerToken: 3.8, TokensPerCJK: 0.6}},
+	{"qwen", Approximate{CharsPerToken: 3.8, TokensPerCJK: 0.7}},
+	{"glm", Approximate{CharsPerToken: 3.8, TokensPerCJK: 0.7}},
+	{"doubao", Approximate{CharsPerToken: 3.8, TokensPerCJK: 0.7}},
+	{"llama", Approximate{CharsPerToken: 3.8, TokensPerCJK: 1}},
+	{"mistral", Approximate{CharsPerToken: 3.5, TokensPerCJK: 1.2}},
+	{"grok", Approximate{CharsPerToken: 4, TokensPerCJK: 1}},
+}
+
+// DefaultApproximate is used for models of unknown families.
+var DefaultApproximate = Approximate{CharsPerToken: 3.5, TokensPerCJK: 1.2}
+
+// encodings of OpenAI models by model name prefix, longer prefixes first
+var modelEncodings = []struct {
+	prefix   string
+	encoding string
+}{
+	{"gpt-4o", O200kBase},
+	{"gpt-4.1", O200kBase},
+	{"gpt-4.5", O200kBase},
+	{"gpt-5", O200kBase},
+	{"gpt-oss", O200kBase},
+	{"chatgpt-4o", O200kBase},
+	{"o1", O200kBase},
+	{"o3", O200kBase},
+	{"o4", O200kBase},
+	{"gpt-4", CL100kBase},
+	{"gpt-3.5", CL100kBase},
+	{"gpt-35", CL100kBase},
+	{"text-embedding-3", CL100kBase},
+	{"text-embedding-ada-002", CL100kBase},
+}
+
+// ForModel returns the counter of a model. The model name may include a provider path, e.g. "openai/gpt-4o".
+func ForModel(model string) Counter {
+	name := normalizeModel(model)
+	for _, m := range modelEncodings {
+		if strings.HasPrefix(name, m.prefix) {
+			enc, err := GetEncoding(m.encoding)
+			if err != nil {
+				slog.Error("failed to load encoding", "encoding", m.encoding, "err", err)
+				break
+			}
+			return enc
+		}
+	}
+	for _, a := range approximations {
+		if strings.HasPrefix(name, a.prefix) {
+			return a.counter
+		}
+	}
+	return DefaultApproximate
+}
+
+// normalizeModel strips the provider path and the query of a model name.
+func normalizeModel(model string) string {
+	model, _, _ = strings.Cut(model, "?")
+	if idx := strings.LastIndex(model, "/"); idx >= 0 {
+		model = model[idx+1:]
+	}
+	return strings.ToLower(model)
+}
+
+// Token overheads of the chat format, see
+// https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+const (
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	tokensPerReply   = 3
+	// image tokens are estimated as a low detail image or a 1024x1024 high detail image
+	tokensPerLowDetailImage = 85
+	tokensPerImage          = 765
+)
+
+// CountMessages returns the number of prompt tokens of the messages, including the chat format overhead.
+func CountMessages(counter Counter, messages []llms.ChatCompletionMessage) int {
+	n := tokensPerReply
+	for _, msg := range messages {
+		n += CountMessage(counter, msg)
+	}
+	return n
+}
+
+// CountMessage returns the number of tokens of a message, including the chat format overhead.
+func CountMessage(counter Counter, msg llms.ChatCompletionMessage) int {
+	n := tokensPerMessage + counter.Count(msg.Role) + counter.Count(msg.Content)
+	if msg.Name != "" {
+		n += tokensPerName + counter.Count(msg.Name)
+	}
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case llms.ChatMessagePartTypeText:
+			n += counter.Count(part.Text)
+		case llms.ChatMessagePartTypeImageURL:
+			if part.ImageURL != nil && part.ImageURL.Detail == llms.ImageURLDetailLow {
+				n += tokensPerLowDetailImage
+			} else {
+				n += tokensPerImage
+			}
+		}
+	}
+	for _, toolCall := range msg.ToolCalls {
+		n += counter.Count(toolCall.Function.Name) + counter.Count(toolCall.Function.Arguments)
+	}
+	if msg.FunctionCall != nil {
+		n += counter.Count(msg.FunctionCall.Name) + counter.Count(msg.FunctionCall.Arguments)
+	}
+	return n
+}
+
+// CountRequest returns the number of prompt tokens of a request: its messages and tool definitions.
+// Tool definitions are counted from their JSON encoding, which slightly overestimates them.
+func CountRequest(counter Counter, req llms.ChatCompletionRequest) int {
+	n := CountMessages(counter, req.Messages)
+	if len(req.Tools) > 0 {
+		if data, err := json.Marshal(req.Tools); err == nil {
+			n += counter.Count(string(data))
+		}
+	}
+	if len(req.Functions) > 0 {
+		if data, err := json.Marshal(req.Functions); err == nil {
+			n += counter.Count(string(data))
+		}
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		tokens   []int
+	}{
+		{CL100kBase, "hello world", []int{15339, 1917}},
+		{CL100kBase, "tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+		{O200kBase, "hello world", []int{24912, 2375}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding+"/"+tt.text, func(t *testing.T) {
+			enc, err := GetEncoding(tt.encoding)
+			require.NoError(t, err)
+			assert.Equal(t, tt.tokens, enc.Encode(tt.text))
+			assert.Equal(t, len(tt.tokens), enc.Count(tt.text))
+			assert.Equal(t, tt.text, enc.Decode(tt.tokens))
+		})
+	}
+
+	// text is encoded losslessly, including unicode and rare words split into several tokens
+	for _, name := range []string{CL100kBase, O200kBase} {
+		enc, err := GetEncoding(name)
+		require.NoError(t, err)
+		text := "Grüße aus Zürich! 你好，世界。 supercalifragilisticexpialidocious\n\n  func main() {}\t"
+		tokens := enc.Encode(text)
+		assert.Equal(t, text, enc.Decode(tokens))
+		assert.Less(t, len(tokens), len(text))
+	}
+
+	_, err := GetEncoding("p50k_base")
+	assert.ErrorContains(t, err, "unknown encoding")
+}
+
+func TestForModel(t *testing.T) {
+	assert.Equal(t, O200kBase, ForModel("openai/gpt-4o-mini").(*Encoding).Name())
+	assert.Equal(t, O200kBase, ForModel("o3-mini").(*Encoding).Name())
+	assert.Equal(t, CL100kBase, ForModel("gpt-4-turbo").(*Encoding).Name())
+	assert.Equal(t, CL100kBase, ForModel("gpt-3.5-turbo?mcp=all").(*Encoding).Name())
+	assert.Equal(t, Approximate{CharsPerToken: 3.8, TokensPerCJK: 0.6}, ForModel("deepseek-chat"))
+	assert.Equal(t, DefaultApproximate, ForModel("some-model"))
+
+	assert.Equal(t, 0, DefaultApproximate.Count(""))
+	assert.Equal(t, 3, Approximate{CharsPerToken: 4, TokensPerCJK: 1}.Count("hello world"))
+	assert.Equal(t, 4, Approximate{CharsPerToken: 4, TokensPerCJK: 1}.Count("你好世界"))
+}
+
+func TestCountMessages(t *testing.T) {
+	enc, err := GetEncoding(CL100kBase)
+	require.NoError(t, err)
+
+	// the example of the OpenAI cookbook counts 129 prompt tokens for gpt-3.5-turbo-0613 and gpt-4-0613
+	messages := []llms.ChatCompletionMessage{
+		{Role: "system", Content: "You are a helpful, pattern-following assistant that translates corporate jargon into plain English."},
+		{Role: "system", Name: "example_user", Content: "New synergies will help drive top-line growth."},
+		{Role: "system", Name: "example_assistant", Content: "Things working well together will increase revenue."},
+		{Role: "system", Name: "example_user", Content: "Let's circle back when we have more bandwidth to touch base on opportunities for increased leverage."},
+		{Role: "system", Name: "example_assistant", Content: "Let's talk later when we're less busy about how to do better."},
+		{Role: "user", Content: "This late pivot means we don't have time to boil the ocean for the client deliverable."},
+	}
+	assert.Equal(t, 129, CountMessages(enc, messages))
+
+	req := llms.ChatCompletionRequest{
+		Messages: messages,
+		Tools:    []llms.Tool{{Type: llms.ToolTypeFunction, Function: &llms.FunctionDefinition{Name: "get_weather"}}},
+	}
+	assert.Greater(t, CountRequest(enc, req), 129)
+}
@@ -0,0 +1,198 @@
+package polyllm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/recally-io/polyllm/jsonschema"
+	"github.com/recally-io/polyllm/llms"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// localTool is a Go function registered as a tool.
+type localTool struct {
+	definition llms.Tool
+	call       func(ctx context.Context, arguments string) (string, error)
+}
+
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// RegisterTool registers a Go function as a tool that models can call.
+// The parameters schema is reflected from Args, see jsonschema.Reflect for the supported struct tags.
+//
+// Registered tools are added to a request with the tools model parameter, e.g. "gpt-4o?tools=weather,search"
+// or "gpt-4o?tools=all", and can be combined with MCP tools: "gpt-4o?mcp=fetch&tools=weather".
+// Tool calls to registered tools are executed by ChatCompletion and their results are sent back to the model,
+// a string Result is sent as is and other results are encoded as JSON.
+// Registering a tool with the name of an existing tool replaces it.
+func RegisterTool[Args, Result any](p *PolyLLM, name, description string, fn func(ctx context.Context, args Args) (Result, error)) error {
+	if !toolNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid tool name %q, it must match %s", name, toolNamePattern)
+	}
+	if strings.HasPrefix(name, "mcp_") {
+		return fmt.Errorf("invalid tool name %q, the mcp_ prefix is reserved for MCP tools", name)
+	}
+	schema, err := jsonschema.Reflect[Args]()
+	if err != nil {
+		return fmt.Errorf("failed to generate schema of tool %s: %w", name, err)
+	}
+	if schema.Type != jsonschema.Object {
+		return fmt.Errorf("the arguments of tool %s must be a struct or a map", name)
+	}
+
+	call := func(ctx context.Context, arguments string) (string, error) {
+		if strings.TrimSpace(arguments) == "" {
+			arguments = "{}"
+		}
+		var args Args
+		if err := decodeObject(schema, arguments, &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		result, err := fn(ctx, args)
+		if err != nil {
+			return "", err
+		}
+		if text, ok := any(result).(string); ok {
+			return text, nil
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode result: %w", err)
+		}
+		return string(data), nil
+	}
+
+	p.toolsMu.Lock()
+	defer p.toolsMu.Unlock()
+	p.localTools[name] = localTool{
+		definition: llms.Tool{
+			Type: llms.ToolTypeFunction,
+			Function: &llms.FunctionDefinition{
+				Name:        name,
+				Description: description,
+				Parameters:  schema,
+			},
+		},
+		call: call,
+	}
+	return nil
+}
+
+// UnregisterTool removes a registered tool.
+func (p *PolyLLM) UnregisterTool(name string) {
+	p.toolsMu.Lock()
+	defer p.toolsMu.Unlock()
+	delete(p.localTools, name)
+}
+
+// ListLocalTools returns the definitions of the registered Go tools sorted by name.
+func (p *PolyLLM) ListLocalTools() []llms.Tool {
+	p.toolsMu.RLock()
+	defer p.toolsMu.RUnlock()
+	return p.listLocalToolsByNames(slices.Sorted(maps.Keys(p.localTools)))
+}
+
+// listLocalToolsByNames must be called with toolsMu held.
+func (p *PolyLLM) listLocalToolsByNames(names []string) []llms.Tool {
+	tools := make([]llms.Tool, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		tool, ok := p.localTools[name]
+		if !ok {
+			slog.Error("tool not found", "tool", name)
+			continue
+		}
+		tools = append(tools, tool.definition)
+	}
+	return tools
+}
+
+func (p *PolyLLM) getLocalToolsByNames(names []string) []llms.Tool {
+	p.toolsMu.RLock()
+	defer p.toolsMu.RUnlock()
+	if slices.Contains(names, "all") {
+		names = slices.Sorted(maps.Keys(p.localTools))
+	}
+	return p.listLocalToolsByNames(names)
+}
+
+func (p *PolyLLM) getLocalTool(name string) (localTool, bool) {
+	p.toolsMu.RLock()
+	defer p.toolsMu.RUnlock()
+	tool, ok := p.localTools[name]
+	return tool, ok
+}
+
+// canInvokeTool reports whether a tool call can be executed by PolyLLM,
+// calls to other tools are returned to the caller.
+func (p *PolyLLM) canInvokeTool(name string) bool {
+	if _, ok := p.getLocalTool(name); ok {
+		return true
+	}
+	return p.hasMCPTool(name)
+}
+
+// ToolCallInfo describes a tool call executed by the agent loop, it is passed to the ToolCallHook of the Config.
+type ToolCallInfo struct {
+	// Model is the model of the request that called the tool
+	Model string
+	Tool  string
+	// Source is "local" for registered Go functions and "mcp" for MCP tools
+	Source   string
+	Duration time.Duration
+	Err      error
+}
+
+// invokeTools executes tool calls of the model and returns the tool messages with their results.
+// Failed calls are reported to the model in the tool message so that it can recover.
+func (p *PolyLLM) invokeTools(ctx context.Context, model string, toolCalls []llms.ToolCall) []llms.ChatCompletionMessage {
+	messages := make([]llms.ChatCompletionMessage, 0, len(toolCalls))
+	for _, toolCall := range toolCalls {
+		slog.Info("start invoking tool", "tool", toolCall.Function.Name, "args", toolCall.Function.Arguments)
+		source := "mcp"
+		if _, ok := p.getLocalTool(toolCall.Function.Name); ok {
+			source = "local"
+		}
+		spanCtx, span := tracer().Start(ctx, "execute_tool "+toolCall.Function.Name, trace.WithAttributes(
+			semconv.GenAIOperationNameExecuteTool,
+			semconv.GenAIToolName(toolCall.Function.Name),
+			semconv.GenAIToolCallID(toolCall.ID),
+			semconv.GenAIToolType("function"),
+			attribute.String("polyllm.tool.source", source),
+		))
+		start := time.Now()
+		result, err := p.invokeTool(spanCtx, toolCall.Function)
+		endSpan(span, err)
+		if p.ToolCallHook != nil {
+			p.ToolCallHook(ctx, ToolCallInfo{Model: model, Tool: toolCall.Function.Name, Source: source, Duration: time.Since(start), Err: err})
+		}
+		if err != nil {
+			slog.Error("failed to call tool", "tool", toolCall.Function.Name, "err", err, "args", toolCall.Function.Arguments)
+			result = "Error: " + err.Error()
+		} else {
+			slog.Info("finished invoking tool", "tool", toolCall.Function.Name, "result", result[:min(100, len(result))])
+		}
+		messages = append(messages, llms.ChatCompletionMessage{
+			Role:       llms.ChatMessageRoleTool,
+			ToolCallID: toolCall.ID,
+			Content:    result,
+		})
+	}
+	return messages
+}
+
+func (p *PolyLLM) invokeTool(ctx context.Context, call llms.FunctionCall) (string, error) {
+	if tool, ok := p.getLocalTool(call.Name); ok {
+		return tool.call(ctx, call.Arguments)
+	}
+	return p.invokeMCPTool(ctx, call)
+}
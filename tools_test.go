@@ -0,0 +1,156 @@
+package polyllm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type addArgs struct {
+	A int `json:"a" jsonschema:"description=First operand"`
+	B int `json:"b"`
+}
+
+type addResult struct {
+	Sum int `json:"sum"`
+}
+
+func registerTestTools(t *testing.T, p *PolyLLM) {
+	t.Helper()
+	require.NoError(t, RegisterTool(p, "add", "Add two numbers", func(ctx context.Context, args addArgs) (addResult, error) {
+		return addResult{Sum: args.A + args.B}, nil
+	}))
+	require.NoError(t, RegisterTool(p, "fail", "Always fails", func(ctx context.Context, args struct{}) (string, error) {
+		return "", errors.New("boom")
+	}))
+}
+
+func toolCallMessage(name, arguments string) llms.ChatCompletionMessage {
+	return llms.ChatCompletionMessage{ToolCalls: []llms.ToolCall{{
+		ID:       "call_" + name,
+		Type:     llms.ToolTypeFunction,
+		Function: llms.FunctionCall{Name: name, Arguments: arguments},
+	}}}
+}
+
+// collect runs a chat completion and returns the reply content, the tool calls returned to the caller and the responses
+func collect(t *testing.T, p *PolyLLM, req llms.ChatCompletionRequest) (string, []llms.ToolCall, []llms.StreamingChatCompletionResponse) {
+	t.Helper()
+	var (
+		content   string
+		toolCalls []llms.ToolCall
+		responses []llms.StreamingChatCompletionResponse
+	)
+	p.ChatCompletion(context.Background(), req, func(resp llms.StreamingChatCompletionResponse) {
+		responses = append(responses, resp)
+		require.True(t, resp.Err == nil || resp.Err == io.EOF, "unexpected error: %v", resp.Err)
+		if resp.Response == nil || len(resp.Response.Choices) == 0 {
+			return
+		}
+		choice := resp.Response.Choices[0]
+		message := choice.Message
+		if message == nil {
+			message = choice.Delta
+		}
+		content += message.Content
+		toolCalls = append(toolCalls, message.ToolCalls...)
+	})
+	return content, toolCalls, responses
+}
+
+func TestChatCompletionLocalTools(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(map[bool]string{false: "non-streaming", true: "streaming"}[stream], func(t *testing.T) {
+			server, requests := newTestServer(t,
+				toolCallMessage("add", `{"a": 1, "b": 2}`),
+				toolCallMessage("fail", `{}`),
+				llms.ChatCompletionMessage{Content: "The sum is 3"},
+			)
+			p := newTestPolyLLM(llms.ProviderTypeOpenAI, server.URL)
+			registerTestTools(t, p)
+			var calls []ToolCallInfo
+			p.ToolCallHook = func(ctx context.Context, info ToolCallInfo) { calls = append(calls, info) }
+
+			content, toolCalls, responses := collect(t, p, llms.ChatCompletionRequest{
+				Model:    "test-model?tools=all",
+				Stream:   stream,
+				Messages: []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "1+2?"}},
+			})
+			assert.Equal(t, "The sum is 3", content)
+			assert.Empty(t, toolCalls)
+			assert.Equal(t, io.EOF, responses[len(responses)-1].Err)
+
+			require.Len(t, *requests, 3)
+			first := (*requests)[0]
+			require.Len(t, first.Tools, 2)
+			assert.Equal(t, "add", first.Tools[0].Function.Name)
+
+			last := (*requests)[2].Messages
+			require.Len(t, last, 5)
+			assert.Equal(t, "add", last[1].ToolCalls[0].Function.Name)
+			assert.Equal(t, `{"a": 1, "b": 2}`, last[1].ToolCalls[0].Function.Arguments)
+			assert.Equal(t, llms.ChatCompletionMessage{Role: llms.ChatMessageRoleTool, ToolCallID: "call_add", Content: `{"sum":3}`}, last[2])
+			assert.Equal(t, "Error: boom", last[4].Content)
+
+			require.Len(t, calls, 2)
+			assert.Equal(t, "add", calls[0].Tool)
+			assert.Equal(t, "local", calls[0].Source)
+			assert.Equal(t, "test-model?tools=all", calls[0].Model)
+			assert.NoError(t, calls[0].Err)
+			assert.EqualError(t, calls[1].Err, "boom")
+
+			if !stream {
+				// usage of all rounds is reported in the final response
+				assert.Equal(t, 45, responses[0].Response.Usage.TotalTokens)
+			}
+		})
+	}
+}
+
+func TestChatCompletionReturnsUnknownToolCalls(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(map[bool]string{false: "non-streaming", true: "streaming"}[stream], func(t *testing.T) {
+			server, requests := newTestServer(t, toolCallMessage("client_tool", `{"query": "weather"}`))
+			p := newTestPolyLLM(llms.ProviderTypeOpenAI, server.URL)
+			registerTestTools(t, p)
+
+			_, toolCalls, _ := collect(t, p, llms.ChatCompletionRequest{
+				Model:  "test-model?tools=add",
+				Stream: stream,
+				Tools: []llms.Tool{{Type: llms.ToolTypeFunction, Function: &llms.FunctionDefinition{Name: "client_tool"}},
+					{Type: llms.ToolTypeFunction, Function: &llms.FunctionDefinition{Name: "add"}}},
+			})
+			require.Len(t, toolCalls, 1)
+			assert.Equal(t, "client_tool", toolCalls[0].Function.Name)
+			assert.Equal(t, `{"query": "weather"}`, toolCalls[0].Function.Arguments)
+			assert.Len(t, *requests, 1)
+			// tools defined by the caller are not duplicated
+			assert.Len(t, (*requests)[0].Tools, 2)
+		})
+	}
+}
+
+func TestRegisterTool(t *testing.T) {
+	p := newTestPolyLLM(llms.ProviderTypeMock, "")
+	noop := func(ctx context.Context, args addArgs) (string, error) { return "", nil }
+	assert.ErrorContains(t, RegisterTool(p, "mcp_fetch_get", "", noop), "reserved")
+	assert.ErrorContains(t, RegisterTool(p, "has space", "", noop), "invalid tool name")
+	assert.ErrorContains(t, RegisterTool(p, "scalar", "", func(ctx context.Context, args int) (int, error) { return args, nil }), "must be a struct")
+
+	require.NoError(t, RegisterTool(p, "add", "Add two numbers", noop))
+	tools := p.ListLocalTools()
+	require.Len(t, tools, 1)
+	assert.Equal(t, "Add two numbers", tools[0].Function.Description)
+
+	result, err := p.invokeTool(context.Background(), llms.FunctionCall{Name: "add", Arguments: `{"a": "x"}`})
+	assert.Empty(t, result)
+	assert.ErrorContains(t, err, "invalid arguments")
+
+	p.UnregisterTool("add")
+	assert.Empty(t, p.ListLocalTools())
+}
@@ -0,0 +1,110 @@
+package polyllm
+
+import (
+	"context"
+	"io"
+	"slices"
+
+	"github.com/recally-io/polyllm/llms"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer of PolyLLM. Spans are recorded with the global tracer provider
+// and follow the GenAI semantic conventions: "chat <model>" spans for each request sent to a provider and
+// "execute_tool <tool>" spans for each tool call executed by the agent loop.
+const TracerName = "github.com/recally-io/polyllm"
+
+// tracer returns the tracer of the global tracer provider when it is called, so that it can be replaced, e.g. in tests.
+func tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// endSpan records err on the span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// chatSpan is the span of a request sent to a provider, it is ended by the last response.
+type chatSpan struct {
+	span          trace.Span
+	finishReasons []string
+	usage         llms.Usage
+	ended         bool
+}
+
+func startChatSpan(ctx context.Context, provider *llms.Provider, req llms.ChatCompletionRequest) (context.Context, *chatSpan) {
+	attrs := []attribute.KeyValue{
+		semconv.GenAIOperationNameChat,
+		semconv.GenAIProviderNameKey.String(string(provider.Type)),
+		semconv.GenAIRequestModel(req.Model),
+		attribute.String("polyllm.provider", provider.Name),
+		attribute.Bool("polyllm.stream", req.Stream),
+	}
+	if maxTokens := max(req.MaxCompletionTokens, req.MaxTokens); maxTokens > 0 {
+		attrs = append(attrs, semconv.GenAIRequestMaxTokens(maxTokens))
+	}
+	if req.Temperature > 0 {
+		attrs = append(attrs, semconv.GenAIRequestTemperature(float64(req.Temperature)))
+	}
+	if req.TopP > 0 {
+		attrs = append(attrs, semconv.GenAIRequestTopP(float64(req.TopP)))
+	}
+	ctx, span := tracer().Start(ctx, "chat "+req.Model, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, &chatSpan{span: span}
+}
+
+// wrap records the responses on the span and ends it with the last response, before it is forwarded,
+// so that the span does not include the next rounds of the agent loop.
+func (s *chatSpan) wrap(streamingFunc func(resp llms.StreamingChatCompletionResponse)) func(resp llms.StreamingChatCompletionResponse) {
+	return func(resp llms.StreamingChatCompletionResponse) {
+		if resp.Response != nil {
+			s.observe(resp.Response)
+		}
+		if resp.Err != nil {
+			s.end(resp.Err)
+		}
+		streamingFunc(resp)
+	}
+}
+
+func (s *chatSpan) observe(resp *llms.ChatCompletionResponse) {
+	if resp.ID != "" {
+		s.span.SetAttributes(semconv.GenAIResponseID(resp.ID))
+	}
+	if resp.Model != "" {
+		s.span.SetAttributes(semconv.GenAIResponseModel(resp.Model))
+	}
+	for _, choice := range resp.Choices {
+		if reason := string(choice.FinishReason); reason != "" && reason != string(llms.FinishReasonNull) && !slices.Contains(s.finishReasons, reason) {
+			s.finishReasons = append(s.finishReasons, reason)
+		}
+	}
+	s.usage.PromptTokens = max(s.usage.PromptTokens, resp.Usage.PromptTokens)
+	s.usage.CompletionTokens = max(s.usage.CompletionTokens, resp.Usage.CompletionTokens)
+}
+
+// end ends the span, io.EOF is the end of a successful response.
+func (s *chatSpan) end(err error) {
+	if s.ended {
+		return
+	}
+	s.ended = true
+	if len(s.finishReasons) > 0 {
+		s.span.SetAttributes(semconv.GenAIResponseFinishReasons(s.finishReasons...))
+	}
+	if s.usage.PromptTokens > 0 || s.usage.CompletionTokens > 0 {
+		s.span.SetAttributes(semconv.GenAIUsageInputTokens(s.usage.PromptTokens), semconv.GenAIUsageOutputTokens(s.usage.CompletionTokens))
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	endSpan(s.span, err)
+}
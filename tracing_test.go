@@ -0,0 +1,120 @@
+package polyllm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestTracer records the spans of the global tracer provider in memory until the end of the test.
+func newTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, attr := range span.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
+
+func TestTracing(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(map[bool]string{false: "non-streaming", true: "streaming"}[stream], func(t *testing.T) {
+			exporter := newTestTracer(t)
+			server, _ := newTestServer(t,
+				toolCallMessage("add", `{"a": 1, "b": 2}`),
+				llms.ChatCompletionMessage{Content: "3"},
+			)
+			p := newTestPolyLLM(llms.ProviderTypeOpenAI, server.URL)
+			registerTestTools(t, p)
+
+			ctx, root := otel.Tracer("test").Start(context.Background(), "request")
+			p.ChatCompletion(ctx, llms.ChatCompletionRequest{
+				Model:       "test-model?tools=add",
+				Stream:      stream,
+				MaxTokens:   100,
+				Temperature: 0.5,
+				Messages:    []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: "1+2?"}},
+			}, func(resp llms.StreamingChatCompletionResponse) {})
+			root.End()
+
+			var names []string
+			for _, span := range exporter.GetSpans() {
+				names = append(names, span.Name)
+				assert.Equal(t, root.SpanContext().TraceID(), span.SpanContext.TraceID(), span.Name)
+				if span.Name != "request" {
+					assert.Equal(t, root.SpanContext().SpanID(), span.Parent.SpanID(), span.Name)
+				}
+			}
+			// spans end in order, the chat span of a round ends before its tools are executed
+			assert.Equal(t, []string{
+				"polyllm.resolve_model", "chat test-model", "execute_tool add",
+				"polyllm.resolve_model", "chat test-model", "request",
+			}, names)
+
+			spans := exporter.GetSpans()
+			resolve := spanAttributes(spans[0])
+			assert.Equal(t, "test-model?tools=add", resolve["gen_ai.request.model"].AsString())
+			assert.Equal(t, "test-openai", resolve["polyllm.provider"].AsString())
+			assert.Equal(t, int64(1), resolve["polyllm.tools"].AsInt64())
+
+			chat := spanAttributes(spans[1])
+			assert.Equal(t, "chat", chat["gen_ai.operation.name"].AsString())
+			assert.Equal(t, "openai", chat["gen_ai.provider.name"].AsString())
+			assert.Equal(t, "test-model", chat["gen_ai.request.model"].AsString())
+			assert.Equal(t, int64(100), chat["gen_ai.request.max_tokens"].AsInt64())
+			assert.Equal(t, 0.5, chat["gen_ai.request.temperature"].AsFloat64())
+			assert.Equal(t, "test", chat["gen_ai.response.id"].AsString())
+			assert.Equal(t, []string{"tool_calls"}, chat["gen_ai.response.finish_reasons"].AsStringSlice())
+			assert.Equal(t, int64(10), chat["gen_ai.usage.input_tokens"].AsInt64())
+			assert.Equal(t, int64(5), chat["gen_ai.usage.output_tokens"].AsInt64())
+			assert.Equal(t, []string{"stop"}, spanAttributes(spans[4])["gen_ai.response.finish_reasons"].AsStringSlice())
+
+			tool := spanAttributes(spans[2])
+			assert.Equal(t, "execute_tool", tool["gen_ai.operation.name"].AsString())
+			assert.Equal(t, "add", tool["gen_ai.tool.name"].AsString())
+			assert.Equal(t, "call_add", tool["gen_ai.tool.call.id"].AsString())
+			assert.Equal(t, "local", tool["polyllm.tool.source"].AsString())
+		})
+	}
+}
+
+func TestTracingErrors(t *testing.T) {
+	exporter := newTestTracer(t)
+	server, _ := newTestServer(t, toolCallMessage("fail", `{}`), llms.ChatCompletionMessage{Content: "sorry"})
+	p := newTestPolyLLM(llms.ProviderTypeOpenAI, server.URL)
+	registerTestTools(t, p)
+
+	p.ChatCompletion(context.Background(), llms.ChatCompletionRequest{Model: "unknown-model"}, func(resp llms.StreamingChatCompletionResponse) {})
+	p.ChatCompletion(context.Background(), llms.ChatCompletionRequest{Model: "test-model?tools=fail"}, func(resp llms.StreamingChatCompletionResponse) {})
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 6)
+	assert.Equal(t, "polyllm.resolve_model", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, ErrProviderNotFound.Error(), spans[0].Status.Description)
+
+	assert.Equal(t, "execute_tool fail", spans[3].Name)
+	assert.Equal(t, codes.Error, spans[3].Status.Code)
+	assert.Equal(t, "boom", spans[3].Status.Description)
+	assert.Equal(t, codes.Unset, spans[5].Status.Code)
+}
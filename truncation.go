@@ -0,0 +1,203 @@
+package polyllm
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/tokenizer"
+)
+
+// TruncationStrategy is how messages are removed from requests exceeding the context window.
+type TruncationStrategy string
+
+const (
+	// TruncationDropOldest drops the oldest messages after the system prompt until the request fits
+	TruncationDropOldest TruncationStrategy = "drop_oldest"
+	// TruncationKeepLast keeps the system prompt and the last KeepLast messages,
+	// dropping more of the oldest messages if they still do not fit
+	TruncationKeepLast TruncationStrategy = "keep_last"
+	// TruncationSummarize replaces the messages drop_oldest would drop with a summary written by SummaryModel
+	TruncationSummarize TruncationStrategy = "summarize"
+)
+
+// DefaultReserveTokens is the number of tokens reserved for the completion when neither the request
+// max tokens nor TruncationConfig.ReserveTokens are set.
+const DefaultReserveTokens = 1024
+
+// summaryReserveTokens is the room left for the summary message by the summarize strategy,
+// at most a quarter of the prompt limit
+const summaryReserveTokens = 512
+
+// TruncationConfig configures how requests exceeding the context window of their model are trimmed.
+// Models without a known context window, see PolyLLM.ContextWindow, are never trimmed.
+type TruncationConfig struct {
+	Strategy TruncationStrategy `json:"strategy"`
+	// KeepLast is the number of messages after the system prompt kept by the keep_last strategy
+	KeepLast int `json:"keep_last,omitempty"`
+	// ReserveTokens is the number of tokens reserved for the completion when the request does not set max tokens
+	ReserveTokens int `json:"reserve_tokens,omitempty"`
+	// SummaryModel is the model writing summaries, defaults to the model of the request
+	SummaryModel string `json:"summary_model,omitempty"`
+}
+
+// truncatingKey marks the context of summary requests, which are not truncated themselves
+type truncatingKey struct{}
+
+// ContextWindow returns the context window of a model in tokens, see GetModel.
+func (p *PolyLLM) ContextWindow(model string) (int, bool) {
+	m, ok := p.GetModel(model)
+	return m.ContextWindow, ok && m.ContextWindow > 0
+}
+
+// CountTokens returns the number of prompt tokens of a request, exact for OpenAI models and estimated for others.
+func (p *PolyLLM) CountTokens(req llms.ChatCompletionRequest) int {
+	return tokenizer.CountRequest(p.tokenCounter(req.Model), req)
+}
+
+func (p *PolyLLM) tokenCounter(model string) tokenizer.Counter {
+	model, _, _ = strings.Cut(model, "?")
+	if llm, ok := p.modelLLMMappings[model]; ok {
+		model = llm.GetProvider().GetRealModel(model)
+	}
+	return tokenizer.ForModel(model)
+}
+
+// Truncate trims the messages of a request that exceeds the context window of its model with the strategy of cfg.
+// Requests that fit, and requests for models without a known context window, are returned unchanged.
+// It returns ErrContextWindowExceeded when the request does not fit even with only the system prompt and the last message.
+func (p *PolyLLM) Truncate(ctx context.Context, req llms.ChatCompletionRequest, cfg TruncationConfig) (llms.ChatCompletionRequest, error) {
+	window, ok := p.ContextWindow(req.Model)
+	if !ok || cfg.Strategy == "" {
+		return req, nil
+	}
+
+	reserve := cmp.Or(req.MaxCompletionTokens, req.MaxTokens, cfg.ReserveTokens, DefaultReserveTokens)
+	limit := window - reserve
+	counter := p.tokenCounter(req.Model)
+	total := tokenizer.CountRequest(counter, req)
+	if total <= limit {
+		return req, nil
+	}
+
+	system, history := splitSystemMessages(req.Messages)
+	switch cfg.Strategy {
+	case TruncationDropOldest:
+	case TruncationKeepLast:
+		if cfg.KeepLast > 0 && len(history) > cfg.KeepLast {
+			history = trimToolResults(history[len(history)-cfg.KeepLast:])
+		}
+	case TruncationSummarize:
+		start, _ := dropOldest(counter, req, system, history, limit-min(summaryReserveTokens, limit/4))
+		if start > 0 {
+			summary, err := p.summarize(ctx, cmp.Or(cfg.SummaryModel, req.Model), history[:start])
+			if err != nil {
+				return req, fmt.Errorf("failed to summarize messages: %w", err)
+			}
+			system = append(system, llms.ChatCompletionMessage{
+				Role:    llms.ChatMessageRoleSystem,
+				Content: "Summary of the earlier conversation:\n" + summary,
+			})
+			history = history[start:]
+		}
+	default:
+		return req, fmt.Errorf("%w: unknown truncation strategy %q", ErrInvalidConfiguration, cfg.Strategy)
+	}
+
+	start, fits := dropOldest(counter, req, system, history, limit)
+	if !fits {
+		return req, fmt.Errorf("%w: the request needs more than %d tokens of the %d tokens context window of %s",
+			ErrContextWindowExceeded, limit, window, req.Model)
+	}
+	dropped := len(req.Messages) - len(system) - len(history[start:])
+	slog.Info("truncated request", "model", req.Model, "strategy", cfg.Strategy, "tokens", total, "limit", limit, "dropped_messages", dropped)
+
+	req.Messages = append(system, history[start:]...)
+	return req, nil
+}
+
+// truncateRequest trims a request with the truncation of the config. The configured strategy applies once
+// per chat completion, with summarize set, before the tool rounds and the fallbacks: their requests are only
+// trimmed by dropping the oldest messages, so that summarize does not ask for a summary again for each of them.
+func (p *PolyLLM) truncateRequest(ctx context.Context, req llms.ChatCompletionRequest, summarize bool) (llms.ChatCompletionRequest, error) {
+	// summary requests are not truncated themselves
+	if p.Truncation == nil || ctx.Value(truncatingKey{}) != nil {
+		return req, nil
+	}
+	cfg := *p.Truncation
+	if !summarize && cfg.Strategy == TruncationSummarize {
+		cfg.Strategy = TruncationDropOldest
+	}
+	return p.Truncate(ctx, req, cfg)
+}
+
+// dropOldest returns the index of the first history message to keep so that the request fits the limit,
+// it reports false when even the last message alone does not fit.
+func dropOldest(counter tokenizer.Counter, req llms.ChatCompletionRequest, system, history []llms.ChatCompletionMessage, limit int) (int, bool) {
+	req.Messages = append(append([]llms.ChatCompletionMessage{}, system...), history...)
+	total := tokenizer.CountRequest(counter, req)
+	start := 0
+	for total > limit && start < len(history)-1 {
+		total -= tokenizer.CountMessage(counter, history[start])
+		start++
+		// tool results cannot be sent without the assistant message calling the tools
+		for start < len(history)-1 && history[start].Role == llms.ChatMessageRoleTool {
+			total -= tokenizer.CountMessage(counter, history[start])
+			start++
+		}
+	}
+	return start, total <= limit
+}
+
+// splitSystemMessages splits the leading system and developer messages from the conversation.
+func splitSystemMessages(messages []llms.ChatCompletionMessage) ([]llms.ChatCompletionMessage, []llms.ChatCompletionMessage) {
+	i := 0
+	for i < len(messages) && (messages[i].Role == llms.ChatMessageRoleSystem || messages[i].Role == llms.ChatMessageRoleDeveloper) {
+		i++
+	}
+	return append([]llms.ChatCompletionMessage{}, messages[:i]...), messages[i:]
+}
+
+// trimToolResults removes leading tool results whose tool calls were dropped.
+func trimToolResults(messages []llms.ChatCompletionMessage) []llms.ChatCompletionMessage {
+	for len(messages) > 1 && messages[0].Role == llms.ChatMessageRoleTool {
+		messages = messages[1:]
+	}
+	return messages
+}
+
+const summaryPrompt = `Summarize the following conversation between a user and an AI assistant.
+Keep the facts, decisions, names and open questions needed to continue the conversation. Reply with the summary only.`
+
+// summarize asks the model for a summary of the messages.
+func (p *PolyLLM) summarize(ctx context.Context, model string, messages []llms.ChatCompletionMessage) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		content := msg.Content
+		for _, part := range msg.MultiContent {
+			if part.Type == llms.ChatMessagePartTypeText {
+				content += part.Text
+			}
+		}
+		for _, toolCall := range msg.ToolCalls {
+			content += fmt.Sprintf("[called %s(%s)]", toolCall.Function.Name, toolCall.Function.Arguments)
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, content)
+	}
+
+	ctx = context.WithValue(ctx, truncatingKey{}, true)
+	message, err := p.completeMessage(ctx, llms.ChatCompletionRequest{
+		Model: model,
+		Messages: []llms.ChatCompletionMessage{
+			{Role: llms.ChatMessageRoleSystem, Content: summaryPrompt},
+			{Role: llms.ChatMessageRoleUser, Content: transcript.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(message.Content), nil
+}
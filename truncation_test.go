@@ -0,0 +1,171 @@
+package polyllm
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTruncatingPolyLLM returns a PolyLLM whose test-model has a context window of 200 tokens,
+// 150 of them usable by the prompt.
+func newTruncatingPolyLLM(baseURL string, cfg TruncationConfig) *PolyLLM {
+	cfg.ReserveTokens = 50
+	return New(WithLLMProviders(llms.Provider{
+		Type:    llms.ProviderTypeOpenAI,
+		Name:    "test-truncation",
+		BaseURL: baseURL,
+		APIKey:  "test",
+		Models:  []llms.Model{{ID: "test-model", ContextWindow: 200}},
+	}), WithTruncation(cfg))
+}
+
+// longConversation returns a system prompt and six messages of about 40 tokens each.
+func longConversation() []llms.ChatCompletionMessage {
+	messages := []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleSystem, Content: "You are helpful."}}
+	for i, word := range []string{"one", "two", "three", "four", "five", "six"} {
+		role := llms.ChatMessageRoleUser
+		if i%2 == 1 {
+			role = llms.ChatMessageRoleAssistant
+		}
+		messages = append(messages, llms.ChatCompletionMessage{Role: role, Content: word + strings.Repeat(" filler", 18)})
+	}
+	return messages
+}
+
+func runChat(t *testing.T, p *PolyLLM, messages []llms.ChatCompletionMessage) (*llms.ChatCompletionResponse, error) {
+	t.Helper()
+	var resp *llms.ChatCompletionResponse
+	var err error
+	p.ChatCompletion(context.Background(), llms.ChatCompletionRequest{Model: "test-model", Messages: messages}, func(r llms.StreamingChatCompletionResponse) {
+		if r.Err != nil && r.Err != io.EOF {
+			err = r.Err
+			return
+		}
+		if r.Response != nil {
+			resp = r.Response
+		}
+	})
+	return resp, err
+}
+
+func firstWords(messages []llms.ChatCompletionMessage) []string {
+	words := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		word, _, _ := strings.Cut(msg.Content, " ")
+		words = append(words, word)
+	}
+	return words
+}
+
+func TestTruncation(t *testing.T) {
+	t.Run("drop oldest", func(t *testing.T) {
+		server, requests := newTestServer(t, llms.ChatCompletionMessage{Content: "ok"})
+		p := newTruncatingPolyLLM(server.URL, TruncationConfig{Strategy: TruncationDropOldest})
+
+		_, err := runChat(t, p, longConversation())
+		require.NoError(t, err)
+		require.Len(t, *requests, 1)
+		assert.Equal(t, []string{"You", "four", "five", "six"}, firstWords((*requests)[0].Messages))
+	})
+
+	t.Run("keep last", func(t *testing.T) {
+		server, requests := newTestServer(t, llms.ChatCompletionMessage{Content: "ok"})
+		p := newTruncatingPolyLLM(server.URL, TruncationConfig{Strategy: TruncationKeepLast, KeepLast: 1})
+
+		_, err := runChat(t, p, longConversation())
+		require.NoError(t, err)
+		require.Len(t, *requests, 1)
+		assert.Equal(t, []string{"You", "six"}, firstWords((*requests)[0].Messages))
+	})
+
+	t.Run("summarize", func(t *testing.T) {
+		server, requests := newTestServer(t,
+			llms.ChatCompletionMessage{Content: "The user counted to four."},
+			llms.ChatCompletionMessage{Content: "ok"},
+		)
+		p := newTruncatingPolyLLM(server.URL, TruncationConfig{Strategy: TruncationSummarize})
+
+		resp, err := runChat(t, p, longConversation())
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, "ok", resp.Choices[0].Message.Content)
+
+		require.Len(t, *requests, 2)
+		summaryReq := (*requests)[0]
+		require.Len(t, summaryReq.Messages, 2)
+		assert.Contains(t, summaryReq.Messages[1].Content, "user: one")
+		assert.Contains(t, summaryReq.Messages[1].Content, "assistant: four")
+		assert.NotContains(t, summaryReq.Messages[1].Content, "five")
+
+		messages := (*requests)[1].Messages
+		assert.Equal(t, []string{"You", "Summary", "five", "six"}, firstWords(messages))
+		assert.Equal(t, llms.ChatMessageRoleSystem, messages[1].Role)
+		assert.Contains(t, messages[1].Content, "The user counted to four.")
+	})
+
+	t.Run("summarize once per chat completion", func(t *testing.T) {
+		server, requests := newTestServer(t,
+			llms.ChatCompletionMessage{Content: "The user counted to four."},
+			toolCallMessage("lookup", `{}`),
+			llms.ChatCompletionMessage{Content: "ok"},
+		)
+		p := newTruncatingPolyLLM(server.URL, TruncationConfig{Strategy: TruncationSummarize})
+		// the tool result makes the second round exceed the context window again
+		require.NoError(t, RegisterTool(p, "lookup", "Look up a fact", func(ctx context.Context, args struct{}) (string, error) {
+			return "fact" + strings.Repeat(" filler", 15), nil
+		}))
+
+		var err error
+		p.ChatCompletion(context.Background(), llms.ChatCompletionRequest{Model: "test-model?tools=lookup", Messages: longConversation()}, func(r llms.StreamingChatCompletionResponse) {
+			if r.Err != nil && r.Err != io.EOF {
+				err = r.Err
+			}
+		})
+		require.NoError(t, err)
+
+		// a summary and two rounds, the second round drops the oldest messages instead of summarizing again
+		require.Len(t, *requests, 3)
+		assert.Equal(t, summaryPrompt, (*requests)[0].Messages[0].Content)
+		assert.Equal(t, []string{"You", "Summary", "", "fact"}, firstWords((*requests)[2].Messages))
+	})
+
+	t.Run("exceeded", func(t *testing.T) {
+		server, requests := newTestServer(t, llms.ChatCompletionMessage{Content: "ok"})
+		p := newTruncatingPolyLLM(server.URL, TruncationConfig{Strategy: TruncationDropOldest})
+
+		_, err := runChat(t, p, []llms.ChatCompletionMessage{{Role: llms.ChatMessageRoleUser, Content: strings.Repeat("filler ", 200)}})
+		assert.ErrorIs(t, err, ErrContextWindowExceeded)
+		assert.Empty(t, *requests)
+	})
+
+	t.Run("fits", func(t *testing.T) {
+		server, requests := newTestServer(t, llms.ChatCompletionMessage{Content: "ok"})
+		p := newTruncatingPolyLLM(server.URL, TruncationConfig{Strategy: TruncationDropOldest})
+
+		messages := longConversation()[:3]
+		_, err := runChat(t, p, messages)
+		require.NoError(t, err)
+		require.Len(t, *requests, 1)
+		assert.Len(t, (*requests)[0].Messages, 3)
+	})
+}
+
+func TestContextWindow(t *testing.T) {
+	p := newTruncatingPolyLLM("http://localhost", TruncationConfig{})
+
+	window, ok := p.ContextWindow("test-model?tools=all")
+	assert.True(t, ok)
+	assert.Equal(t, 200, window)
+
+	window, ok = p.ContextWindow("openai/gpt-4o-mini")
+	assert.True(t, ok)
+	assert.Equal(t, 128000, window)
+
+	_, ok = p.ContextWindow("unknown-model")
+	assert.False(t, ok)
+}
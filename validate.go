@@ -0,0 +1,147 @@
+package polyllm
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/recally-io/polyllm/llms"
+)
+
+// ConfigIssue is a problem of a configuration.
+type ConfigIssue struct {
+	// Path locates the problem in the configuration, e.g. llms[1].base_url
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (i ConfigIssue) String() string {
+	return i.Path + ": " + i.Message
+}
+
+// ValidationError lists the problems of an invalid configuration, it matches ErrInvalidConfiguration with errors.Is.
+type ValidationError struct {
+	Issues []ConfigIssue
+}
+
+func (e *ValidationError) Error() string {
+	issues := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		issues[i] = issue.String()
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidConfiguration, strings.Join(issues, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidConfiguration
+}
+
+// Validate checks the providers and MCP servers of the configuration, with the env vars of their env_prefix,
+// and returns a *ValidationError listing all the problems found, nil when there are none.
+// Providers with the same name as a built-in provider replace it and are not duplicates.
+func (c Config) Validate() error {
+	var issues []ConfigIssue
+	report := func(path, format string, args ...any) {
+		issues = append(issues, ConfigIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	names := make(map[string]int)
+	prefixes := make(map[string]int)
+	// models and aliases by ID, with the path of the provider serving them
+	models := make(map[string]string)
+	aliases := make(map[string]string)
+	for i, provider := range c.LLMProvides {
+		path := fmt.Sprintf("llms[%d]", i)
+		if provider.Name == "" {
+			report(path+".name", "the provider has no name")
+		} else if j, ok := names[provider.Name]; ok {
+			report(path+".name", "duplicate provider name %q, also used by llms[%d]", provider.Name, j)
+		} else {
+			names[provider.Name] = i
+		}
+
+		if !slices.Contains(llms.ProviderTypes, provider.Type) {
+			report(path+".type", "unknown provider type %q, expected one of %s", provider.Type, joinProviderTypes())
+		}
+		if provider.ModelPrefix != "" {
+			if j, ok := prefixes[provider.ModelPrefix]; ok {
+				report(path+".model_prefix", "duplicate model prefix %q, also used by llms[%d]", provider.ModelPrefix, j)
+			} else {
+				prefixes[provider.ModelPrefix] = i
+			}
+		}
+		switch provider.CapabilityPolicy {
+		case "", llms.CapabilityPolicyAdapt, llms.CapabilityPolicyReject, llms.CapabilityPolicyPassthrough:
+		default:
+			report(path+".capability_policy", "unknown capability policy %q, expected adapt, reject or passthrough", provider.CapabilityPolicy)
+		}
+
+		if provider.EnvPrefix != "" {
+			if alias := os.Getenv(provider.EnvPrefix + "MODEL_ALIAS"); alias != "" {
+				if _, err := llms.ParseModelAlias(alias); err != nil {
+					report(path+".env_prefix", "%sMODEL_ALIAS: %v", provider.EnvPrefix, err)
+				}
+			}
+		}
+		provider.Load()
+		if provider.BaseURL == "" && provider.Type != llms.ProviderTypeOpenAI && provider.Type != llms.ProviderTypeMock {
+			report(path+".base_url", "the %s provider needs a base URL", provider.Type)
+		}
+		if provider.APIKey == "" && provider.Type != llms.ProviderTypeMock {
+			if provider.EnvPrefix != "" {
+				report(path+".api_key", "no API key, set api_key or the %sAPI_KEY env var", provider.EnvPrefix)
+			} else {
+				report(path+".api_key", "no API key, set api_key or env_prefix")
+			}
+		}
+
+		for _, model := range provider.Models {
+			models[model.ID] = path
+		}
+		for _, alias := range slices.Sorted(maps.Keys(provider.ModelAlias)) {
+			id := provider.ModelPrefix + alias
+			if other, ok := aliases[id]; ok {
+				report(path+".model_alias", "alias %q is also an alias of %s", id, other)
+			}
+			aliases[id] = path
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(aliases)) {
+		path := aliases[id]
+		if other, ok := models[id]; ok {
+			report(path+".model_alias", "alias %q hides the model %q of %s", id, id, other)
+		}
+	}
+
+	switch c.InitMode {
+	case "", InitModeLenient, InitModeStrict:
+	default:
+		report("init_mode", "unknown init mode %q, expected lenient or strict", c.InitMode)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.MCPProviders)) {
+		mcp := c.MCPProviders[name]
+		path := "mcps." + name
+		switch {
+		case mcp.BaseURL == "" && mcp.Command == "":
+			report(path, "the MCP server needs a command or a base_url")
+		case mcp.BaseURL != "" && mcp.Command != "":
+			report(path, "the MCP server has both a command and a base_url")
+		}
+	}
+
+	if len(issues) == 0 {
+		return nil
+	}
+	return &ValidationError{Issues: issues}
+}
+
+func joinProviderTypes() string {
+	types := make([]string, len(llms.ProviderTypes))
+	for i, t := range llms.ProviderTypes {
+		types[i] = string(t)
+	}
+	return strings.Join(types, ", ")
+}
@@ -0,0 +1,66 @@
+package polyllm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/recally-io/polyllm/llms"
+	"github.com/recally-io/polyllm/mcps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigValidate(t *testing.T) {
+	t.Setenv("TEST_VALIDATE_API_KEY", "sk-test")
+	t.Setenv("TEST_VALIDATE_MODEL_ALIAS", "fast=gpt-4o-mini,broken")
+
+	valid := Config{
+		LLMProvides: []llms.Provider{
+			{Name: "openai", Type: llms.ProviderTypeOpenAI, EnvPrefix: "TEST_VALIDATE_"},
+			{Name: "local", Type: llms.ProviderTypeMock},
+		},
+		MCPProviders: map[string]mcps.Provider{"fetch": {Command: "uvx"}},
+	}
+	// the valid config has a broken alias in the env
+	err := valid.Validate()
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []ConfigIssue{
+		{Path: "llms[0].env_prefix", Message: `TEST_VALIDATE_MODEL_ALIAS: invalid model aliases "broken", expected alias=model`},
+	}, validationErr.Issues)
+
+	t.Setenv("TEST_VALIDATE_MODEL_ALIAS", "fast=gpt-4o-mini")
+	assert.NoError(t, valid.Validate())
+
+	invalid := Config{
+		LLMProvides: []llms.Provider{
+			{Name: "deepseek", Type: llms.ProviderTypeDeepSeek, BaseURL: "https://api.deepseek.com", APIKey: "sk", ModelPrefix: "ds/",
+				Models: []llms.Model{{ID: "ds/chat"}}, ModelAlias: map[string]string{"fast": "chat"}},
+			{Name: "deepseek", Type: "unknown", BaseURL: "http://localhost", APIKey: "sk", ModelPrefix: "ds/",
+				ModelAlias: map[string]string{"fast": "other", "chat": "other"}},
+			{Type: llms.ProviderTypeMock, CapabilityPolicy: "ignore"},
+		},
+		MCPProviders: map[string]mcps.Provider{
+			"both": {Command: "uvx", BaseURL: "http://localhost"},
+			"none": {},
+		},
+	}
+	err = invalid.Validate()
+	assert.ErrorIs(t, err, ErrInvalidConfiguration)
+	require.True(t, errors.As(err, &validationErr))
+	var issues []string
+	for _, issue := range validationErr.Issues {
+		issues = append(issues, issue.String())
+	}
+	assert.Equal(t, []string{
+		`llms[1].name: duplicate provider name "deepseek", also used by llms[0]`,
+		`llms[1].type: unknown provider type "unknown", expected one of ` + joinProviderTypes(),
+		`llms[1].model_prefix: duplicate model prefix "ds/", also used by llms[0]`,
+		`llms[1].model_alias: alias "ds/fast" is also an alias of llms[0]`,
+		`llms[2].name: the provider has no name`,
+		`llms[2].capability_policy: unknown capability policy "ignore", expected adapt, reject or passthrough`,
+		`llms[1].model_alias: alias "ds/chat" hides the model "ds/chat" of llms[0]`,
+		`mcps.both: the MCP server has both a command and a base_url`,
+		`mcps.none: the MCP server needs a command or a base_url`,
+	}, issues)
+}